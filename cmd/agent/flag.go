@@ -8,6 +8,17 @@ var (
 	flagPollInterval   int
 	flagKey            string
 	flagRateLimit      int
+	flagSpoolDir       string
+	flagSpoolMaxSize   int
+	flagSpoolMaxAge    int
+
+	flagDiskFSTypes            string
+	flagDiskExcludeFSTypes     string
+	flagDiskMountpoints        string
+	flagDiskExcludeMountpoints string
+	flagNetInterfaces          string
+	flagNetExcludeInterfaces   string
+	flagGaugeStats             string
 )
 
 func parseFlags() {
@@ -16,5 +27,15 @@ func parseFlags() {
 	flag.IntVar(&flagPollInterval, "p", 2, "interval to poll metrics (seconds)")
 	flag.StringVar(&flagKey, "k", "", "secret key")
 	flag.IntVar(&flagRateLimit, "l", 1, "rate limit for outgoing requests")
+	flag.StringVar(&flagSpoolDir, "spool-dir", "", "directory to keep unsent batches while the server is unavailable, one per agent (empty to disable)")
+	flag.IntVar(&flagSpoolMaxSize, "spool-size", 64, "maximum size of unsent batches on disk (megabytes)")
+	flag.IntVar(&flagSpoolMaxAge, "spool-age", 60, "unsent batches older than this are dropped (minutes, keep within the server -idempotency-ttl)")
+	flag.StringVar(&flagDiskFSTypes, "disk-fs", "", "comma-separated filesystem types to report disk metrics for (empty for all)")
+	flag.StringVar(&flagDiskExcludeFSTypes, "disk-exclude-fs", "tmpfs,devtmpfs,squashfs,overlay", "comma-separated filesystem types to skip")
+	flag.StringVar(&flagDiskMountpoints, "disk-mounts", "", "comma-separated mountpoint patterns to report disk metrics for (empty for all)")
+	flag.StringVar(&flagDiskExcludeMountpoints, "disk-exclude-mounts", "", "comma-separated mountpoint patterns to skip")
+	flag.StringVar(&flagNetInterfaces, "net-ifaces", "", "comma-separated interface name patterns to report network metrics for (empty for all)")
+	flag.StringVar(&flagNetExcludeInterfaces, "net-exclude-ifaces", "lo,veth*", "comma-separated interface name patterns to skip")
+	flag.StringVar(&flagGaugeStats, "gauge-stats", "*", "comma-separated gauge name patterns to also report min/max/avg per report interval for (empty to report only the last value)")
 	flag.Parse()
 }
@@ -10,6 +10,8 @@ import (
 	"log"
 	"net/http"
 	_ "net/http/pprof"
+	"os/signal"
+	"syscall"
 )
 
 var (
@@ -27,6 +29,17 @@ func main() {
 		"flagReportInterval": flagReportInterval,
 		"flagPollInterval":   flagPollInterval,
 		"flagRateLimit":      flagRateLimit,
+		"flagSpoolDir":       flagSpoolDir,
+		"flagSpoolMaxSize":   flagSpoolMaxSize,
+		"flagSpoolMaxAge":    flagSpoolMaxAge,
+
+		"flagDiskFSTypes":            flagDiskFSTypes,
+		"flagDiskExcludeFSTypes":     flagDiskExcludeFSTypes,
+		"flagDiskMountpoints":        flagDiskMountpoints,
+		"flagDiskExcludeMountpoints": flagDiskExcludeMountpoints,
+		"flagNetInterfaces":          flagNetInterfaces,
+		"flagNetExcludeInterfaces":   flagNetExcludeInterfaces,
+		"flagGaugeStats":             flagGaugeStats,
 	}
 
 	var cfg config.CfgAgentENV
@@ -41,6 +54,9 @@ func main() {
 			logrus.WithError(err).Error("pprof server failed")
 		}
 	}()
+	// При остановке агент отправляет метрики, накопленные с последней отправки.
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
+	defer stop()
 	agent := agent.NewAgent(agentCfg)
-	agent.Run(context.Background(), cfg.RateLimit)
+	agent.Run(ctx, cfg.RateLimit)
 }
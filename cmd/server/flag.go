@@ -9,6 +9,15 @@ var (
 	flagRestore         bool
 	flagConnDB          string
 	flagKey             string
+	flagGraphiteAddr    string
+	flagStatsdAddr      string
+	flagStatsdFlush     int
+	flagSeriesTTL       int
+	flagStrictTypes     bool
+	flagIdempotencyTTL  int
+	flagHistorySize     int
+	flagHistoryTTL      int
+	flagSetWindow       int
 )
 
 func parseFlags() {
@@ -18,5 +27,14 @@ func parseFlags() {
 	flag.BoolVar(&flagRestore, "r", true, "whether to restore metrics from file on startup")
 	flag.StringVar(&flagConnDB, "d", "", "host=<host> user=<user> password=<password> dbname=<dbname> sslmode=<disable/enable>")
 	flag.StringVar(&flagKey, "k", "", "secret key")
+	flag.StringVar(&flagGraphiteAddr, "g", "", "address to accept Graphite plaintext metrics over TCP (empty to disable)")
+	flag.StringVar(&flagStatsdAddr, "s", "", "address to accept StatsD metrics over UDP (empty to disable)")
+	flag.IntVar(&flagStatsdFlush, "sf", 10, "interval in seconds to flush aggregated StatsD metrics")
+	flag.IntVar(&flagSeriesTTL, "ttl", 0, "minutes after which series without updates are deleted (0 to keep forever)")
+	flag.BoolVar(&flagStrictTypes, "strict-types", false, "reject updates whose type differs from the first type seen for the metric")
+	flag.IntVar(&flagIdempotencyTTL, "idempotency-ttl", 7200, "seconds during which a replayed batch with the same Idempotency-Key is ignored (keep at least the agent -spool-age)")
+	flag.IntVar(&flagHistorySize, "history-size", 8640, "number of history samples kept in memory per series")
+	flag.IntVar(&flagHistoryTTL, "history-ttl", 168, "hours after which history samples are deleted (0 to keep forever)")
+	flag.IntVar(&flagSetWindow, "set-window", 60, "seconds per window of set metrics; members of earlier windows are dropped (0 to count for all time)")
 	flag.Parse()
 }
@@ -3,10 +3,12 @@ package main
 import (
 	"context"
 	"github.com/chestorix/monmetrics/internal/domain/interfaces"
+	"github.com/chestorix/monmetrics/internal/listener"
 	"github.com/chestorix/monmetrics/internal/metrics/repository"
 	"github.com/chestorix/monmetrics/internal/utils"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 	"time"
 
@@ -40,12 +42,23 @@ func main() {
 		"flagFileStoragePath": flagFileStoragePath,
 		"flagConnDB":          flagConnDB,
 		"flagKey":             flagKey,
+		"flagGraphiteAddress": flagGraphiteAddr,
+		"flagStatsdAddress":   flagStatsdAddr,
+		"flagStatsdFlush":     flagStatsdFlush,
+		"flagSeriesTTL":       flagSeriesTTL,
+		"flagStrictTypes":     flagStrictTypes,
+		"flagIdempotencyTTL":  flagIdempotencyTTL,
+		"flagHistorySize":     flagHistorySize,
+		"flagHistoryTTL":      flagHistoryTTL,
+		"flagSetWindow":       flagSetWindow,
 	}
 	logger = setupLogger()
 	cfg := &config.CfgServerENV{}
 	serverCfg := cfg.ApplyFlags(flags)
 	var err error
-	storage, err := repository.NewInitStorage().CreateStorage(cfg.DatabaseDSN, cfg.FileStoragePath)
+	storage, err := repository.NewInitStorage().CreateStorage(cfg.DatabaseDSN, cfg.FileStoragePath,
+		repository.WithHistorySize(serverCfg.HistorySize),
+		repository.WithSetWindow(serverCfg.SetWindow))
 	if err != nil {
 		logger.Fatalf("Failed to create storage: %v", err)
 	}
@@ -57,10 +70,18 @@ func main() {
 		}
 	}
 
-	metricService := service.NewService(storage)
+	metricService := service.NewService(storage,
+		service.WithStrictTypes(serverCfg.StrictTypes),
+		service.WithIdempotencyWindow(serverCfg.IdempotencyTTL),
+	)
 	server := api.NewServer(&serverCfg, metricService, logger)
 	setupBackgroundSaver(context.Background(), storage, serverCfg.StoreInterval)
-	setupGracefulShutdown(context.Background(), cancel, storage, server)
+	var listeners sync.WaitGroup
+	setupGraphiteListener(ctx, &listeners, metricService, serverCfg.GraphiteAddress)
+	setupStatsdListener(ctx, &listeners, metricService, serverCfg.StatsdAddress, serverCfg.StatsdFlush)
+	setupSeriesExpiry(ctx, metricService, serverCfg.SeriesTTL)
+	setupHistoryPruning(ctx, metricService, serverCfg.HistoryTTL)
+	setupGracefulShutdown(context.Background(), cancel, &listeners, storage, server)
 
 	if err := server.Start(); err != nil {
 		logger.WithError(err).Fatal("Server failed")
@@ -87,7 +108,98 @@ func setupBackgroundSaver(ctx context.Context, storage interfaces.Repository, in
 	}
 }
 
-func setupGracefulShutdown(ctx context.Context, cancel context.CancelFunc, storage interfaces.Repository, server *api.Server) {
+// setupSeriesExpiry периодически удаляет ряды, которые не обновлялись дольше ttl.
+// Проверка выполняется раз в минуту или раз в ttl, если он меньше минуты.
+func setupSeriesExpiry(ctx context.Context, metricService *service.MetricsService, ttl time.Duration) {
+	if ttl <= 0 {
+		return
+	}
+	interval := time.Minute
+	if ttl < interval {
+		interval = ttl
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				expired, err := metricService.ExpireSeries(ctx, ttl)
+				if err != nil {
+					logger.WithError(err).Error("Failed to expire stale series")
+					continue
+				}
+				if expired > 0 {
+					logger.WithField("expired", expired).Info("Expired stale series")
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// setupHistoryPruning периодически удаляет из истории значения старше ttl.
+// Проверка выполняется раз в час или раз в ttl, если он меньше часа.
+func setupHistoryPruning(ctx context.Context, metricService *service.MetricsService, ttl time.Duration) {
+	if ttl <= 0 {
+		return
+	}
+	interval := min(time.Hour, ttl)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				pruned, err := metricService.PruneHistory(ctx, ttl)
+				if err != nil {
+					logger.WithError(err).Error("Failed to prune metric history")
+					continue
+				}
+				if pruned > 0 {
+					logger.WithField("pruned", pruned).Info("Pruned metric history")
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+func setupGraphiteListener(ctx context.Context, wg *sync.WaitGroup, service interfaces.Service, address string) {
+	if address == "" {
+		return
+	}
+	graphite := listener.NewGraphiteListener(address, service, logger)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if err := graphite.ListenAndServe(ctx); err != nil {
+			logger.WithError(err).Error("Graphite listener failed")
+		}
+	}()
+}
+
+func setupStatsdListener(ctx context.Context, wg *sync.WaitGroup, service interfaces.Service, address string, flushInterval time.Duration) {
+	if address == "" {
+		return
+	}
+	statsd := listener.NewStatsdListener(address, flushInterval, service, logger)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if err := statsd.ListenAndServe(ctx); err != nil {
+			logger.WithError(err).Error("StatsD listener failed")
+		}
+	}()
+}
+
+// setupGracefulShutdown по сигналу останавливает слушатели, дожидается сброса их
+// агрегатов и только после этого сохраняет хранилище.
+func setupGracefulShutdown(ctx context.Context, cancel context.CancelFunc, listeners *sync.WaitGroup, storage interfaces.Repository, server *api.Server) {
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
 
@@ -95,11 +207,12 @@ func setupGracefulShutdown(ctx context.Context, cancel context.CancelFunc, stora
 		<-sigChan
 		logger.Info("Shutting down server...")
 
+		cancel()
+		listeners.Wait()
+
 		if err := storage.Save(ctx); err != nil {
 			logger.WithError(err).Error("Failed to save metrics on shutdown")
 		}
-
-		cancel()
 		os.Exit(0)
 	}()
 }
@@ -3,6 +3,8 @@ package agent
 
 import (
 	"context"
+	"os"
+	"strconv"
 	"sync"
 	"time"
 
@@ -10,29 +12,72 @@ import (
 	models "github.com/chestorix/monmetrics/internal/metrics"
 	"github.com/chestorix/monmetrics/internal/metrics/collector"
 	"github.com/chestorix/monmetrics/internal/metrics/sender"
+	"github.com/chestorix/monmetrics/internal/metrics/spool"
 	"github.com/shirou/gopsutil/v3/cpu"
 	"github.com/shirou/gopsutil/v3/mem"
+	"github.com/sirupsen/logrus"
 )
 
 type Agent struct {
 	collector *collector.RuntimeCollector
+	disk      *collector.DiskCollector
+	net       *collector.NetCollector
+	host      *collector.HostCollector
 	sender    *sender.HTTPSender
-	cfg       config.AgentConfig
+	spool     *spool.Spool
+	// spoolMu не дает новым пакетам обогнать пакеты очереди: replaySpool держит блокировку
+	// на запись, пока отправляет очередь, а sendOrSpool - на чтение, пока проверяет очередь и отправляет пакет.
+	spoolMu  sync.RWMutex
+	hostname string
+	cfg      config.AgentConfig
 }
 
+// NewAgent создает агента. Если задан каталог очереди, неотправленные пакеты сохраняются на диск;
+// если каталог не удалось открыть, агент работает без очереди.
 func NewAgent(cfg config.AgentConfig) *Agent {
-	return &Agent{
+	a := &Agent{
 		cfg:       cfg,
 		sender:    sender.NewHTTPSender(cfg.Address, cfg.Key),
 		collector: collector.NewRuntimeCollector(),
+		disk: collector.NewDiskCollector(collector.DiskFilter{
+			IncludeFSTypes:     cfg.DiskFSTypes,
+			ExcludeFSTypes:     cfg.DiskExcludeFSTypes,
+			IncludeMountpoints: cfg.DiskMountpoints,
+			ExcludeMountpoints: cfg.DiskExcludeMountpoints,
+		}),
+		net: collector.NewNetCollector(collector.NetFilter{
+			IncludeInterfaces: cfg.NetInterfaces,
+			ExcludeInterfaces: cfg.NetExcludeInterfaces,
+		}),
+		host: collector.NewHostCollector(),
 	}
+	if hostname, err := os.Hostname(); err == nil {
+		a.hostname = hostname
+	}
+	if cfg.SpoolDir != "" {
+		s, err := spool.Open(cfg.SpoolDir, cfg.SpoolMaxSize, cfg.SpoolMaxAge)
+		if err != nil {
+			logrus.WithError(err).Warn("Failed to open spool, unsent batches will be dropped")
+		} else {
+			a.spool = s
+		}
+	}
+	return a
 }
 
 func (a *Agent) Run(ctx context.Context, rateLimit int) {
 	metricsChan := make(chan []models.Metric, 100)
 
 	var wg sync.WaitGroup
-	wg.Add(2)
+	wg.Add(5)
+
+	if a.spool != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			a.replaySpool(ctx)
+		}()
+	}
 
 	go func() {
 		defer wg.Done()
@@ -44,6 +89,21 @@ func (a *Agent) Run(ctx context.Context, rateLimit int) {
 		a.collectGopsutilMetrics(ctx, metricsChan)
 	}()
 
+	go func() {
+		defer wg.Done()
+		a.collectDiskMetrics(ctx, metricsChan)
+	}()
+
+	go func() {
+		defer wg.Done()
+		a.collectNetMetrics(ctx, metricsChan)
+	}()
+
+	go func() {
+		defer wg.Done()
+		a.collectHostMetrics(ctx, metricsChan)
+	}()
+
 	a.processMetrics(ctx, metricsChan, rateLimit)
 
 	wg.Wait()
@@ -82,9 +142,12 @@ func (a *Agent) collectGopsutilMetrics(ctx context.Context, metricsChan chan<- [
 
 			if cpuStats, err := cpu.Percent(time.Second, true); err == nil {
 				for i, percent := range cpuStats {
-					gopsutilMetrics = append(gopsutilMetrics,
-						models.Metric{Name: "CPUutilization" + string(rune('1'+i)), Type: models.Gauge, Value: percent},
-					)
+					gopsutilMetrics = append(gopsutilMetrics, models.Metric{
+						Name:   "CPUutilization",
+						Type:   models.Gauge,
+						Value:  percent,
+						Labels: a.cpuLabels(i),
+					})
 				}
 			}
 
@@ -98,48 +161,208 @@ func (a *Agent) collectGopsutilMetrics(ctx context.Context, metricsChan chan<- [
 	}
 }
 
+// cpuLabels возвращает метки загрузки ядра core: номер ядра и, если он известен, имя хоста.
+func (a *Agent) cpuLabels(core int) map[string]string {
+	labels := map[string]string{"core": strconv.Itoa(core)}
+	if a.hostname != "" {
+		labels["host"] = a.hostname
+	}
+	return labels
+}
+
+func (a *Agent) collectDiskMetrics(ctx context.Context, metricsChan chan<- []models.Metric) {
+	ticker := time.NewTicker(a.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if metrics := a.disk.Collect(); len(metrics) > 0 {
+				metricsChan <- metrics
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (a *Agent) collectNetMetrics(ctx context.Context, metricsChan chan<- []models.Metric) {
+	ticker := time.NewTicker(a.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if metrics := a.net.Collect(); len(metrics) > 0 {
+				metricsChan <- metrics
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (a *Agent) collectHostMetrics(ctx context.Context, metricsChan chan<- []models.Metric) {
+	ticker := time.NewTicker(a.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if metrics := a.host.Collect(); len(metrics) > 0 {
+				metricsChan <- metrics
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// processMetrics накапливает результаты опросов и раз в ReportInterval отправляет их одним пакетом.
+// При завершении работы накопленные метрики отправляются последним пакетом.
 func (a *Agent) processMetrics(ctx context.Context, metricsChan <-chan []models.Metric, rateLimit int) {
 	var wg sync.WaitGroup
-	limiter := make(chan struct{}, rateLimit)
+	limiter := make(chan struct{}, max(rateLimit, 1))
+	agg := newAggregator(a.cfg.GaugeStats)
+	ticker := time.NewTicker(a.cfg.ReportInterval)
+	defer ticker.Stop()
 
-	for metricsBatch := range metricsChan {
+	report := func() {
+		metrics := agg.flush(time.Now())
+		if len(metrics) == 0 {
+			return
+		}
 		limiter <- struct{}{}
 		wg.Add(1)
-
-		go func(batch []models.Metric) {
+		go func() {
 			defer func() {
 				<-limiter
 				wg.Done()
 			}()
+			a.send(metrics)
+		}()
+	}
 
-			var metricsToSend []models.Metrics
-			for _, m := range batch {
-				metric := models.Metrics{
-					ID:    m.Name,
-					MType: m.Type,
+	for {
+		select {
+		case batch := <-metricsChan:
+			agg.add(batch)
+		case <-ticker.C:
+			report()
+		case <-ctx.Done():
+			report()
+			wg.Wait()
+			return
+		}
+	}
+}
+
+// send отправляет пакет метрик. Если включена дисковая очередь, неотправленный пакет сохраняется в нее,
+// иначе после неудачи gauge отправляются по одной, а остальные метрики - повторным пакетом.
+func (a *Agent) send(metrics []models.Metrics) {
+	if a.spool != nil {
+		a.sendOrSpool(metrics)
+		return
+	}
+
+	key, err := sender.NewIdempotencyKey()
+	if err != nil {
+		logrus.WithError(err).Error("Failed to generate idempotency key")
+		return
+	}
+	rejected, err := a.sender.SendBatchWithKey(key, metrics)
+	logRejected(rejected)
+	if err == nil {
+		return
+	}
+
+	// Пакет мог быть применен сервером, даже если ответ не дошел. Повторная запись gauge безопасна,
+	// а счетчики и другие накапливаемые метрики повторяются пакетом с тем же ключом идемпотентности:
+	// если исходный пакет был применен, сервер не применит повтор.
+	var rest []models.Metrics
+	for _, metric := range metrics {
+		if metric.MType != models.Gauge || metric.Value == nil {
+			rest = append(rest, metric)
+			continue
+		}
+		m := models.Metric{Name: metric.ID, Type: metric.MType, Labels: metric.Labels, Value: *metric.Value}
+		if err := a.sender.SendJSON(m); err != nil {
+			continue
+		}
+	}
+	if len(rest) == 0 {
+		return
+	}
+	rejected, err = a.sender.SendBatchWithKey(key, rest)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to send metrics")
+		return
+	}
+	logRejected(rejected)
+}
+
+// sendOrSpool отправляет пакет, а если сервер недоступен, сохраняет его в очередь.
+// Пока очередь не пуста, новые пакеты сразу записываются в нее, чтобы сервер получал их в порядке сбора.
+func (a *Agent) sendOrSpool(metrics []models.Metrics) {
+	key, err := sender.NewIdempotencyKey()
+	if err != nil {
+		logrus.WithError(err).Error("Failed to generate idempotency key")
+		return
+	}
+	batch := spool.Batch{Key: key, Metrics: metrics}
+	a.spoolMu.RLock()
+	defer a.spoolMu.RUnlock()
+	if a.spool.Empty() {
+		rejected, err := a.sender.SendBatchWithKey(batch.Key, batch.Metrics)
+		logRejected(rejected)
+		if err == nil {
+			return
+		}
+	}
+	if err := a.spool.Append(batch); err != nil {
+		logrus.WithError(err).Error("Failed to spool batch")
+	}
+}
+
+// replaySpool каждые ReportInterval отправляет пакеты из очереди в порядке записи
+// до первой неудачной отправки. Новые пакеты на это время ждут, а затем попадают в очередь,
+// если она не опустела.
+func (a *Agent) replaySpool(ctx context.Context) {
+	ticker := time.NewTicker(a.cfg.ReportInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			a.spoolMu.Lock()
+			for ctx.Err() == nil {
+				batch, ok, err := a.spool.Peek()
+				if err != nil {
+					logrus.WithError(err).Error("Failed to read spool")
+					break
 				}
-				switch m.Type {
-				case models.Gauge:
-					if val, ok := m.Value.(float64); ok {
-						metric.Value = &val
-					}
-				case models.Counter:
-					if val, ok := m.Value.(int64); ok {
-						metric.Delta = &val
-					}
+				if !ok {
+					break
 				}
-				metricsToSend = append(metricsToSend, metric)
-			}
-
-			if err := a.sender.SendBatch(metricsToSend); err != nil {
-				for _, metric := range batch {
-					if err := a.sender.SendJSON(metric); err != nil {
-						continue
-					}
+				rejected, err := a.sender.SendBatchWithKey(batch.Key, batch.Metrics)
+				if err != nil {
+					break
+				}
+				logRejected(rejected)
+				if err := a.spool.Ack(); err != nil {
+					logrus.WithError(err).Error("Failed to remove batch from spool")
+					break
 				}
 			}
-		}(metricsBatch)
+			a.spoolMu.Unlock()
+		case <-ctx.Done():
+			return
+		}
 	}
+}
 
-	wg.Wait()
+func logRejected(rejected []models.RejectedMetric) {
+	for _, r := range rejected {
+		logrus.WithFields(logrus.Fields{"metric": r.ID, "index": r.Index}).Warnf("Metric rejected by server: %s", r.Reason)
+	}
 }
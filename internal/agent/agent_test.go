@@ -0,0 +1,101 @@
+package agent
+
+import (
+	"context"
+	"io"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/chestorix/monmetrics/internal/api"
+	"github.com/chestorix/monmetrics/internal/config"
+	"github.com/chestorix/monmetrics/internal/domain/interfaces"
+	models "github.com/chestorix/monmetrics/internal/metrics"
+	"github.com/chestorix/monmetrics/internal/metrics/repository"
+	"github.com/chestorix/monmetrics/internal/metrics/sender"
+	"github.com/chestorix/monmetrics/internal/metrics/service"
+	"github.com/chestorix/monmetrics/internal/metrics/spool"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestServer(t *testing.T) (*httptest.Server, interfaces.HistoryRepository) {
+	t.Helper()
+	repo := repository.NewMemStorage("")
+	svc := service.NewService(repo)
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	router := api.NewRouter(logger)
+	router.SetupRoutes(api.NewMetricsHandler(svc, "", ""))
+	srv := httptest.NewServer(router)
+	t.Cleanup(srv.Close)
+	return srv, repo
+}
+
+func TestAgent_ReplaySpool(t *testing.T) {
+	srv, repo := newTestServer(t)
+	s, err := spool.Open(t.TempDir(), 0, 0)
+	require.NoError(t, err)
+
+	// Пакет собран во время недоступности сервера и отправляется из очереди позже.
+	collected := time.Now().Add(-10 * time.Minute).Truncate(time.Millisecond)
+	agg := newAggregator(nil)
+	agg.add([]models.Metric{{Name: "PollCount", Type: models.Counter, Value: int64(3)}})
+	require.NoError(t, s.Append(spool.Batch{Key: "outage", Metrics: agg.flush(collected)}))
+
+	a := &Agent{
+		cfg:    config.AgentConfig{ReportInterval: 10 * time.Millisecond},
+		sender: sender.NewHTTPSender(srv.URL, ""),
+		spool:  s,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		a.replaySpool(ctx)
+		close(done)
+	}()
+	require.Eventually(t, s.Empty, time.Second, 10*time.Millisecond)
+	cancel()
+	<-done
+
+	history, err := repo.GetHistory(context.Background(), models.Counter, "PollCount", collected.Add(-time.Minute), time.Now())
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+	assert.True(t, collected.Equal(history[0].Timestamp), "sample stamped at %v", history[0].Timestamp)
+	assert.Equal(t, 3.0, history[0].Value)
+}
+
+func TestAgent_ProcessMetrics(t *testing.T) {
+	srv, repo := newTestServer(t)
+	a := &Agent{
+		cfg:    config.AgentConfig{ReportInterval: 20 * time.Millisecond},
+		sender: sender.NewHTTPSender(srv.URL, ""),
+	}
+	metricsChan := make(chan []models.Metric, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		a.processMetrics(ctx, metricsChan, 0)
+		close(done)
+	}()
+
+	pollCount := func() int64 {
+		value, _, err := repo.GetCounter(context.Background(), "PollCount")
+		require.NoError(t, err)
+		return value
+	}
+	poll := []models.Metric{{Name: "PollCount", Type: models.Counter, Value: int64(1)}}
+
+	// Опросы между отправками суммируются и отправляются раз в ReportInterval.
+	metricsChan <- poll
+	metricsChan <- poll
+	require.Eventually(t, func() bool { return pollCount() == 2 }, time.Second, 5*time.Millisecond)
+
+	// При остановке накопленное с последней отправки отправляется последним пакетом.
+	metricsChan <- poll
+	require.Eventually(t, func() bool { return len(metricsChan) == 0 }, time.Second, time.Millisecond)
+	cancel()
+	<-done
+	assert.Equal(t, int64(3), pollCount())
+}
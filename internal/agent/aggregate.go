@@ -0,0 +1,140 @@
+// Package agent - содержит логику инициализации агента сбора метрик.
+package agent
+
+import (
+	"maps"
+	"path/filepath"
+	"sort"
+	"time"
+
+	models "github.com/chestorix/monmetrics/internal/metrics"
+)
+
+// statLabel - метка, которой значения статистики gauge за интервал отправки отличаются от последнего значения.
+const statLabel = "stat"
+
+type gaugeStats struct {
+	labels map[string]string
+	name   string
+	last   float64
+	min    float64
+	max    float64
+	sum    float64
+	count  int
+}
+
+type counterSum struct {
+	labels map[string]string
+	name   string
+	delta  int64
+}
+
+// aggregator накапливает опрошенные метрики между отправками: для gauge - последнее значение,
+// для счетчиков - сумму приращений. Для gauge, имя которых подходит под один из шаблонов stats
+// (filepath.Match), дополнительно отправляются минимальное, максимальное и среднее значения
+// за интервал с меткой stat=min, max или avg. Ряды определяются именем и метками.
+// Не безопасен для конкурентного использования.
+type aggregator struct {
+	gauges   map[string]*gaugeStats
+	counters map[string]*counterSum
+	stats    []string
+}
+
+func newAggregator(stats []string) *aggregator {
+	return &aggregator{
+		gauges:   make(map[string]*gaugeStats),
+		counters: make(map[string]*counterSum),
+		stats:    stats,
+	}
+}
+
+// add учитывает результат одного опроса. Значения неожиданного типа пропускаются.
+func (a *aggregator) add(metrics []models.Metric) {
+	for _, m := range metrics {
+		key := models.SeriesKey(m.Name, m.Labels)
+		switch m.Type {
+		case models.Gauge:
+			value, ok := m.Value.(float64)
+			if !ok {
+				continue
+			}
+			g, ok := a.gauges[key]
+			if !ok {
+				a.gauges[key] = &gaugeStats{labels: m.Labels, name: m.Name, last: value, min: value, max: value, sum: value, count: 1}
+				continue
+			}
+			g.last = value
+			g.min = min(g.min, value)
+			g.max = max(g.max, value)
+			g.sum += value
+			g.count++
+		case models.Counter:
+			delta, ok := m.Value.(int64)
+			if !ok {
+				continue
+			}
+			c, ok := a.counters[key]
+			if !ok {
+				c = &counterSum{labels: m.Labels, name: m.Name}
+				a.counters[key] = c
+			}
+			c.delta += delta
+		}
+	}
+}
+
+// flush возвращает накопленные метрики, отсортированные по ключу ряда, и начинает новый интервал.
+// Метрики помечаются временем ts, чтобы пакет, отправленный позже из очереди, попал в историю
+// на момент сбора, а не на момент повторной отправки.
+func (a *aggregator) flush(ts time.Time) []models.Metrics {
+	timestamp := ts.UnixMilli()
+	gaugeKeys := make([]string, 0, len(a.gauges))
+	for key := range a.gauges {
+		gaugeKeys = append(gaugeKeys, key)
+	}
+	sort.Strings(gaugeKeys)
+	counterKeys := make([]string, 0, len(a.counters))
+	for key := range a.counters {
+		counterKeys = append(counterKeys, key)
+	}
+	sort.Strings(counterKeys)
+
+	metrics := make([]models.Metrics, 0, len(gaugeKeys)+len(counterKeys))
+	for _, key := range gaugeKeys {
+		g := a.gauges[key]
+		last := g.last
+		metrics = append(metrics, models.Metrics{ID: g.name, MType: models.Gauge, Labels: g.labels, Value: &last, Timestamp: &timestamp})
+		if !a.withStats(g.name) {
+			continue
+		}
+		for _, stat := range []struct {
+			name  string
+			value float64
+		}{{"min", g.min}, {"max", g.max}, {"avg", g.sum / float64(g.count)}} {
+			value := stat.value
+			labels := make(map[string]string, len(g.labels)+1)
+			maps.Copy(labels, g.labels)
+			labels[statLabel] = stat.name
+			metrics = append(metrics, models.Metrics{ID: g.name, MType: models.Gauge, Labels: labels, Value: &value, Timestamp: &timestamp})
+		}
+	}
+	for _, key := range counterKeys {
+		c := a.counters[key]
+		delta := c.delta
+		metrics = append(metrics, models.Metrics{ID: c.name, MType: models.Counter, Labels: c.labels, Delta: &delta, Timestamp: &timestamp})
+	}
+
+	a.gauges = make(map[string]*gaugeStats)
+	a.counters = make(map[string]*counterSum)
+	return metrics
+}
+
+// withStats сообщает, что для gauge name нужно отправлять статистику за интервал.
+func (a *aggregator) withStats(name string) bool {
+	for _, pattern := range a.stats {
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,53 @@
+package agent
+
+import (
+	"testing"
+	"time"
+
+	models "github.com/chestorix/monmetrics/internal/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAggregator(t *testing.T) {
+	agg := newAggregator([]string{"CPU*"})
+	for _, value := range []float64{4, 1, 7} {
+		agg.add([]models.Metric{
+			{Name: "Alloc", Type: models.Gauge, Value: value},
+			{Name: "CPUutilization", Type: models.Gauge, Value: value, Labels: map[string]string{"core": "0"}},
+			{Name: "PollCount", Type: models.Counter, Value: int64(1)},
+		})
+	}
+	agg.add([]models.Metric{{Name: "PollCount", Type: models.Counter, Value: int64(2), Labels: map[string]string{"host": "a"}}})
+
+	ts := time.UnixMilli(1700000000000)
+	metrics := agg.flush(ts)
+	require.Len(t, metrics, 7)
+	got := make(map[string]float64)
+	for _, m := range metrics {
+		require.NotNil(t, m.Timestamp)
+		assert.Equal(t, ts.UnixMilli(), *m.Timestamp)
+		key := models.SeriesKey(m.ID, m.Labels)
+		if m.MType == models.Counter {
+			got[key] = float64(*m.Delta)
+		} else {
+			got[key] = *m.Value
+		}
+	}
+	assert.Equal(t, map[string]float64{
+		"Alloc":                               7,
+		`CPUutilization{core="0"}`:            7,
+		`CPUutilization{core="0",stat="min"}`: 1,
+		`CPUutilization{core="0",stat="max"}`: 7,
+		`CPUutilization{core="0",stat="avg"}`: 4,
+		"PollCount":                           3,
+		`PollCount{host="a"}`:                 2,
+	}, got)
+
+	assert.Empty(t, agg.flush(ts))
+
+	// Шаблон по умолчанию "*" включает статистику для всех gauge.
+	agg = newAggregator([]string{"*"})
+	agg.add([]models.Metric{{Name: "Alloc", Type: models.Gauge, Value: 1.0}})
+	assert.Len(t, agg.flush(ts), 4)
+}
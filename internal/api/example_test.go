@@ -129,6 +129,22 @@ func (m *mockService) UpdateMetricsBatch(ctx context.Context, metrics []models.M
 	return nil
 }
 
+func (m *mockService) UpdateMetricsBatchOnce(ctx context.Context, key string, metrics []models.Metrics) (bool, error) {
+	return true, m.UpdateMetricsBatch(ctx, metrics)
+}
+
+func (m *mockService) UpdateMetricsBatchPartial(ctx context.Context, key string, metrics []models.Metrics) (models.BatchResult, bool, error) {
+	result := models.BatchResult{Rejected: []models.RejectedMetric{}}
+	for i, metric := range metrics {
+		if _, err := m.UpdateMetricJSON(ctx, metric); err != nil {
+			result.Rejected = append(result.Rejected, models.RejectedMetric{ID: metric.ID, Reason: err.Error(), Index: i})
+			continue
+		}
+		result.Accepted++
+	}
+	return result, true, nil
+}
+
 // Методы для получения всех метрик
 func (m *mockService) GetAll(ctx context.Context) ([]models.Metric, error) {
 	var result []models.Metric
@@ -152,6 +168,58 @@ func (m *mockService) GetAll(ctx context.Context) ([]models.Metric, error) {
 	return result, nil
 }
 
+// Метод для получения истории метрики
+func (m *mockService) QueryRange(ctx context.Context, query models.RangeQuery) (models.RangeResult, error) {
+	return models.RangeResult{ID: query.ID, MType: query.MType, Step: query.Step.String()}, nil
+}
+
+// Метод для агрегации истории метрики
+func (m *mockService) Aggregate(ctx context.Context, query models.RangeQuery) (models.AggregateResult, error) {
+	return models.AggregateResult{ID: query.ID, MType: query.MType, Func: query.Func}, nil
+}
+
+// Метод для выборки рядов по селектору
+func (m *mockService) Select(ctx context.Context, mType, selector string) ([]models.Metrics, error) {
+	return []models.Metrics{}, nil
+}
+
+// Метод для получения истории рядов по селектору
+func (m *mockService) QueryRangeSeries(ctx context.Context, query models.RangeQuery) (models.SelectRangeResult, error) {
+	return models.SelectRangeResult{Match: query.ID, MType: query.MType, Step: query.Step.String()}, nil
+}
+
+// Метод для агрегации истории рядов по селектору
+func (m *mockService) AggregateSeries(ctx context.Context, query models.RangeQuery) (models.SelectAggregateResult, error) {
+	return models.SelectAggregateResult{Match: query.ID, MType: query.MType, Func: query.Func}, nil
+}
+
+// Методы для работы с метаданными
+func (m *mockService) SetMetadata(ctx context.Context, meta models.Metadata) error {
+	return nil
+}
+
+func (m *mockService) GetMetadata(ctx context.Context, name string) (models.Metadata, error) {
+	return models.Metadata{}, models.ErrMetricNotFound
+}
+
+func (m *mockService) GetAllMetadata(ctx context.Context) (map[string]models.Metadata, error) {
+	return map[string]models.Metadata{}, nil
+}
+
+// Метод для смены типа метрики
+func (m *mockService) Retype(ctx context.Context, name, mType string) (models.Metadata, error) {
+	return models.Metadata{ID: name, Type: mType}, nil
+}
+
+// Методы для удаления метрик
+func (m *mockService) DeleteMetric(ctx context.Context, mType, name string) error {
+	return nil
+}
+
+func (m *mockService) DeleteSeries(ctx context.Context, mType, prefix, selector string) (int, error) {
+	return 0, nil
+}
+
 // Метод для проверки соединения с БД
 func (m *mockService) CheckDB(ctx context.Context, dsn string) error {
 	return m.dbError
@@ -5,7 +5,9 @@ import (
 	"context"
 	"crypto/hmac"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"html"
 	"io"
 	"net/http"
 	"strconv"
@@ -17,6 +19,9 @@ import (
 	"github.com/chestorix/monmetrics/internal/utils"
 )
 
+// maxIdempotencyKeyLen ограничивает длину заголовка Idempotency-Key.
+const maxIdempotencyKeyLen = 255
+
 // MetricsHandler обрабатывает HTTP-запросы для операций с метриками.
 // Содержит методы для обновления, получения и проверки метрик.
 type MetricsHandler struct {
@@ -63,6 +68,7 @@ func (h *MetricsHandler) checkHash(r *http.Request, data []byte) (bool, string)
 // - 200: успешное обновление
 // - 400: неверный запрос
 // - 405: метод не разрешен
+// - 409: в режиме контроля типов метрика зарегистрирована с другим типом
 // - 500: внутренняя ошибка сервера
 func (h *MetricsHandler) UpdateHandler(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), time.Second*2)
@@ -91,7 +97,7 @@ func (h *MetricsHandler) UpdateHandler(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		if err := h.service.UpdateGauge(ctx, metricName, value); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			http.Error(w, err.Error(), updateErrorStatus(err))
 			return
 		}
 		w.WriteHeader(http.StatusOK)
@@ -104,7 +110,7 @@ func (h *MetricsHandler) UpdateHandler(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		if err := h.service.UpdateCounter(ctx, metricName, value); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			http.Error(w, err.Error(), updateErrorStatus(err))
 			return
 		}
 		w.WriteHeader(http.StatusOK)
@@ -116,7 +122,7 @@ func (h *MetricsHandler) UpdateHandler(w http.ResponseWriter, r *http.Request) {
 
 // GetValuesHandler обрабатывает GET запрос на получение значений метрик.
 // Формат пути: /value/<metricType>/<metricName>
-// Поддерживаемые типы: gauge, counter
+// Поддерживаемые типы: gauge, counter, histogram, summary, set
 // Возможные коды ответа:
 // - 200: успешное получение значения
 // - 400: неверный запрос
@@ -168,11 +174,70 @@ func (h *MetricsHandler) GetValuesHandler(w http.ResponseWriter, r *http.Request
 		w.WriteHeader(http.StatusOK)
 		fmt.Fprint(w, value)
 
+	case models.Histogram, models.Summary, models.Set:
+		metric, err := h.service.GetMetricJSON(ctx, models.Metrics{ID: metricName, MType: metricType})
+		if err != nil {
+			if err == models.ErrMetricNotFound {
+				http.Error(w, err.Error(), http.StatusNotFound)
+			} else {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		switch {
+		case metric.Histogram != nil:
+			fmt.Fprint(w, metric.Histogram)
+		case metric.Sketch != nil:
+			fmt.Fprint(w, metric.Sketch)
+		case metric.Delta != nil:
+			fmt.Fprint(w, *metric.Delta)
+		}
+
 	default:
 		http.Error(w, models.ErrInvalidMetricType.Error(), http.StatusBadRequest)
 	}
 }
 
+// DeleteValueHandler обрабатывает DELETE запрос на удаление метрики вместе с историей.
+// Формат пути: /value/<metricType>/<metricName>
+// Удаляется только ряд без меток, ряды с метками удаляются через DELETE /api/v1/series.
+// Возможные коды ответа:
+// - 200: метрика удалена
+// - 400: неверный тип метрики
+// - 404: метрика не найдена
+// - 405: метод не разрешен
+// - 500: внутренняя ошибка сервера
+func (h *MetricsHandler) DeleteValueHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), time.Second*2)
+	defer cancel()
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	path := strings.Trim(r.URL.Path, "/")
+	parts := strings.Split(path, "/")
+	if len(parts) < 3 {
+		http.Error(w, "Invalid request", http.StatusNotFound)
+		return
+	}
+
+	if err := h.service.DeleteMetric(ctx, parts[1], parts[2]); err != nil {
+		switch {
+		case errors.Is(err, models.ErrMetricNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case errors.Is(err, models.ErrInvalidMetricType):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintln(w, "Metric deleted")
+}
+
 // GetAllMetricsHandler обрабатывает GET запрос на получение всех метрик в формате HTML.
 // Возможные коды ответа:
 // - 200: успешное получение всех метрик
@@ -192,19 +257,28 @@ func (h *MetricsHandler) GetAllMetricsHandler(w http.ResponseWriter, r *http.Req
 		http.Error(w, "Failed to get metrics", http.StatusInternalServerError)
 		return
 	}
+	metadata, err := h.service.GetAllMetadata(ctx)
+	if err != nil {
+		http.Error(w, "Failed to get metadata", http.StatusInternalServerError)
+		return
+	}
 
 	w.WriteHeader(http.StatusOK)
-	html := generateMetricsHTML(metrics)
+	html := generateMetricsHTML(metrics, metadata)
 	w.Write([]byte(html))
 }
 
 // UpdateJSONHandler обрабатывает POST запрос для обновления метрик в формате JSON.
 // Формат JSON: {"id": "metricName", "type": "gauge|counter", "value|delta": number}
+// или {"id": "metricName", "type": "histogram", "histogram": {"bounds": [...], "counts": [...], "sum": number, "count": number}}
+// Для счетчиков необязательное поле "op" задает операцию: "add" (по умолчанию), "set" - присвоить значение delta,
+// "reset" - сбросить в ноль, "cumulative" - delta содержит накопленный итог источника.
 // Также проверяет хеш при наличии ключа.
 // Возможные коды ответа:
 // - 200: успешное обновление
-// - 400: неверный запрос или неверный хеш
+// - 400: неверный запрос, неверная операция над счетчиком или неверный хеш
 // - 405: метод не разрешен
+// - 409: в режиме контроля типов метрика зарегистрирована с другим типом
 // - 500: внутренняя ошибка сервера
 func (h *MetricsHandler) UpdateJSONHandler(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), time.Second*2)
@@ -241,9 +315,15 @@ func (h *MetricsHandler) UpdateJSONHandler(w http.ResponseWriter, r *http.Reques
 
 	updateMetric, err := h.service.UpdateMetricJSON(ctx, metric)
 	if err != nil {
-		switch err {
-		case models.ErrInvalidMetricType:
+		switch {
+		case errors.Is(err, models.ErrInvalidMetricType):
 			renderError(w, "Invalid metric type", http.StatusBadRequest)
+		case errors.Is(err, models.ErrInvalidLabels), errors.Is(err, models.ErrInvalidMetricName), errors.Is(err, models.ErrInvalidHistogram),
+			errors.Is(err, models.ErrInvalidSketch), errors.Is(err, models.ErrInvalidSet),
+			errors.Is(err, models.ErrInvalidCounterOp):
+			renderError(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, models.ErrTypeConflict):
+			renderError(w, err.Error(), http.StatusConflict)
 		default:
 			renderError(w, "Internal server error", http.StatusInternalServerError)
 		}
@@ -266,7 +346,7 @@ func (h *MetricsHandler) UpdateJSONHandler(w http.ResponseWriter, r *http.Reques
 }
 
 // ValueJSONHandler обрабатывает POST запрос на получение значений метрик в формате JSON.
-// Формат JSON: {"id": "metricName", "type": "gauge|counter"}
+// Формат JSON: {"id": "metricName", "type": "gauge|counter|histogram"}
 // Возможные коды ответа:
 // - 200: успешное получение значения
 // - 400: неверный запрос
@@ -331,11 +411,17 @@ func (h *MetricsHandler) PingHandler(w http.ResponseWriter, r *http.Request) {
 
 // UpdatesHandler обрабатывает POST запрос обновления пачки метрик за одну транзакцию в формате JSON.
 // Формат JSON: [{"id": "metric1", "type": "gauge", "value": 1.23}, ...]
+// Необязательный заголовок Idempotency-Key задает ключ пакета: повтор пакета с тем же ключом
+// в течение окна идемпотентности не применяется повторно, а в ответе выставляется заголовок Idempotent-Replayed.
+// С параметром partial=true пакет принимается частично: корректные метрики применяются, а в ответе
+// возвращается JSON {"accepted": n, "rejected": [{"index": i, "id": "metric", "reason": "..."}]}.
+// Без него некорректная метрика отклоняет весь пакет.
 // Также проверяет хеш при наличии ключа.
 // Возможные коды ответа:
-// - 200: успешное обновление
-// - 400: неверный запрос или пустой пакет
+// - 200: успешное обновление (в режиме частичного приема - даже если часть метрик отклонена)
+// - 400: неверный запрос, пустой пакет, некорректная метрика или слишком длинный ключ идемпотентности
 // - 405: метод не разрешен
+// - 409: в режиме контроля типов метрика зарегистрирована с другим типом
 // - 500: внутренняя ошибка сервера
 func (h *MetricsHandler) UpdatesHandler(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), time.Second*2)
@@ -376,18 +462,55 @@ func (h *MetricsHandler) UpdatesHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	if err := h.service.UpdateMetricsBatch(ctx, metrics); err != nil {
+	idempotencyKey := r.Header.Get("Idempotency-Key")
+	if len(idempotencyKey) > maxIdempotencyKeyLen {
+		renderError(w, "Idempotency key is too long", http.StatusBadRequest)
+		return
+	}
+
+	if r.URL.Query().Get("partial") == "true" {
+		result, applied, err := h.service.UpdateMetricsBatchPartial(ctx, idempotencyKey, metrics)
+		if err != nil {
+			renderError(w, fmt.Sprintf("Failed to update metrics: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if !applied {
+			w.Header().Set("Idempotent-Replayed", "true")
+		}
+		w.WriteHeader(http.StatusOK)
+		if err := json.NewEncoder(w).Encode(result); err != nil {
+			renderError(w, "Internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	applied, err := h.service.UpdateMetricsBatchOnce(ctx, idempotencyKey, metrics)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidMetricType) || errors.Is(err, models.ErrInvalidLabels) || errors.Is(err, models.ErrInvalidMetricName) ||
+			errors.Is(err, models.ErrInvalidHistogram) ||
+			errors.Is(err, models.ErrInvalidSketch) || errors.Is(err, models.ErrInvalidSet) ||
+			errors.Is(err, models.ErrInvalidCounterOp) {
+			renderError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, models.ErrTypeConflict) {
+			renderError(w, err.Error(), http.StatusConflict)
+			return
+		}
 		renderError(w, fmt.Sprintf("Failed to update metrics: %v", err), http.StatusInternalServerError)
 		return
 	}
 
+	if !applied {
+		w.Header().Set("Idempotent-Replayed", "true")
+	}
 	w.WriteHeader(http.StatusOK)
 }
 
 // generateMetricsHTML генерирует HTML страницу со списком всех метрик.
-// Принимает slice метрик.
+// Принимает slice метрик и метаданные по имени метрики, которые выводятся рядом со значением.
 // Возвращает сгенерированную HTML строку.
-func generateMetricsHTML(metrics []models.Metric) string {
+func generateMetricsHTML(metrics []models.Metric, metadata map[string]models.Metadata) string {
 	var htmlBuilder strings.Builder
 
 	htmlBuilder.WriteString(`
@@ -410,18 +533,28 @@ func generateMetricsHTML(metrics []models.Metric) string {
             <tr>
                 <th>Type</th>
                 <th>Name</th>
+                <th>Labels</th>
                 <th>Value</th>
+                <th>Unit</th>
+                <th>Description</th>
+                <th>Owner</th>
             </tr>
     `)
 
 	for _, metric := range metrics {
+		meta := metadata[metric.Name]
 		htmlBuilder.WriteString(fmt.Sprintf(`
             <tr>
+                <td>%s</td>
                 <td>%s</td>
                 <td>%s</td>
                 <td>%v</td>
+                <td>%s</td>
+                <td>%s</td>
+                <td>%s</td>
             </tr>
-        `, metric.Type, metric.Name, metric.Value))
+        `, metric.Type, html.EscapeString(metric.Name), html.EscapeString(formatLabels(metric.Labels)), metric.Value,
+			html.EscapeString(meta.Unit), html.EscapeString(meta.Help), html.EscapeString(meta.Owner)))
 	}
 
 	htmlBuilder.WriteString(`
@@ -433,6 +566,23 @@ func generateMetricsHTML(metrics []models.Metric) string {
 	return htmlBuilder.String()
 }
 
+// formatLabels форматирует метки метрики в виде label="value", отсортированными по имени.
+func formatLabels(labels map[string]string) string {
+	key := models.SeriesKey("", labels)
+	return strings.TrimSuffix(strings.TrimPrefix(key, "{"), "}")
+}
+
+// updateErrorStatus возвращает статус код ответа для ошибки обновления метрики.
+func updateErrorStatus(err error) int {
+	if errors.Is(err, models.ErrTypeConflict) {
+		return http.StatusConflict
+	}
+	if errors.Is(err, models.ErrInvalidMetricName) {
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
 // renderError отправляет ошибку в формате JSON.
 // Принимает:
 // - w: ResponseWriter для записи ответа
@@ -3,9 +3,12 @@ package api
 import (
 	"context"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"sort"
 	"strings"
 	"testing"
 	"time"
@@ -18,6 +21,12 @@ import (
 type MockMetricsService struct {
 	gaugeValues   map[string]float64
 	counterValues map[string]int64
+	histograms    map[string]models.HistogramValue
+	sketches      map[string]models.SketchValue
+	sets          map[string]models.SetValue
+	metadata      map[string]models.Metadata
+	history       map[string][]models.Sample
+	batches       map[string]bool
 	ctx           context.Context
 	getAllError   bool
 	checkDBError  bool
@@ -27,6 +36,12 @@ func NewMockMetricsService() *MockMetricsService {
 	return &MockMetricsService{
 		gaugeValues:   make(map[string]float64),
 		counterValues: make(map[string]int64),
+		histograms:    make(map[string]models.HistogramValue),
+		sketches:      make(map[string]models.SketchValue),
+		sets:          make(map[string]models.SetValue),
+		metadata:      make(map[string]models.Metadata),
+		history:       make(map[string][]models.Sample),
+		batches:       make(map[string]bool),
 	}
 }
 
@@ -87,18 +102,49 @@ func (m *MockMetricsService) GetAll(ctx context.Context) ([]models.Metric, error
 	}
 
 	var metric []models.Metric
-	for name, value := range m.gaugeValues {
+	for key, value := range m.gaugeValues {
+		name, labels, _ := models.ParseSeriesKey(key)
 		metric = append(metric, models.Metric{
-			Name:  name,
-			Type:  models.Gauge,
-			Value: value,
+			Name:   name,
+			Type:   models.Gauge,
+			Value:  value,
+			Labels: labels,
 		})
 	}
-	for name, value := range m.counterValues {
+	for key, value := range m.counterValues {
+		name, labels, _ := models.ParseSeriesKey(key)
 		metric = append(metric, models.Metric{
-			Name:  name,
-			Type:  models.Counter,
-			Value: value,
+			Name:   name,
+			Type:   models.Counter,
+			Value:  value,
+			Labels: labels,
+		})
+	}
+	for key, value := range m.histograms {
+		name, labels, _ := models.ParseSeriesKey(key)
+		metric = append(metric, models.Metric{
+			Name:   name,
+			Type:   models.Histogram,
+			Value:  value,
+			Labels: labels,
+		})
+	}
+	for key, value := range m.sketches {
+		name, labels, _ := models.ParseSeriesKey(key)
+		metric = append(metric, models.Metric{
+			Name:   name,
+			Type:   models.Summary,
+			Value:  value,
+			Labels: labels,
+		})
+	}
+	for key, value := range m.sets {
+		name, labels, _ := models.ParseSeriesKey(key)
+		metric = append(metric, models.Metric{
+			Name:   name,
+			Type:   models.Set,
+			Value:  value,
+			Labels: labels,
 		})
 	}
 	return metric, nil
@@ -132,6 +178,48 @@ func (m *MockMetricsService) UpdateMetricJSON(ctx context.Context, metric models
 			MType: metric.MType,
 			Delta: &updatedValue,
 		}, nil
+	case models.Histogram:
+		if metric.Histogram == nil {
+			return metric, models.ErrInvalidMetricType
+		}
+		if err := metric.Histogram.Validate(); err != nil {
+			return metric, err
+		}
+		current, ok := m.histograms[metric.ID]
+		if !ok {
+			current = models.HistogramValue{Bounds: metric.Histogram.Bounds, Counts: make([]uint64, len(metric.Histogram.Counts))}
+		}
+		merged, err := current.Merge(*metric.Histogram)
+		if err != nil {
+			return metric, err
+		}
+		m.histograms[metric.ID] = merged
+		return models.Metrics{
+			ID:        metric.ID,
+			MType:     metric.MType,
+			Histogram: &merged,
+		}, nil
+	case models.Summary:
+		if metric.Sketch == nil {
+			return metric, models.ErrInvalidMetricType
+		}
+		if err := metric.Sketch.Validate(); err != nil {
+			return metric, err
+		}
+		current, ok := m.sketches[metric.ID]
+		if !ok {
+			current = models.NewSketch(metric.Sketch.Alpha)
+		}
+		merged, err := current.Merge(*metric.Sketch)
+		if err != nil {
+			return metric, err
+		}
+		m.sketches[metric.ID] = merged
+		return models.Metrics{
+			ID:     metric.ID,
+			MType:  metric.MType,
+			Sketch: &merged,
+		}, nil
 	default:
 		return metric, models.ErrInvalidMetricType
 	}
@@ -175,6 +263,66 @@ func (m *MockMetricsService) GetMetricJSON(ctx context.Context, metric models.Me
 		return metric, models.ErrInvalidMetricType
 	}
 }
+func (m *MockMetricsService) SetMetadata(ctx context.Context, meta models.Metadata) error {
+	if err := meta.Validate(); err != nil {
+		return err
+	}
+	m.metadata[meta.ID] = meta
+	return nil
+}
+
+func (m *MockMetricsService) GetMetadata(ctx context.Context, name string) (models.Metadata, error) {
+	meta, ok := m.metadata[name]
+	if !ok {
+		return models.Metadata{}, models.ErrMetricNotFound
+	}
+	return meta, nil
+}
+
+func (m *MockMetricsService) GetAllMetadata(ctx context.Context) (map[string]models.Metadata, error) {
+	return m.metadata, nil
+}
+
+func (m *MockMetricsService) Retype(ctx context.Context, name, mType string) (models.Metadata, error) {
+	if !models.IsValidType(mType) {
+		return models.Metadata{}, fmt.Errorf("%w: unknown type %q", models.ErrInvalidMetadata, mType)
+	}
+	meta := m.metadata[name]
+	meta.ID = name
+	meta.Type = mType
+	m.metadata[name] = meta
+	return meta, nil
+}
+
+func (m *MockMetricsService) DeleteMetric(ctx context.Context, mType, name string) error {
+	var ok bool
+	switch mType {
+	case models.Gauge:
+		_, ok = m.gaugeValues[name]
+		delete(m.gaugeValues, name)
+	case models.Counter:
+		_, ok = m.counterValues[name]
+		delete(m.counterValues, name)
+	default:
+		return models.ErrInvalidMetricType
+	}
+	if !ok {
+		return models.ErrMetricNotFound
+	}
+	return nil
+}
+
+func (m *MockMetricsService) DeleteSeries(ctx context.Context, mType, prefix, selector string) (int, error) {
+	var deleted int
+	for name := range m.gaugeValues {
+		if strings.HasPrefix(name, prefix) {
+			delete(m.gaugeValues, name)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
 func (m *MockMetricsService) CheckDB(ctx context.Context, ps string) error {
 	select {
 	case <-ctx.Done():
@@ -194,6 +342,122 @@ func (m *MockMetricsService) UpdateMetricsBatch(ctx context.Context, metrics []m
 	return nil
 }
 
+func (m *MockMetricsService) UpdateMetricsBatchOnce(ctx context.Context, key string, metrics []models.Metrics) (bool, error) {
+	if key != "" && m.batches[key] {
+		return false, nil
+	}
+	for _, metric := range metrics {
+		if metric.MType == models.Counter && metric.Delta != nil {
+			m.counterValues[metric.Key()] += *metric.Delta
+		}
+	}
+	if key != "" {
+		m.batches[key] = true
+	}
+	return true, nil
+}
+
+func (m *MockMetricsService) UpdateMetricsBatchPartial(ctx context.Context, key string, metrics []models.Metrics) (models.BatchResult, bool, error) {
+	result := models.BatchResult{Rejected: []models.RejectedMetric{}}
+	var valid []models.Metrics
+	for i, metric := range metrics {
+		if (metric.MType == models.Gauge && metric.Value == nil) || (metric.MType == models.Counter && metric.Delta == nil) {
+			result.Rejected = append(result.Rejected, models.RejectedMetric{ID: metric.ID, Reason: "missing value", Index: i})
+			continue
+		}
+		valid = append(valid, metric)
+	}
+	applied, err := m.UpdateMetricsBatchOnce(ctx, key, valid)
+	if err != nil {
+		return models.BatchResult{}, false, err
+	}
+	result.Accepted = len(valid)
+	return result, applied, nil
+}
+
+func (m *MockMetricsService) QueryRange(ctx context.Context, query models.RangeQuery) (models.RangeResult, error) {
+	select {
+	case <-ctx.Done():
+		return models.RangeResult{}, ctx.Err()
+	default:
+	}
+	if query.MType != models.Gauge && query.MType != models.Counter {
+		return models.RangeResult{}, models.ErrInvalidMetricType
+	}
+	samples, ok := m.history[query.ID]
+	if !ok {
+		return models.RangeResult{}, models.ErrMetricNotFound
+	}
+	return models.RangeResult{
+		ID:     query.ID,
+		MType:  query.MType,
+		Func:   query.Func,
+		Step:   query.Step.String(),
+		Points: samples,
+	}, nil
+}
+
+func (m *MockMetricsService) Aggregate(ctx context.Context, query models.RangeQuery) (models.AggregateResult, error) {
+	select {
+	case <-ctx.Done():
+		return models.AggregateResult{}, ctx.Err()
+	default:
+	}
+	if query.Func == "rate" && query.MType != models.Counter {
+		return models.AggregateResult{}, models.ErrInvalidQuery
+	}
+	samples, ok := m.history[query.ID]
+	if !ok || len(samples) == 0 {
+		return models.AggregateResult{}, models.ErrMetricNotFound
+	}
+	return models.AggregateResult{
+		From:  query.From,
+		To:    query.To,
+		ID:    query.ID,
+		MType: query.MType,
+		Func:  query.Func,
+		Value: samples[len(samples)-1].Value,
+	}, nil
+}
+
+func (m *MockMetricsService) Select(ctx context.Context, mType, selector string) ([]models.Metrics, error) {
+	sel, err := models.ParseSelector(selector)
+	if err != nil {
+		return nil, err
+	}
+	all, err := m.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]models.Metrics, 0)
+	for _, metric := range all {
+		if (mType != "" && metric.Type != mType) || !sel.Matches(metric.Name, metric.Labels) {
+			continue
+		}
+		m := models.Metrics{ID: metric.Name, MType: metric.Type, Labels: metric.Labels}
+		if value, ok := metric.Value.(float64); ok {
+			m.Value = &value
+		}
+		result = append(result, m)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Key() < result[j].Key() })
+	return result, nil
+}
+
+func (m *MockMetricsService) QueryRangeSeries(ctx context.Context, query models.RangeQuery) (models.SelectRangeResult, error) {
+	if _, err := models.ParseSelector(query.ID); err != nil {
+		return models.SelectRangeResult{}, err
+	}
+	return models.SelectRangeResult{Match: query.ID, MType: query.MType, Step: query.Step.String(), By: query.By, Series: []models.SeriesRange{}}, nil
+}
+
+func (m *MockMetricsService) AggregateSeries(ctx context.Context, query models.RangeQuery) (models.SelectAggregateResult, error) {
+	if _, err := models.ParseSelector(query.ID); err != nil {
+		return models.SelectAggregateResult{}, err
+	}
+	return models.SelectAggregateResult{From: query.From, To: query.To, Match: query.ID, MType: query.MType, Func: query.Func, Agg: query.Agg, By: query.By, Series: []models.SeriesValue{}}, nil
+}
+
 func TestMetricsHandler_UpdateHandler(t *testing.T) {
 	type want struct {
 		code        int
@@ -379,6 +643,20 @@ func TestMetricsHandler_GetAllMetricsHandler(t *testing.T) {
 				"<td>42</td>",
 			},
 		},
+		{
+			name: "metrics with metadata",
+			prepare: func(service *MockMetricsService) {
+				service.UpdateGauge(ctx, "OtherSys", 1024)
+				service.SetMetadata(ctx, models.Metadata{ID: "OtherSys", Unit: "bytes", Help: "Memory in <misc> runtime allocations", Owner: "runtime-team"})
+			},
+			wantCode: http.StatusOK,
+			wantInBody: []string{
+				"<td>OtherSys</td>",
+				"<td>bytes</td>",
+				"<td>Memory in &lt;misc&gt; runtime allocations</td>",
+				"<td>runtime-team</td>",
+			},
+		},
 		{
 			name:     "empty metrics",
 			prepare:  func(service *MockMetricsService) {},
@@ -451,6 +729,24 @@ func TestMetricsHandler_UpdateJSONHandler(t *testing.T) {
 			wantStatus:   http.StatusOK,
 			wantResponse: `{"id":"requests","type":"counter","delta":1}`,
 		},
+		{
+			name:         "update histogram",
+			payload:      `{"id":"latency","type":"histogram","histogram":{"bounds":[0.1,0.5],"counts":[2,1,0],"sum":0.6,"count":3}}`,
+			wantStatus:   http.StatusOK,
+			wantResponse: `{"id":"latency","type":"histogram","histogram":{"bounds":[0.1,0.5],"counts":[2,1,0],"sum":0.6,"count":3}}`,
+		},
+		{
+			name:         "inconsistent histogram",
+			payload:      `{"id":"latency","type":"histogram","histogram":{"bounds":[0.1,0.5],"counts":[2,1],"sum":0.6,"count":3}}`,
+			wantStatus:   http.StatusBadRequest,
+			wantResponse: `{"error":"invalid histogram: expected 3 counts, got 2"}`,
+		},
+		{
+			name:         "inconsistent sketch",
+			payload:      `{"id":"latency","type":"summary","sketch":{"positive":{"counts":[1],"offset":0},"negative":{"offset":0},"alpha":0.01,"sum":1,"min":1,"max":1,"zero":0,"count":2}}`,
+			wantStatus:   http.StatusBadRequest,
+			wantResponse: `{"error":"invalid sketch: count 2 does not match bins total 1"}`,
+		},
 		{
 			name:         "invalid type",
 			payload:      `{"id":"test","type":"invalid","value":1}`,
@@ -596,3 +892,518 @@ func TestMetricsHandler_PingHandler(t *testing.T) {
 		})
 	}
 }
+
+func TestMetricsHandler_QueryRangeHandler(t *testing.T) {
+	ts := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name         string
+		url          string
+		wantStatus   int
+		wantResponse string
+	}{
+		{
+			name:         "existing gauge",
+			url:          "/api/v1/query_range?id=HeapAlloc&type=gauge&from=1735732800&to=1735736400&step=1m",
+			wantStatus:   http.StatusOK,
+			wantResponse: `{"id":"HeapAlloc","type":"gauge","func":"","step":"1m0s","points":[{"timestamp":"2025-01-01T12:00:00Z","value":42}]}`,
+		},
+		{
+			name:         "missing metric",
+			url:          "/api/v1/query_range?id=unknown&type=gauge",
+			wantStatus:   http.StatusNotFound,
+			wantResponse: `{"error":"Metric not found"}`,
+		},
+		{
+			name:         "missing id",
+			url:          "/api/v1/query_range?type=gauge",
+			wantStatus:   http.StatusBadRequest,
+			wantResponse: `{"error":"missing id"}`,
+		},
+		{
+			name:         "invalid step",
+			url:          "/api/v1/query_range?id=HeapAlloc&type=gauge&step=abc",
+			wantStatus:   http.StatusBadRequest,
+			wantResponse: `{"error":"invalid step"}`,
+		},
+		{
+			name:         "selector with group by",
+			url:          "/api/v1/query_range?match=FreeMemory%7Benv%3D~%22prod.*%22%7D&type=gauge&by=env&step=1m",
+			wantStatus:   http.StatusOK,
+			wantResponse: `{"match":"FreeMemory{env=~\"prod.*\"}","type":"gauge","func":"","step":"1m0s","by":["env"],"series":[]}`,
+		},
+		{
+			name:         "invalid selector",
+			url:          "/api/v1/query_range?match=FreeMemory%7Benv%7D&type=gauge",
+			wantStatus:   http.StatusBadRequest,
+			wantResponse: `{"error":"Invalid selector"}`,
+		},
+		{
+			name:         "invalid type",
+			url:          "/api/v1/query_range?id=HeapAlloc&type=invalid",
+			wantStatus:   http.StatusBadRequest,
+			wantResponse: `{"error":"Invalid metric type"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := NewMockMetricsService()
+			mockService.history["HeapAlloc"] = []models.Sample{{Timestamp: ts, Value: 42}}
+			handler := NewMetricsHandler(mockService, "", "")
+
+			req := httptest.NewRequest(http.MethodGet, tt.url, nil)
+			w := httptest.NewRecorder()
+
+			handler.QueryRangeHandler(w, req)
+
+			resp := w.Result()
+			defer resp.Body.Close()
+
+			assert.Equal(t, tt.wantStatus, resp.StatusCode)
+
+			body, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+			assert.JSONEq(t, tt.wantResponse, string(body))
+		})
+	}
+}
+
+func TestMetricsHandler_AggregateHandler(t *testing.T) {
+	tests := []struct {
+		name         string
+		url          string
+		wantStatus   int
+		wantResponse string
+	}{
+		{
+			name:         "max of gauge",
+			url:          "/api/v1/query?id=HeapAlloc&type=gauge&from=2025-01-01T11:00:00Z&to=2025-01-01T13:00:00Z&func=max",
+			wantStatus:   http.StatusOK,
+			wantResponse: `{"id":"HeapAlloc","type":"gauge","func":"max","from":"2025-01-01T11:00:00Z","to":"2025-01-01T13:00:00Z","value":42}`,
+		},
+		{
+			name:         "rate of gauge",
+			url:          "/api/v1/query?id=HeapAlloc&type=gauge&func=rate",
+			wantStatus:   http.StatusBadRequest,
+			wantResponse: `{"error":"Invalid query"}`,
+		},
+		{
+			name:         "invalid from",
+			url:          "/api/v1/query?id=HeapAlloc&type=gauge&from=yesterday",
+			wantStatus:   http.StatusBadRequest,
+			wantResponse: `{"error":"invalid from"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := NewMockMetricsService()
+			mockService.history["HeapAlloc"] = []models.Sample{
+				{Timestamp: time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC), Value: 42},
+			}
+			handler := NewMetricsHandler(mockService, "", "")
+
+			req := httptest.NewRequest(http.MethodGet, tt.url, nil)
+			w := httptest.NewRecorder()
+
+			handler.AggregateHandler(w, req)
+
+			resp := w.Result()
+			defer resp.Body.Close()
+
+			assert.Equal(t, tt.wantStatus, resp.StatusCode)
+
+			body, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+			assert.JSONEq(t, tt.wantResponse, string(body))
+		})
+	}
+}
+
+func TestMetricsHandler_PrometheusHandler(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	mockService := NewMockMetricsService()
+	mockService.UpdateGauge(ctx, "HeapAlloc", 1.5)
+	mockService.UpdateGauge(ctx, "cpu.usage-1", 20)
+	// Совпадает с cpu.usage-1 после замены символов и не выводится.
+	mockService.UpdateGauge(ctx, "cpu_usage_1", 99)
+	mockService.UpdateCounter(ctx, "cpu:usage:1", 3)
+	mockService.UpdateCounter(ctx, "PollCount", 7)
+	mockService.UpdateGauge(ctx, models.SeriesKey("disk_free", map[string]string{"mount": "/var", "device": "sda\"1"}), 10)
+	mockService.UpdateGauge(ctx, models.SeriesKey("disk_free", map[string]string{"mount": "/"}), 5)
+	mockService.histograms[models.SeriesKey("latency", map[string]string{"path": "/"})] = models.HistogramValue{
+		Bounds: []float64{0.1, 0.5},
+		Counts: []uint64{2, 1, 1},
+		Sum:    1.4,
+		Count:  4,
+	}
+	sketch := models.NewSketch(models.DefaultSketchAlpha)
+	sketch.Add(2)
+	sketch.Add(2)
+	mockService.sketches["rpc_time"] = sketch
+	mockService.sets["visitors"] = models.NewSetOf("alice", "bob")
+	mockService.metadata["HeapAlloc"] = models.Metadata{ID: "HeapAlloc", Help: "Bytes of allocated heap objects\nsee runtime.MemStats"}
+	handler := NewMetricsHandler(mockService, "", "")
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	w := httptest.NewRecorder()
+
+	handler.PrometheusHandler(w, req)
+
+	resp := w.Result()
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, prometheusContentType, resp.Header.Get("Content-Type"))
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, `# HELP HeapAlloc Bytes of allocated heap objects\nsee runtime.MemStats
+# TYPE HeapAlloc gauge
+HeapAlloc 1.5
+# TYPE PollCount counter
+PollCount 7
+# TYPE cpu_usage_1 gauge
+cpu_usage_1 20
+# TYPE disk_free gauge
+disk_free{device="sda\"1",mount="/var"} 10
+disk_free{mount="/"} 5
+# TYPE latency histogram
+latency_bucket{le="0.1",path="/"} 2
+latency_bucket{le="0.5",path="/"} 3
+latency_bucket{le="+Inf",path="/"} 4
+latency_sum{path="/"} 1.4
+latency_count{path="/"} 4
+# TYPE rpc_time summary
+rpc_time{quantile="0.5"} 2
+rpc_time{quantile="0.95"} 2
+rpc_time{quantile="0.99"} 2
+rpc_time_sum 4
+rpc_time_count 2
+# TYPE visitors gauge
+visitors 2
+`, string(body))
+}
+
+func TestMetricsHandler_SeriesHandler(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	mockService := NewMockMetricsService()
+	mockService.UpdateGauge(ctx, models.SeriesKey("HeapAlloc", map[string]string{"host": "web-1", "env": "prod"}), 1)
+	mockService.UpdateGauge(ctx, models.SeriesKey("HeapAlloc", map[string]string{"host": "web-2", "env": "staging"}), 2)
+	mockService.UpdateGauge(ctx, "HeapAlloc", 3)
+
+	tests := []struct {
+		name         string
+		url          string
+		wantStatus   int
+		wantResponse string
+	}{
+		{
+			name:         "regexp matcher",
+			url:          "/api/v1/series?type=gauge&match=" + url.QueryEscape(`HeapAlloc{env=~"prod.*"}`),
+			wantStatus:   http.StatusOK,
+			wantResponse: `[{"value":1,"labels":{"env":"prod","host":"web-1"},"id":"HeapAlloc","type":"gauge"}]`,
+		},
+		{
+			name:         "no matches",
+			url:          "/api/v1/series?match=" + url.QueryEscape(`HeapAlloc{host="web-3"}`),
+			wantStatus:   http.StatusOK,
+			wantResponse: `[]`,
+		},
+		{
+			name:         "missing match",
+			url:          "/api/v1/series",
+			wantStatus:   http.StatusBadRequest,
+			wantResponse: `{"error":"missing match"}`,
+		},
+		{
+			name:         "invalid selector",
+			url:          "/api/v1/series?match=" + url.QueryEscape(`HeapAlloc{host=web-1}`),
+			wantStatus:   http.StatusBadRequest,
+			wantResponse: `{"error":"Invalid selector"}`,
+		},
+	}
+
+	handler := NewMetricsHandler(mockService, "", "")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.url, nil)
+			w := httptest.NewRecorder()
+
+			handler.SeriesHandler(w, req)
+
+			resp := w.Result()
+			defer resp.Body.Close()
+
+			assert.Equal(t, tt.wantStatus, resp.StatusCode)
+
+			body, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+			assert.JSONEq(t, tt.wantResponse, string(body))
+		})
+	}
+}
+
+func TestMetricsHandler_MetadataHandler(t *testing.T) {
+	tests := []struct {
+		name         string
+		method       string
+		url          string
+		payload      string
+		wantStatus   int
+		wantResponse string
+	}{
+		{
+			name:         "put metadata",
+			method:       http.MethodPut,
+			url:          "/api/v1/metadata/OtherSys",
+			payload:      `{"unit":"bytes","help":"Memory in misc runtime allocations","owner":"runtime-team","type":"gauge"}`,
+			wantStatus:   http.StatusOK,
+			wantResponse: `{"id":"OtherSys","unit":"bytes","help":"Memory in misc runtime allocations","owner":"runtime-team","type":"gauge"}`,
+		},
+		{
+			name:         "get metadata",
+			method:       http.MethodGet,
+			url:          "/api/v1/metadata/OtherSys",
+			wantStatus:   http.StatusOK,
+			wantResponse: `{"id":"OtherSys","unit":"bytes","help":"Memory in misc runtime allocations","owner":"runtime-team","type":"gauge"}`,
+		},
+		{
+			name:         "unknown metadata",
+			method:       http.MethodGet,
+			url:          "/api/v1/metadata/Unknown",
+			wantStatus:   http.StatusNotFound,
+			wantResponse: `{"error":"Metadata not found"}`,
+		},
+		{
+			name:         "unknown type",
+			method:       http.MethodPut,
+			url:          "/api/v1/metadata/OtherSys",
+			payload:      `{"type":"timer"}`,
+			wantStatus:   http.StatusBadRequest,
+			wantResponse: `{"error":"invalid metadata: unknown type \"timer\""}`,
+		},
+		{
+			name:         "invalid json",
+			method:       http.MethodPut,
+			url:          "/api/v1/metadata/OtherSys",
+			payload:      `{`,
+			wantStatus:   http.StatusBadRequest,
+			wantResponse: `{"error":"Invalid JSON"}`,
+		},
+		{
+			name:         "wrong method",
+			method:       http.MethodPost,
+			url:          "/api/v1/metadata/OtherSys",
+			wantStatus:   http.StatusMethodNotAllowed,
+			wantResponse: `{"error":"Method not allowed"}`,
+		},
+	}
+
+	handler := NewMetricsHandler(NewMockMetricsService(), "", "")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.url, strings.NewReader(tt.payload))
+			w := httptest.NewRecorder()
+
+			handler.MetadataHandler(w, req)
+
+			resp := w.Result()
+			defer resp.Body.Close()
+
+			assert.Equal(t, tt.wantStatus, resp.StatusCode)
+
+			body, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+			assert.JSONEq(t, tt.wantResponse, string(body))
+		})
+	}
+}
+
+func TestMetricsHandler_RetypeHandler(t *testing.T) {
+	mockService := NewMockMetricsService()
+	mockService.metadata["OtherSys"] = models.Metadata{ID: "OtherSys", Unit: "bytes", Type: models.Gauge}
+
+	tests := []struct {
+		name         string
+		method       string
+		url          string
+		payload      string
+		wantStatus   int
+		wantResponse string
+	}{
+		{
+			name:         "retype keeps metadata",
+			method:       http.MethodPut,
+			url:          "/api/v1/admin/retype/OtherSys",
+			payload:      `{"type":"counter"}`,
+			wantStatus:   http.StatusOK,
+			wantResponse: `{"id":"OtherSys","unit":"bytes","type":"counter"}`,
+		},
+		{
+			name:         "unknown type",
+			method:       http.MethodPut,
+			url:          "/api/v1/admin/retype/OtherSys",
+			payload:      `{"type":"timer"}`,
+			wantStatus:   http.StatusBadRequest,
+			wantResponse: `{"error":"invalid metadata: unknown type \"timer\""}`,
+		},
+		{
+			name:         "wrong method",
+			method:       http.MethodGet,
+			url:          "/api/v1/admin/retype/OtherSys",
+			wantStatus:   http.StatusMethodNotAllowed,
+			wantResponse: `{"error":"Method not allowed"}`,
+		},
+	}
+
+	handler := NewMetricsHandler(mockService, "", "")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.url, strings.NewReader(tt.payload))
+			w := httptest.NewRecorder()
+
+			handler.RetypeHandler(w, req)
+
+			resp := w.Result()
+			defer resp.Body.Close()
+
+			assert.Equal(t, tt.wantStatus, resp.StatusCode)
+
+			body, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+			assert.JSONEq(t, tt.wantResponse, string(body))
+		})
+	}
+}
+
+func TestMetricsHandler_DeleteValueHandler(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	tests := []struct {
+		name     string
+		method   string
+		url      string
+		wantCode int
+		wantBody string
+	}{
+		{name: "delete gauge", method: http.MethodDelete, url: "/value/gauge/OtherSys", wantCode: http.StatusOK, wantBody: "Metric deleted\n"},
+		{name: "delete missing counter", method: http.MethodDelete, url: "/value/counter/OtherSys", wantCode: http.StatusNotFound, wantBody: "metric not found\n"},
+		{name: "invalid type", method: http.MethodDelete, url: "/value/invalid/OtherSys", wantCode: http.StatusBadRequest, wantBody: "invalid metric type\n"},
+		{name: "wrong method", method: http.MethodPost, url: "/value/gauge/OtherSys", wantCode: http.StatusMethodNotAllowed, wantBody: "Method not allowed\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := NewMockMetricsService()
+			mockService.UpdateGauge(ctx, "OtherSys", 1)
+			handler := NewMetricsHandler(mockService, "", "")
+
+			req := httptest.NewRequest(tt.method, tt.url, nil)
+			w := httptest.NewRecorder()
+
+			handler.DeleteValueHandler(w, req)
+
+			resp := w.Result()
+			defer resp.Body.Close()
+
+			assert.Equal(t, tt.wantCode, resp.StatusCode)
+			body, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantBody, string(body))
+		})
+	}
+}
+
+func TestMetricsHandler_DeleteSeriesHandler(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	mockService := NewMockMetricsService()
+	mockService.UpdateGauge(ctx, "legacy_free", 1)
+	mockService.UpdateGauge(ctx, "legacy_used", 2)
+	mockService.UpdateGauge(ctx, "HeapAlloc", 3)
+	handler := NewMetricsHandler(mockService, "", "")
+
+	req := httptest.NewRequest(http.MethodDelete, "/api/v1/series?prefix=legacy_", nil)
+	w := httptest.NewRecorder()
+	handler.DeleteSeriesHandler(w, req)
+	resp := w.Result()
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"deleted":2}`, string(body))
+	assert.Contains(t, mockService.gaugeValues, "HeapAlloc")
+
+	req = httptest.NewRequest(http.MethodDelete, "/api/v1/series", nil)
+	w = httptest.NewRecorder()
+	handler.DeleteSeriesHandler(w, req)
+	resp2 := w.Result()
+	defer resp2.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp2.StatusCode)
+}
+
+func TestMetricsHandler_UpdatesHandlerIdempotency(t *testing.T) {
+	mockService := NewMockMetricsService()
+	handler := NewMetricsHandler(mockService, "", "")
+	body := `[{"id": "PollCount", "type": "counter", "delta": 5}]`
+
+	send := func(key string) *http.Response {
+		req := httptest.NewRequest(http.MethodPost, "/updates/", strings.NewReader(body))
+		if key != "" {
+			req.Header.Set("Idempotency-Key", key)
+		}
+		w := httptest.NewRecorder()
+		handler.UpdatesHandler(w, req)
+		return w.Result()
+	}
+
+	resp := send("batch-1")
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Empty(t, resp.Header.Get("Idempotent-Replayed"))
+
+	replay := send("batch-1")
+	defer replay.Body.Close()
+	assert.Equal(t, http.StatusOK, replay.StatusCode)
+	assert.Equal(t, "true", replay.Header.Get("Idempotent-Replayed"))
+	assert.Equal(t, int64(5), mockService.counterValues["PollCount"])
+
+	other := send("batch-2")
+	defer other.Body.Close()
+	assert.Equal(t, int64(10), mockService.counterValues["PollCount"])
+
+	tooLong := send(strings.Repeat("k", maxIdempotencyKeyLen+1))
+	defer tooLong.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, tooLong.StatusCode)
+}
+
+func TestMetricsHandler_UpdatesHandlerPartial(t *testing.T) {
+	mockService := NewMockMetricsService()
+	handler := NewMetricsHandler(mockService, "", "")
+	body := `[
+		{"id": "PollCount", "type": "counter", "delta": 5},
+		{"id": "Alloc", "type": "gauge"},
+		{"id": "Requests", "type": "counter", "delta": 2}
+	]`
+
+	req := httptest.NewRequest(http.MethodPost, "/updates/?partial=true", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	handler.UpdatesHandler(w, req)
+	resp := w.Result()
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	respBody, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"accepted": 2, "rejected": [{"index": 1, "id": "Alloc", "reason": "missing value"}]}`, string(respBody))
+	assert.Equal(t, int64(5), mockService.counterValues["PollCount"])
+	assert.Equal(t, int64(2), mockService.counterValues["Requests"])
+}
@@ -0,0 +1,159 @@
+// Package api -  описание хендлеров и эндпоинтов.
+package api
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"time"
+
+	models "github.com/chestorix/monmetrics/internal/metrics"
+	"github.com/chestorix/monmetrics/internal/metrics/ingest"
+)
+
+// Типы содержимого OTLP/HTTP.
+const (
+	otlpProtoContentType = "application/x-protobuf"
+	otlpJSONContentType  = "application/json"
+)
+
+// RemoteWriteHandler обрабатывает POST запрос Prometheus remote_write.
+// Тело запроса - сжатое snappy protobuf сообщение WriteRequest.
+// Значения сохраняются с именем из метки __name__: ряды счетчиков - как counter с накопленным итогом,
+// остальные - как gauge.
+// Возможные коды ответа:
+// - 204: метрики приняты
+// - 400: неверный формат данных
+// - 405: метод не разрешен
+// - 409: в режиме контроля типов метрика зарегистрирована с другим типом
+// - 500: внутренняя ошибка сервера
+func (h *MetricsHandler) RemoteWriteHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), time.Second*5)
+	defer cancel()
+	if r.Method != http.MethodPost {
+		renderError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		renderError(w, "Failed to read request body", http.StatusBadRequest)
+		return
+	}
+
+	metrics, err := ingest.DecodeRemoteWrite(body)
+	if err != nil {
+		renderError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	h.storeIngested(ctx, w, metrics)
+}
+
+// storeIngested сохраняет метрики, полученные в стороннем формате, и отправляет ответ.
+func (h *MetricsHandler) storeIngested(ctx context.Context, w http.ResponseWriter, metrics []models.Metrics) {
+	if len(metrics) > 0 {
+		if err := h.service.UpdateMetricsBatch(ctx, metrics); err != nil {
+			renderError(w, fmt.Sprintf("Failed to update metrics: %v", err), updateErrorStatus(err))
+			return
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// InfluxWriteHandler обрабатывает POST запрос с метриками в формате InfluxDB line protocol.
+// Каждое числовое поле сохраняется как gauge с именем <measurement>_<field>.
+// Параметр precision задает единицы времени меток (ns по умолчанию).
+// Возможные коды ответа:
+// - 204: метрики приняты
+// - 400: неверный формат данных
+// - 405: метод не разрешен
+// - 409: в режиме контроля типов метрика зарегистрирована с другим типом
+// - 500: внутренняя ошибка сервера
+func (h *MetricsHandler) InfluxWriteHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), time.Second*5)
+	defer cancel()
+	if r.Method != http.MethodPost {
+		renderError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		renderError(w, "Failed to read request body", http.StatusBadRequest)
+		return
+	}
+
+	metrics, err := ingest.ParseLineProtocol(body, r.URL.Query().Get("precision"))
+	if err != nil {
+		renderError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	h.storeIngested(ctx, w, metrics)
+}
+
+// OTLPHandler обрабатывает POST запрос экспорта метрик OpenTelemetry (OTLP/HTTP).
+// Поддерживаются тела в формате protobuf (application/x-protobuf) и JSON (application/json),
+// ответ ExportMetricsServiceResponse возвращается в том же формате.
+// Точки неподдерживаемых типов учитываются в partial_success.
+// Возможные коды ответа:
+// - 200: метрики приняты
+// - 400: неверный формат данных
+// - 405: метод не разрешен
+// - 409: в режиме контроля типов метрика зарегистрирована с другим типом
+// - 415: неподдерживаемый Content-Type
+// - 500: внутренняя ошибка сервера
+func (h *MetricsHandler) OTLPHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), time.Second*5)
+	defer cancel()
+	if r.Method != http.MethodPost {
+		renderError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var isJSON bool
+	switch mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType {
+	case otlpJSONContentType:
+		isJSON = true
+	case otlpProtoContentType:
+	default:
+		renderError(w, "Unsupported content type", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		renderError(w, "Failed to read request body", http.StatusBadRequest)
+		return
+	}
+
+	req, err := ingest.DecodeOTLP(body, isJSON)
+	if err != nil {
+		renderError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	metrics, rejected := ingest.ConvertOTLP(req)
+	if len(metrics) > 0 {
+		if err := h.service.UpdateMetricsBatch(ctx, metrics); err != nil {
+			renderError(w, fmt.Sprintf("Failed to update metrics: %v", err), updateErrorStatus(err))
+			return
+		}
+	}
+
+	respBody, err := ingest.EncodeOTLPResponse(rejected, "only gauge and sum data points are supported", isJSON)
+	if err != nil {
+		renderError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if isJSON {
+		w.Header().Set("Content-Type", otlpJSONContentType)
+	} else {
+		w.Header().Set("Content-Type", otlpProtoContentType)
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(respBody)
+}
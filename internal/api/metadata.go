@@ -0,0 +1,137 @@
+// Package api -  описание хендлеров и эндпоинтов.
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	models "github.com/chestorix/monmetrics/internal/metrics"
+)
+
+// MetadataHandler обрабатывает запросы к метаданным метрики.
+// Формат пути: /api/v1/metadata/<metricName>
+// GET возвращает метаданные, PUT сохраняет их, заменяя ранее сохраненные.
+// Формат JSON: {"unit": "bytes", "help": "text", "owner": "team", "type": "gauge|counter|histogram|summary|set"}
+// Имя метрики берется из пути, поле id в теле игнорируется.
+// Возможные коды ответа:
+// - 200: успешное получение или сохранение
+// - 400: неверный JSON или неизвестный тип
+// - 404: метаданные не заданы
+// - 405: метод не разрешен
+// - 409: в режиме контроля типов указан тип, отличный от зарегистрированного
+// - 500: внутренняя ошибка сервера
+func (h *MetricsHandler) MetadataHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), time.Second*2)
+	defer cancel()
+	w.Header().Set("Content-Type", "application/json")
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	name := parts[len(parts)-1]
+	if len(parts) < 4 || name == "" {
+		renderError(w, "missing id", http.StatusNotFound)
+		return
+	}
+
+	var meta models.Metadata
+	var err error
+	switch r.Method {
+	case http.MethodGet:
+		meta, err = h.service.GetMetadata(ctx, name)
+	case http.MethodPut:
+		if err := json.NewDecoder(r.Body).Decode(&meta); err != nil {
+			renderError(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		meta.ID = name
+		err = h.service.SetMetadata(ctx, meta)
+	default:
+		renderError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err != nil {
+		renderMetadataError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(meta); err != nil {
+		renderError(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+// RetypeHandler обрабатывает PUT запрос на смену зарегистрированного типа метрики.
+// Формат пути: /api/v1/admin/retype/<metricName>
+// Формат JSON: {"type": "gauge|counter|histogram|summary|set"}
+// После смены типа обновления метрики принимаются только с новым типом.
+// Также проверяет хеш при наличии ключа.
+// Возможные коды ответа:
+// - 200: тип изменен, в ответе возвращаются метаданные метрики
+// - 400: неверный запрос, неизвестный тип или неверный хеш
+// - 405: метод не разрешен
+// - 500: внутренняя ошибка сервера
+func (h *MetricsHandler) RetypeHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), time.Second*2)
+	defer cancel()
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method != http.MethodPut {
+		renderError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	name := parts[len(parts)-1]
+	if len(parts) < 5 || name == "" {
+		renderError(w, "missing id", http.StatusBadRequest)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		renderError(w, "Failed to read request body", http.StatusBadRequest)
+		return
+	}
+	if h.key != "" && r.Header.Get("HashSHA256") != "" {
+		if ok, _ := h.checkHash(r, body); !ok {
+			renderError(w, "Invalid hash", http.StatusBadRequest)
+			return
+		}
+	}
+
+	var req struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		renderError(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	meta, err := h.service.Retype(ctx, name, req.Type)
+	if err != nil {
+		renderMetadataError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(meta); err != nil {
+		renderError(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+// renderMetadataError отправляет ошибку работы с метаданными с соответствующим статус кодом.
+func renderMetadataError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, models.ErrMetricNotFound):
+		renderError(w, "Metadata not found", http.StatusNotFound)
+	case errors.Is(err, models.ErrInvalidMetadata):
+		renderError(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, models.ErrTypeConflict):
+		renderError(w, err.Error(), http.StatusConflict)
+	default:
+		renderError(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
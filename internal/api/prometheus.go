@@ -0,0 +1,222 @@
+// Package api -  описание хендлеров и эндпоинтов.
+package api
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	models "github.com/chestorix/monmetrics/internal/metrics"
+)
+
+// prometheusContentType - тип содержимого текстового формата Prometheus.
+const prometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// PrometheusHandler обрабатывает GET запрос на получение всех метрик в текстовом формате Prometheus.
+// Для каждой метрики выводится строка # TYPE (gauge, counter, histogram или summary) и текущие значения всех ее рядов с метками.
+// Множества выводятся как gauge с оценкой количества уникальных элементов.
+// Если для метрики задан текст справки в метаданных, перед # TYPE выводится строка # HELP.
+// Имена метрик приводятся к допустимому в Prometheus виду так же, как имена меток.
+// Возможные коды ответа:
+// - 200: успешное получение метрик
+// - 405: метод не разрешен
+// - 500: внутренняя ошибка сервера
+func (h *MetricsHandler) PrometheusHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), time.Second*2)
+	defer cancel()
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	metrics, err := h.service.GetAll(ctx)
+	if err != nil {
+		http.Error(w, "Failed to get metrics", http.StatusInternalServerError)
+		return
+	}
+	metadata, err := h.service.GetAllMetadata(ctx)
+	if err != nil {
+		http.Error(w, "Failed to get metadata", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", prometheusContentType)
+	w.WriteHeader(http.StatusOK)
+	writePrometheus(w, metrics, metadata)
+}
+
+// writePrometheus записывает метрики в текстовом формате Prometheus, отсортированными по имени.
+// Если имя уже занято метрикой другого типа, метрика пропускается,
+// так как формат не допускает несколько типов у одного имени.
+// Также пропускаются метрики, имя которых после замены недопустимых символов совпало с именем
+// другой метрики (например, cpu.load и cpu_load): иначе их ряды смешались бы под одним # TYPE.
+// Имя остается за метрикой, исходное имя которой меньше.
+func writePrometheus(w io.Writer, metrics []models.Metric, metadata map[string]models.Metadata) {
+	type promMetric struct {
+		name   string
+		metric models.Metric
+	}
+	sorted := make([]promMetric, len(metrics))
+	for i, metric := range metrics {
+		sorted[i] = promMetric{name: models.SanitizeLabelName(metric.Name), metric: metric}
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if a.name != b.name {
+			return a.name < b.name
+		}
+		if a.metric.Name != b.metric.Name {
+			return a.metric.Name < b.metric.Name
+		}
+		if a.metric.Type != b.metric.Type {
+			return a.metric.Type > b.metric.Type
+		}
+		return models.SeriesKey("", a.metric.Labels) < models.SeriesKey("", b.metric.Labels)
+	})
+
+	// owners - исходное имя и тип метрики, за которой закреплено имя в выводе.
+	type owner struct {
+		source string
+		mType  string
+	}
+	owners := make(map[string]owner, len(sorted))
+	writeType := func(name, source, mType string) {
+		if _, ok := owners[name]; !ok {
+			owners[name] = owner{source: source, mType: mType}
+			if help := metadata[source].Help; help != "" {
+				fmt.Fprintf(w, "# HELP %s %s\n", name, prometheusHelp(help))
+			}
+			fmt.Fprintf(w, "# TYPE %s %s\n", name, mType)
+		}
+	}
+	for _, entry := range sorted {
+		name, metric := entry.name, entry.metric
+		mType := metric.Type
+		if set, ok := metric.Value.(models.SetValue); ok {
+			mType = models.Gauge
+			metric.Value = int64(set.Estimate())
+		}
+		if o, ok := owners[name]; ok && (o.mType != mType || o.source != metric.Name) {
+			continue
+		}
+		if hist, ok := metric.Value.(models.HistogramValue); ok {
+			writeType(name, metric.Name, mType)
+			writePrometheusHistogram(w, name, metric.Labels, hist)
+			continue
+		}
+		if sketch, ok := metric.Value.(models.SketchValue); ok {
+			writeType(name, metric.Name, mType)
+			writePrometheusSummary(w, name, metric.Labels, sketch)
+			continue
+		}
+		value, ok := prometheusValue(metric.Value)
+		if !ok {
+			continue
+		}
+		writeType(name, metric.Name, mType)
+		fmt.Fprintf(w, "%s%s %s\n", name, prometheusLabels(metric.Labels), value)
+	}
+}
+
+// writePrometheusHistogram записывает гистограмму в виде рядов <name>_bucket с накопительными
+// количествами и меткой le, а также <name>_sum и <name>_count.
+func writePrometheusHistogram(w io.Writer, name string, labels map[string]string, hist models.HistogramValue) {
+	bucketLabels := make(map[string]string, len(labels)+1)
+	for label, value := range labels {
+		bucketLabels[label] = value
+	}
+	for i, count := range hist.Cumulative() {
+		le := "+Inf"
+		if i < len(hist.Bounds) {
+			le, _ = prometheusValue(hist.Bounds[i])
+		}
+		bucketLabels["le"] = le
+		fmt.Fprintf(w, "%s_bucket%s %d\n", name, prometheusLabels(bucketLabels), count)
+	}
+	sum, _ := prometheusValue(hist.Sum)
+	fmt.Fprintf(w, "%s_sum%s %s\n", name, prometheusLabels(labels), sum)
+	fmt.Fprintf(w, "%s_count%s %d\n", name, prometheusLabels(labels), hist.Count)
+}
+
+// summaryQuantiles - квантили, которые выводятся для summary.
+var summaryQuantiles = []float64{0.5, 0.95, 0.99}
+
+// writePrometheusSummary записывает скетч в виде рядов <name> с меткой quantile,
+// а также <name>_sum и <name>_count. Квантили пустого скетча не выводятся.
+func writePrometheusSummary(w io.Writer, name string, labels map[string]string, sketch models.SketchValue) {
+	quantileLabels := make(map[string]string, len(labels)+1)
+	for label, value := range labels {
+		quantileLabels[label] = value
+	}
+	for _, q := range summaryQuantiles {
+		value, err := sketch.Quantile(q)
+		if err != nil {
+			break
+		}
+		quantileLabels["quantile"], _ = prometheusValue(q)
+		formatted, _ := prometheusValue(value)
+		fmt.Fprintf(w, "%s%s %s\n", name, prometheusLabels(quantileLabels), formatted)
+	}
+	sum, _ := prometheusValue(sketch.Sum)
+	fmt.Fprintf(w, "%s_sum%s %s\n", name, prometheusLabels(labels), sum)
+	fmt.Fprintf(w, "%s_count%s %d\n", name, prometheusLabels(labels), sketch.Count)
+}
+
+// prometheusHelp экранирует обратную косую черту и перевод строки в тексте справки.
+func prometheusHelp(help string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help)
+}
+
+// prometheusLabels форматирует метки в виде {label="value",...} с экранированием по правилам Prometheus.
+func prometheusLabels(labels map[string]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	names := make([]string, 0, len(labels))
+	for label := range labels {
+		names = append(names, label)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, label := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(models.SanitizeLabelName(label))
+		b.WriteString(`="`)
+		b.WriteString(labelValueReplacer.Replace(labels[label]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+var labelValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// prometheusValue форматирует значение метрики.
+func prometheusValue(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case float64:
+		switch {
+		case math.IsNaN(v):
+			return "NaN", true
+		case math.IsInf(v, 1):
+			return "+Inf", true
+		case math.IsInf(v, -1):
+			return "-Inf", true
+		}
+		return strconv.FormatFloat(v, 'g', -1, 64), true
+	case int64:
+		return strconv.FormatInt(v, 10), true
+	default:
+		return "", false
+	}
+}
@@ -0,0 +1,267 @@
+// Package api -  описание хендлеров и эндпоинтов.
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	models "github.com/chestorix/monmetrics/internal/metrics"
+)
+
+const (
+	defaultQueryRange = time.Hour
+	defaultQueryStep  = 30 * time.Second
+)
+
+// QueryRangeHandler обрабатывает GET запрос на получение истории метрики за период.
+// Формат запроса: /api/v1/query_range?id=<metricName>&type=<metricType>&from=<time>&to=<time>&step=<duration>&func=<func>
+// Поддерживаемые функции: last (по умолчанию), avg, min, max, sum, count, p50, p95, p99,
+// а для счетчиков и множеств также rate (прирост в секунду) и increase (прирост за интервал).
+// Время задается в формате RFC3339 или как unix timestamp в секундах.
+// По умолчанию to - текущее время, from - на час раньше to, step - 30s.
+// Вместо id можно передать селектор match=<name{label="value",label=~"re"}>, тогда возвращается история
+// всех подходящих рядов. Параметр by=<label,...> группирует ряды по меткам, agg=<sum|avg|min|max|count>
+// задает функцию объединения рядов группы (по умолчанию sum).
+// Возможные коды ответа:
+// - 200: успешное получение истории
+// - 400: неверные параметры запроса
+// - 404: метрика не найдена
+// - 405: метод не разрешен
+// - 500: внутренняя ошибка сервера
+func (h *MetricsHandler) QueryRangeHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), time.Second*5)
+	defer cancel()
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method != http.MethodGet {
+		renderError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query, err := parseRangeQuery(r.URL.Query())
+	if err != nil {
+		renderError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var result interface{}
+	if r.URL.Query().Has("match") {
+		result, err = h.service.QueryRangeSeries(ctx, query)
+	} else {
+		result, err = h.service.QueryRange(ctx, query)
+	}
+	if err != nil {
+		renderQueryError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		renderError(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+// AggregateHandler обрабатывает GET запрос на вычисление функции агрегации над историей метрики.
+// Формат запроса: /api/v1/query?id=<metricName>&type=<metricType>&from=<time>&to=<time>&func=<func>
+// Параметры и функции совпадают с QueryRangeHandler, step не используется.
+// С селектором match результат вычисляется для каждого ряда или группы рядов.
+// Возможные коды ответа:
+// - 200: успешное вычисление
+// - 400: неверные параметры запроса
+// - 404: метрика не найдена или значений недостаточно
+// - 405: метод не разрешен
+// - 500: внутренняя ошибка сервера
+func (h *MetricsHandler) AggregateHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), time.Second*5)
+	defer cancel()
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method != http.MethodGet {
+		renderError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query, err := parseRangeQuery(r.URL.Query())
+	if err != nil {
+		renderError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var result interface{}
+	if r.URL.Query().Has("match") {
+		result, err = h.service.AggregateSeries(ctx, query)
+	} else {
+		result, err = h.service.Aggregate(ctx, query)
+	}
+	if err != nil {
+		renderQueryError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		renderError(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+// SeriesHandler обрабатывает GET запрос на получение текущих значений рядов, подходящих под селектор.
+// Формат запроса: /api/v1/series?match=<name{label="value",label=~"re"}>&type=<metricType>
+// Тип необязателен, без него возвращаются метрики всех типов.
+// Возможные коды ответа:
+// - 200: успешное получение (в том числе пустой список)
+// - 400: неверный селектор или тип метрики
+// - 405: метод не разрешен
+// - 500: внутренняя ошибка сервера
+func (h *MetricsHandler) SeriesHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), time.Second*5)
+	defer cancel()
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method != http.MethodGet {
+		renderError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	match := r.URL.Query().Get("match")
+	if match == "" {
+		renderError(w, "missing match", http.StatusBadRequest)
+		return
+	}
+
+	metrics, err := h.service.Select(ctx, r.URL.Query().Get("type"), match)
+	if err != nil {
+		renderQueryError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(metrics); err != nil {
+		renderError(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+// DeleteSeriesHandler обрабатывает DELETE запрос на удаление всех рядов, подходящих под условия.
+// Формат запроса: /api/v1/series?match=<name{label="value"}>&prefix=<namePrefix>&type=<metricType>
+// Ряд удаляется, если его имя начинается с prefix и он подходит под селектор match.
+// Должен быть задан хотя бы один из параметров match и prefix, тип необязателен.
+// В ответе возвращается количество удаленных рядов: {"deleted": <n>}.
+// Возможные коды ответа:
+// - 200: успешное удаление (в том числе если ничего не удалено)
+// - 400: не заданы условия, неверный селектор или тип метрики
+// - 405: метод не разрешен
+// - 500: внутренняя ошибка сервера
+func (h *MetricsHandler) DeleteSeriesHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), time.Second*5)
+	defer cancel()
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method != http.MethodDelete {
+		renderError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	values := r.URL.Query()
+	match, prefix := values.Get("match"), values.Get("prefix")
+	if match == "" && prefix == "" {
+		renderError(w, "missing match or prefix", http.StatusBadRequest)
+		return
+	}
+
+	deleted, err := h.service.DeleteSeries(ctx, values.Get("type"), prefix, match)
+	if err != nil {
+		renderQueryError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(struct {
+		Deleted int `json:"deleted"`
+	}{Deleted: deleted}); err != nil {
+		renderError(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+// renderQueryError отправляет ошибку запроса истории с соответствующим статус кодом.
+func renderQueryError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, models.ErrMetricNotFound):
+		renderError(w, "Metric not found", http.StatusNotFound)
+	case errors.Is(err, models.ErrInvalidMetricType):
+		renderError(w, "Invalid metric type", http.StatusBadRequest)
+	case errors.Is(err, models.ErrInvalidQuery):
+		renderError(w, "Invalid query", http.StatusBadRequest)
+	case errors.Is(err, models.ErrInvalidSelector):
+		renderError(w, "Invalid selector", http.StatusBadRequest)
+	default:
+		renderError(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+// parseRangeQuery разбирает параметры запроса истории, подставляя значения по умолчанию.
+// Селектор match передается в поле ID.
+func parseRangeQuery(values url.Values) (models.RangeQuery, error) {
+	query := models.RangeQuery{
+		ID:    values.Get("id"),
+		MType: values.Get("type"),
+		Func:  values.Get("func"),
+		Agg:   values.Get("agg"),
+		To:    time.Now(),
+		Step:  defaultQueryStep,
+	}
+	if values.Has("match") {
+		query.ID = values.Get("match")
+	}
+	if query.ID == "" {
+		return query, errors.New("missing id")
+	}
+	if raw := values.Get("by"); raw != "" {
+		query.By = strings.Split(raw, ",")
+	}
+
+	var err error
+	if raw := values.Get("to"); raw != "" {
+		if query.To, err = parseQueryTime(raw); err != nil {
+			return query, errors.New("invalid to")
+		}
+	}
+	query.From = query.To.Add(-defaultQueryRange)
+	if raw := values.Get("from"); raw != "" {
+		if query.From, err = parseQueryTime(raw); err != nil {
+			return query, errors.New("invalid from")
+		}
+	}
+	if raw := values.Get("step"); raw != "" {
+		if query.Step, err = parseQueryStep(raw); err != nil {
+			return query, errors.New("invalid step")
+		}
+	}
+	return query, nil
+}
+
+// parseQueryTime принимает время в формате RFC3339 или unix timestamp в секундах.
+func parseQueryTime(raw string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return t, nil
+	}
+	seconds, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	sec, frac := math.Modf(seconds)
+	return time.Unix(int64(sec), int64(frac*float64(time.Second))), nil
+}
+
+// parseQueryStep принимает длительность в формате time.ParseDuration или число секунд.
+func parseQueryStep(raw string) (time.Duration, error) {
+	if step, err := time.ParseDuration(raw); err == nil {
+		return step, nil
+	}
+	seconds, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
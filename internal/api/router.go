@@ -34,6 +34,7 @@ func NewRouter(logger *logrus.Logger) *Router {
 func (r *Router) SetupRoutes(metricsHandler *MetricsHandler) {
 	r.Route("/", func(r chi.Router) {
 		r.Get("/", metricsHandler.GetAllMetricsHandler)
+		r.Get("/metrics", metricsHandler.PrometheusHandler)
 
 		r.Handle("/debug/pprof/*", http.HandlerFunc(pprof.Index))
 		r.Handle("/debug/pprof/cmdline", http.HandlerFunc(pprof.Cmdline))
@@ -54,6 +55,7 @@ func (r *Router) SetupRoutes(metricsHandler *MetricsHandler) {
 		r.Route("/value", func(r chi.Router) {
 			r.Post("/", metricsHandler.ValueJSONHandler)
 			r.Get("/{metricType}/{metricName}", metricsHandler.GetValuesHandler)
+			r.Delete("/{metricType}/{metricName}", metricsHandler.DeleteValueHandler)
 		})
 		r.Route("/ping", func(r chi.Router) {
 			r.Get("/", metricsHandler.PingHandler)
@@ -61,5 +63,17 @@ func (r *Router) SetupRoutes(metricsHandler *MetricsHandler) {
 		r.Route("/updates", func(r chi.Router) {
 			r.Post("/", metricsHandler.UpdatesHandler)
 		})
+		r.Post("/write", metricsHandler.InfluxWriteHandler)
+		r.Post("/v1/metrics", metricsHandler.OTLPHandler)
+		r.Route("/api/v1", func(r chi.Router) {
+			r.Get("/query", metricsHandler.AggregateHandler)
+			r.Get("/query_range", metricsHandler.QueryRangeHandler)
+			r.Get("/series", metricsHandler.SeriesHandler)
+			r.Delete("/series", metricsHandler.DeleteSeriesHandler)
+			r.Get("/metadata/{id}", metricsHandler.MetadataHandler)
+			r.Put("/metadata/{id}", metricsHandler.MetadataHandler)
+			r.Put("/admin/retype/{id}", metricsHandler.RetypeHandler)
+			r.Post("/write", metricsHandler.RemoteWriteHandler)
+		})
 	})
 }
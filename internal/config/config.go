@@ -15,7 +15,16 @@ type ServerConfig struct {
 	Address         string        // адрес и порт сервера (например: ":8080")
 	Key             string        // секретный ключ для проверки хешей
 	StoreInterval   time.Duration // интервал сохранения метрик на диск (0 - синхронная запись)
+	GraphiteAddress string        // адрес TCP приемника метрик Graphite (пусто - приемник выключен)
+	StatsdAddress   string        // адрес UDP приемника метрик StatsD (пусто - приемник выключен)
+	StatsdFlush     time.Duration // интервал сохранения агрегированных метрик StatsD
 	Restore         bool          // восстанавливать метрики из файла при старте
+	SeriesTTL       time.Duration // удалять ряды, не обновлявшиеся дольше этого времени (0 - не удалять)
+	StrictTypes     bool          // отклонять обновления метрики с типом, отличным от первого полученного
+	IdempotencyTTL  time.Duration // время, в течение которого повтор пакета с тем же Idempotency-Key не применяется
+	HistorySize     int           // количество значений истории одного ряда в памяти
+	HistoryTTL      time.Duration // удалять из истории значения старше этого времени (0 - не удалять)
+	SetWindow       time.Duration // длительность окна, за которое считаются уникальные элементы множеств (0 - за все время)
 }
 
 // AgentConfig содержит конфигурационные параметры агента.
@@ -24,14 +33,38 @@ type AgentConfig struct {
 	Key            string        // Ключ для генерации ХЕШ
 	PollInterval   time.Duration // Интервал опроса метрик
 	ReportInterval time.Duration // Интервал отправки метрик
+	SpoolDir       string        // Каталог очереди неотправленных пакетов (пусто - очередь выключена)
+	SpoolMaxSize   int64         // Максимальный размер очереди в байтах
+	SpoolMaxAge    time.Duration // Пакеты старше этого времени удаляются из очереди
+	// Фильтры файловых систем для метрик дисков: типы ФС и шаблоны точек монтирования.
+	// Пустые списки включения не ограничивают выборку.
+	DiskFSTypes            []string
+	DiskExcludeFSTypes     []string
+	DiskMountpoints        []string
+	DiskExcludeMountpoints []string
+	// Шаблоны имен сетевых интерфейсов для сетевых метрик.
+	NetInterfaces        []string
+	NetExcludeInterfaces []string
+	// Шаблоны имен gauge, для которых отправляются минимум, максимум и среднее за интервал отправки.
+	GaugeStats []string
 }
 
 type CfgAgentENV struct {
-	Address        string `env:"ADDRESS"`
-	SecretKey      string `env:"KEY"`
-	ReportInterval int    `env:"REPORT_INTERVAL"`
-	PollInterval   int    `env:"POLL_INTERVAL"`
-	RateLimit      int    `env:"RATE_LIMIT"`
+	Address                string `env:"ADDRESS"`
+	SecretKey              string `env:"KEY"`
+	ReportInterval         int    `env:"REPORT_INTERVAL"`
+	PollInterval           int    `env:"POLL_INTERVAL"`
+	RateLimit              int    `env:"RATE_LIMIT"`
+	SpoolDir               string `env:"SPOOL_DIR"`
+	SpoolMaxSize           int    `env:"SPOOL_MAX_SIZE"`
+	SpoolMaxAge            int    `env:"SPOOL_MAX_AGE"`
+	DiskFSTypes            string `env:"DISK_FS_TYPES"`
+	DiskExcludeFSTypes     string `env:"DISK_EXCLUDE_FS_TYPES"`
+	DiskMountpoints        string `env:"DISK_MOUNTPOINTS"`
+	DiskExcludeMountpoints string `env:"DISK_EXCLUDE_MOUNTPOINTS"`
+	NetInterfaces          string `env:"NET_INTERFACES"`
+	NetExcludeInterfaces   string `env:"NET_EXCLUDE_INTERFACES"`
+	GaugeStats             string `env:"GAUGE_STATS"`
 }
 
 type CfgServerENV struct {
@@ -39,8 +72,17 @@ type CfgServerENV struct {
 	FileStoragePath string `env:"FILE_STORAGE_PATH"`
 	DatabaseDSN     string `env:"DATABASE_DSN"`
 	SecretKey       string `env:"KEY"`
+	GraphiteAddress string `env:"GRAPHITE_ADDRESS"`
+	StatsdAddress   string `env:"STATSD_ADDRESS"`
 	StoreInterval   int    `env:"STORE_INTERVAL"`
+	StatsdFlush     int    `env:"STATSD_FLUSH_INTERVAL"`
+	SeriesTTL       int    `env:"SERIES_TTL"`
 	Restore         bool   `env:"RESTORE"`
+	StrictTypes     bool   `env:"STRICT_TYPES"`
+	IdempotencyTTL  int    `env:"IDEMPOTENCY_TTL"`
+	HistorySize     int    `env:"HISTORY_SIZE"`
+	HistoryTTL      int    `env:"HISTORY_TTL"`
+	SetWindow       int    `env:"SET_WINDOW"`
 }
 
 func ensureHTTP(address string) string {
@@ -50,6 +92,17 @@ func ensureHTTP(address string) string {
 	return address
 }
 
+// splitList разбивает список через запятую, пропуская пустые элементы.
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
 func (cfg *CfgAgentENV) ApplyFlags(mapFlags map[string]any) AgentConfig {
 	key := cfg.SecretKey
 	if cfg.SecretKey == "" {
@@ -88,11 +141,84 @@ func (cfg *CfgAgentENV) ApplyFlags(mapFlags map[string]any) AgentConfig {
 		rateLimit = 1
 	}
 
+	spoolDir := cfg.SpoolDir
+	if spoolDir == "" {
+		if value, ok := mapFlags["flagSpoolDir"].(string); ok {
+			spoolDir = value
+		}
+	}
+	spoolMaxSize := cfg.SpoolMaxSize
+	if spoolMaxSize == 0 {
+		if value, ok := mapFlags["flagSpoolMaxSize"].(int); ok {
+			spoolMaxSize = value
+		}
+	}
+	spoolMaxAge := cfg.SpoolMaxAge
+	if spoolMaxAge == 0 {
+		if value, ok := mapFlags["flagSpoolMaxAge"].(int); ok {
+			spoolMaxAge = value
+		}
+	}
+
+	diskFSTypes := cfg.DiskFSTypes
+	if diskFSTypes == "" {
+		if value, ok := mapFlags["flagDiskFSTypes"].(string); ok {
+			diskFSTypes = value
+		}
+	}
+	diskExcludeFSTypes := cfg.DiskExcludeFSTypes
+	if diskExcludeFSTypes == "" {
+		if value, ok := mapFlags["flagDiskExcludeFSTypes"].(string); ok {
+			diskExcludeFSTypes = value
+		}
+	}
+	diskMountpoints := cfg.DiskMountpoints
+	if diskMountpoints == "" {
+		if value, ok := mapFlags["flagDiskMountpoints"].(string); ok {
+			diskMountpoints = value
+		}
+	}
+	diskExcludeMountpoints := cfg.DiskExcludeMountpoints
+	if diskExcludeMountpoints == "" {
+		if value, ok := mapFlags["flagDiskExcludeMountpoints"].(string); ok {
+			diskExcludeMountpoints = value
+		}
+	}
+	netInterfaces := cfg.NetInterfaces
+	if netInterfaces == "" {
+		if value, ok := mapFlags["flagNetInterfaces"].(string); ok {
+			netInterfaces = value
+		}
+	}
+	netExcludeInterfaces := cfg.NetExcludeInterfaces
+	if netExcludeInterfaces == "" {
+		if value, ok := mapFlags["flagNetExcludeInterfaces"].(string); ok {
+			netExcludeInterfaces = value
+		}
+	}
+	gaugeStats := cfg.GaugeStats
+	if gaugeStats == "" {
+		if value, ok := mapFlags["flagGaugeStats"].(string); ok {
+			gaugeStats = value
+		}
+	}
+
 	agentCfg := AgentConfig{
 		Address:        address,
 		PollInterval:   time.Duration(pollInterval) * time.Second,
 		ReportInterval: time.Duration(reportInterval) * time.Second,
 		Key:            key,
+		SpoolDir:       spoolDir,
+		SpoolMaxSize:   int64(spoolMaxSize) << 20,
+		SpoolMaxAge:    time.Duration(spoolMaxAge) * time.Minute,
+
+		DiskFSTypes:            splitList(diskFSTypes),
+		DiskExcludeFSTypes:     splitList(diskExcludeFSTypes),
+		DiskMountpoints:        splitList(diskMountpoints),
+		DiskExcludeMountpoints: splitList(diskExcludeMountpoints),
+		NetInterfaces:          splitList(netInterfaces),
+		NetExcludeInterfaces:   splitList(netExcludeInterfaces),
+		GaugeStats:             splitList(gaugeStats),
 	}
 	return agentCfg
 }
@@ -146,13 +272,88 @@ func (conf *CfgServerENV) ApplyFlags(mapFlags map[string]any) ServerConfig {
 
 	}
 
+	graphiteAddress := conf.GraphiteAddress
+	if graphiteAddress == "" {
+		if value, ok := mapFlags["flagGraphiteAddress"].(string); ok {
+			graphiteAddress = value
+		}
+	}
+
+	statsdAddress := conf.StatsdAddress
+	if statsdAddress == "" {
+		if value, ok := mapFlags["flagStatsdAddress"].(string); ok {
+			statsdAddress = value
+		}
+	}
+
+	statsdFlush := conf.StatsdFlush
+	if statsdFlush == 0 {
+		if value, ok := mapFlags["flagStatsdFlush"].(int); ok {
+			statsdFlush = value
+		}
+	}
+	if statsdFlush <= 0 {
+		statsdFlush = 10
+	}
+
+	seriesTTL := conf.SeriesTTL
+	if seriesTTL == 0 {
+		if value, ok := mapFlags["flagSeriesTTL"].(int); ok {
+			seriesTTL = value
+		}
+	}
+
+	strictTypes := conf.StrictTypes
+	if !strictTypes {
+		if value, ok := mapFlags["flagStrictTypes"].(bool); ok {
+			strictTypes = value
+		}
+	}
+
+	idempotencyTTL := conf.IdempotencyTTL
+	if idempotencyTTL == 0 {
+		if value, ok := mapFlags["flagIdempotencyTTL"].(int); ok {
+			idempotencyTTL = value
+		}
+	}
+
+	historySize := conf.HistorySize
+	if historySize == 0 {
+		if value, ok := mapFlags["flagHistorySize"].(int); ok {
+			historySize = value
+		}
+	}
+
+	historyTTL := conf.HistoryTTL
+	if historyTTL == 0 {
+		if value, ok := mapFlags["flagHistoryTTL"].(int); ok {
+			historyTTL = value
+		}
+	}
+
+	setWindow := conf.SetWindow
+	if setWindow == 0 {
+		if value, ok := mapFlags["flagSetWindow"].(int); ok {
+			setWindow = value
+		}
+	}
+
 	cfg := ServerConfig{
 		Address:         serverAddress,
+		GraphiteAddress: graphiteAddress,
+		StatsdAddress:   statsdAddress,
+		StatsdFlush:     time.Duration(statsdFlush) * time.Second,
 		StoreInterval:   time.Duration(storeInterval) * time.Second,
 		FileStoragePath: fileStoragePath,
 		Restore:         restore,
 		DatabaseDSN:     dbDSN,
 		Key:             key,
+		SeriesTTL:       time.Duration(seriesTTL) * time.Minute,
+		StrictTypes:     strictTypes,
+		IdempotencyTTL:  time.Duration(idempotencyTTL) * time.Second,
+		HistorySize:     historySize,
+		HistoryTTL:      time.Duration(historyTTL) * time.Hour,
+		SetWindow:       time.Duration(setWindow) * time.Second,
 	}
 	return cfg
 }
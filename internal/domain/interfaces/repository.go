@@ -3,12 +3,14 @@ package interfaces
 
 import (
 	"context"
+	"time"
 
 	models "github.com/chestorix/monmetrics/internal/metrics"
 )
 
 // Repository определяет интерфейс для операций хранения метрик.
 // Он предоставляет методы для хранения, извлечения данных метрик и управления ими.
+// Метрики идентифицируются ключом ряда (models.SeriesKey), для метрик без меток он совпадает с именем.
 
 type Repository interface {
 	// UpdateGauge обновляет метрику Gauage с заданным именем и значением.
@@ -16,14 +18,46 @@ type Repository interface {
 	// UpdateCounter обновляет или создает метрику Counter(счетчик) с указанным именем и значением.
 	// Для счетчиков значение добавляется к существующему значению.
 	UpdateCounter(ctx context.Context, name string, value int64) error
+	// SetCounter присваивает счетчику с указанным именем абсолютное значение или создает его.
+	SetCounter(ctx context.Context, name string, value int64) error
+	// UpdateHistogram добавляет приращение к гистограмме с указанным именем или создает ее.
+	// Границы интервалов должны совпадать с сохраненными, иначе возвращается models.ErrInvalidHistogram.
+	UpdateHistogram(ctx context.Context, name string, value models.HistogramValue) error
+	// UpdateSketch объединяет скетч квантилей с сохраненным или создает его.
+	// Точность скетча должна совпадать с сохраненной, иначе возвращается models.ErrInvalidSketch.
+	UpdateSketch(ctx context.Context, name string, value models.SketchValue) error
+	// UpdateSet объединяет множество с сохраненным или создает его.
+	// Оценка количества уникальных элементов после объединения записывается в историю.
+	UpdateSet(ctx context.Context, name string, value models.SetValue) error
 	// UpdateMetricsBatch обновляет несколько показателей за одну транзакцию.
+	// Счетчики с операцией models.CounterSet получают абсолютное значение, остальные увеличиваются.
 	UpdateMetricsBatch(ctx context.Context, metrics []models.Metrics) error
+	// UpdateMetricsBatchOnce обновляет пакет метрик, если пакет с ключом идемпотентности key
+	// не применялся после since, и запоминает ключ. Возвращает false, если пакет уже был применен.
+	UpdateMetricsBatchOnce(ctx context.Context, key string, since time.Time, metrics []models.Metrics) (bool, error)
 	// GetGauge извлекает метрику Gauage по имени.
 	GetGauge(ctx context.Context, name string) (float64, bool, error)
 	// getCounter извлекает метрику счетчика по имени.
 	GetCounter(ctx context.Context, name string) (int64, bool, error)
+	// GetHistogram извлекает гистограмму по имени.
+	GetHistogram(ctx context.Context, name string) (models.HistogramValue, bool, error)
+	// GetSketch извлекает скетч квантилей по имени.
+	GetSketch(ctx context.Context, name string) (models.SketchValue, bool, error)
+	// GetSet извлекает множество по имени.
+	GetSet(ctx context.Context, name string) (models.SetValue, bool, error)
 	// GetAll извлекает все сохраненные метрики.
 	GetAll(ctx context.Context) ([]models.Metric, error)
+	// Delete удаляет ряд метрики типа mType вместе с его историей.
+	// Возвращает false, если такого ряда не было.
+	Delete(ctx context.Context, mType, name string) (bool, error)
+	// ExpireSeries удаляет ряды, которые не обновлялись с момента before, и возвращает удаленные ряды без значений.
+	ExpireSeries(ctx context.Context, before time.Time) ([]models.Metric, error)
+	// SetMetadata сохраняет метаданные метрики, заменяя ранее сохраненные.
+	SetMetadata(ctx context.Context, meta models.Metadata) error
+	// GetMetadata извлекает метаданные метрики по имени.
+	GetMetadata(ctx context.Context, name string) (models.Metadata, bool, error)
+	// GetAllMetadata извлекает метаданные всех метрик по имени метрики.
+	GetAllMetadata(ctx context.Context) (map[string]models.Metadata, error)
 	// Save сохраняет текущее состояние метрик в хранилище(Файловое хранилище).
 	Save(ctx context.Context) error
 	// Load извлекает сохраненное состояние метрик из хранилища (Файловое хранилище).
@@ -31,3 +65,13 @@ type Repository interface {
 	// Close выполняет очистку и закрывает все ресурсы, используемые хранилищем.
 	Close() error
 }
+
+// HistoryRepository расширяет Repository хранением истории значений метрик.
+// Каждое обновление метрики сохраняется как отдельный Sample с меткой времени.
+type HistoryRepository interface {
+	Repository
+	// GetHistory возвращает значения метрики за период [from, to] в порядке возрастания времени.
+	GetHistory(ctx context.Context, mType, name string, from, to time.Time) ([]models.Sample, error)
+	// PruneHistory удаляет из истории всех рядов значения старше before и возвращает их количество.
+	PruneHistory(ctx context.Context, before time.Time) (int64, error)
+}
@@ -11,10 +11,23 @@ type Service interface {
 	UpdateGauge(ctx context.Context, name string, value float64) error
 	UpdateCounter(ctx context.Context, name string, value int64) error
 	UpdateMetricsBatch(ctx context.Context, metrics []models.Metrics) error
+	UpdateMetricsBatchOnce(ctx context.Context, key string, metrics []models.Metrics) (bool, error)
+	UpdateMetricsBatchPartial(ctx context.Context, key string, metrics []models.Metrics) (models.BatchResult, bool, error)
 	GetGauge(ctx context.Context, name string) (float64, error)
 	GetCounter(ctx context.Context, name string) (int64, error)
 	GetAll(ctx context.Context) ([]models.Metric, error)
 	UpdateMetricJSON(ctx context.Context, metric models.Metrics) (models.Metrics, error)
 	GetMetricJSON(ctx context.Context, metric models.Metrics) (models.Metrics, error)
 	CheckDB(ctx context.Context, ps string) error
+	QueryRange(ctx context.Context, query models.RangeQuery) (models.RangeResult, error)
+	Aggregate(ctx context.Context, query models.RangeQuery) (models.AggregateResult, error)
+	Select(ctx context.Context, mType, selector string) ([]models.Metrics, error)
+	QueryRangeSeries(ctx context.Context, query models.RangeQuery) (models.SelectRangeResult, error)
+	AggregateSeries(ctx context.Context, query models.RangeQuery) (models.SelectAggregateResult, error)
+	SetMetadata(ctx context.Context, meta models.Metadata) error
+	GetMetadata(ctx context.Context, name string) (models.Metadata, error)
+	GetAllMetadata(ctx context.Context) (map[string]models.Metadata, error)
+	Retype(ctx context.Context, name, mType string) (models.Metadata, error)
+	DeleteMetric(ctx context.Context, mType, name string) error
+	DeleteSeries(ctx context.Context, mType, prefix, selector string) (int, error)
 }
@@ -0,0 +1,129 @@
+// Package listener - прием метрик по протоколам, отличным от HTTP.
+package listener
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chestorix/monmetrics/internal/domain/interfaces"
+	models "github.com/chestorix/monmetrics/internal/metrics"
+	"github.com/chestorix/monmetrics/internal/metrics/ingest"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// graphiteBatchSize - максимальное количество строк, сохраняемых одним пакетом.
+	graphiteBatchSize = 1000
+	// graphiteMaxLine - максимальная длина строки. Соединение, приславшее более длинную строку, закрывается,
+	// чтобы клиент без переводов строки не занял неограниченную память.
+	graphiteMaxLine = 64 * 1024
+	// graphiteIdleTimeout - время, после которого неактивное соединение закрывается.
+	graphiteIdleTimeout = 5 * time.Minute
+	// graphiteWriteTimeout - таймаут сохранения одного пакета метрик.
+	graphiteWriteTimeout = 5 * time.Second
+)
+
+// GraphiteListener принимает метрики в формате Graphite plaintext по TCP
+// и сохраняет их как gauge через сервис метрик.
+type GraphiteListener struct {
+	service interfaces.Service
+	logger  *logrus.Logger
+	address string
+}
+
+// NewGraphiteListener создает новый экземпляр GraphiteListener.
+func NewGraphiteListener(address string, service interfaces.Service, logger *logrus.Logger) *GraphiteListener {
+	return &GraphiteListener{
+		service: service,
+		logger:  logger,
+		address: address,
+	}
+}
+
+// ListenAndServe принимает соединения до отмены контекста.
+// Каждое соединение обрабатывается в отдельной горутине.
+func (l *GraphiteListener) ListenAndServe(ctx context.Context) error {
+	ln, err := net.Listen("tcp", l.address)
+	if err != nil {
+		return err
+	}
+	l.logger.Infoln("Graphite listener address: ", l.address)
+
+	go func() {
+		<-ctx.Done()
+		ln.Close()
+	}()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			l.handleConn(ctx, conn)
+		}()
+	}
+}
+
+// handleConn читает строки из соединения и сохраняет их пакетами.
+// Пакет сохраняется, когда в буфере не осталось прочитанных данных или он достиг graphiteBatchSize.
+func (l *GraphiteListener) handleConn(ctx context.Context, conn net.Conn) {
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	reader := bufio.NewReaderSize(conn, graphiteMaxLine)
+	var batch []models.Metrics
+	for {
+		conn.SetReadDeadline(time.Now().Add(graphiteIdleTimeout))
+		data, err := reader.ReadSlice('\n')
+		if errors.Is(err, bufio.ErrBufferFull) {
+			l.logger.WithField("remote", conn.RemoteAddr().String()).Warn("Graphite line too long, closing connection")
+			l.flush(ctx, batch)
+			return
+		}
+		if line := strings.TrimSpace(string(data)); line != "" {
+			metric, parseErr := ingest.ParseGraphiteLine(line)
+			if parseErr != nil {
+				l.logger.WithError(parseErr).WithField("remote", conn.RemoteAddr().String()).Warn("Invalid graphite line")
+			} else {
+				batch = append(batch, metric)
+			}
+		}
+
+		if err != nil || reader.Buffered() == 0 || len(batch) >= graphiteBatchSize {
+			l.flush(ctx, batch)
+			batch = batch[:0]
+		}
+		if err != nil {
+			if !errors.Is(err, io.EOF) && ctx.Err() == nil {
+				l.logger.WithError(err).Debug("Graphite connection closed")
+			}
+			return
+		}
+	}
+}
+
+func (l *GraphiteListener) flush(ctx context.Context, batch []models.Metrics) {
+	if len(batch) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, graphiteWriteTimeout)
+	defer cancel()
+	if err := l.service.UpdateMetricsBatch(ctx, batch); err != nil {
+		l.logger.WithError(err).Error("Failed to save graphite metrics")
+	}
+}
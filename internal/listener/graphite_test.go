@@ -0,0 +1,46 @@
+package listener
+
+import (
+	"context"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/chestorix/monmetrics/internal/metrics/repository"
+	"github.com/chestorix/monmetrics/internal/metrics/service"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGraphiteListener_HandleConn(t *testing.T) {
+	ctx := context.Background()
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	svc := service.NewService(repository.NewMemStorage(""))
+	l := NewGraphiteListener("", svc, logger)
+
+	server, client := net.Pipe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		l.handleConn(ctx, server)
+	}()
+
+	// Строка с недопустимым именем пропускается, остальные строки пакета сохраняются.
+	_, err := io.WriteString(client, "disk.free 10\ndisk{x} 1\ndisk.used 5\n")
+	require.NoError(t, err)
+	// Строка длиннее graphiteMaxLine закрывает соединение.
+	_, err = io.WriteString(client, strings.Repeat("a", graphiteMaxLine+1))
+	assert.Error(t, err)
+	<-done
+	client.Close()
+
+	free, err := svc.GetGauge(ctx, "disk.free")
+	require.NoError(t, err)
+	assert.Equal(t, 10.0, free)
+	used, err := svc.GetGauge(ctx, "disk.used")
+	require.NoError(t, err)
+	assert.Equal(t, 5.0, used)
+}
@@ -0,0 +1,260 @@
+// Package listener - прием метрик по протоколам, отличным от HTTP.
+package listener
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chestorix/monmetrics/internal/domain/interfaces"
+	models "github.com/chestorix/monmetrics/internal/metrics"
+	"github.com/chestorix/monmetrics/internal/metrics/aggregate"
+	"github.com/chestorix/monmetrics/internal/metrics/ingest"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// statsdPacketSize - максимальный размер UDP пакета StatsD.
+	statsdPacketSize = 64 * 1024
+	// statsdWriteTimeout - таймаут сохранения агрегированных метрик.
+	statsdWriteTimeout = 5 * time.Second
+)
+
+// statsdTimerStats - статистики, вычисляемые для таймеров при сбросе.
+var statsdTimerStats = []string{aggregate.Avg, aggregate.Min, aggregate.Max, aggregate.P50, aggregate.P95, aggregate.P99}
+
+// StatsdListener принимает метрики по протоколу StatsD через UDP,
+// агрегирует их в памяти и раз в flushInterval сохраняет одним пакетом.
+// Агрегаты хранятся по ключу ряда, так что значения с разными тегами не смешиваются.
+type StatsdListener struct {
+	service       interfaces.Service
+	logger        *logrus.Logger
+	counters      map[string]float64
+	gauges        map[string]float64
+	updatedGauges map[string]struct{}
+	// unseeded - относительные изменения gauge, текущее значение которых еще не загружено из хранилища.
+	unseeded      map[string]float64
+	timers        map[string]*statsdTimer
+	address       string
+	flushInterval time.Duration
+	mu            sync.Mutex
+}
+
+// statsdTimer - значения таймера за интервал и их количество с учетом частоты выборки.
+type statsdTimer struct {
+	values []models.Sample
+	count  float64
+}
+
+// NewStatsdListener создает новый экземпляр StatsdListener.
+func NewStatsdListener(address string, flushInterval time.Duration, service interfaces.Service, logger *logrus.Logger) *StatsdListener {
+	return &StatsdListener{
+		service:       service,
+		logger:        logger,
+		counters:      make(map[string]float64),
+		gauges:        make(map[string]float64),
+		updatedGauges: make(map[string]struct{}),
+		unseeded:      make(map[string]float64),
+		timers:        make(map[string]*statsdTimer),
+		address:       address,
+		flushInterval: flushInterval,
+	}
+}
+
+// ListenAndServe принимает пакеты до отмены контекста. Перед завершением накопленные метрики сохраняются.
+func (l *StatsdListener) ListenAndServe(ctx context.Context) error {
+	conn, err := net.ListenPacket("udp", l.address)
+	if err != nil {
+		return err
+	}
+	l.logger.Infoln("StatsD listener address: ", l.address)
+
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		l.flushLoop(ctx)
+	}()
+	defer func() { <-done }()
+
+	buf := make([]byte, statsdPacketSize)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		l.handlePacket(buf[:n])
+	}
+}
+
+// handlePacket учитывает строки пакета. Некорректные строки пропускаются.
+func (l *StatsdListener) handlePacket(packet []byte) {
+	for _, line := range strings.Split(string(packet), "\n") {
+		if line = strings.TrimSpace(line); line == "" {
+			continue
+		}
+		sample, err := ingest.ParseStatsdLine(line)
+		if err != nil {
+			l.logger.WithError(err).Debug("Invalid statsd line")
+			continue
+		}
+		l.add(sample)
+	}
+}
+
+func (l *StatsdListener) flushLoop(ctx context.Context) {
+	ticker := time.NewTicker(l.flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			l.flush(context.Background())
+		case <-ctx.Done():
+			l.flush(context.Background())
+			return
+		}
+	}
+}
+
+// add учитывает значение в агрегатах текущего интервала.
+// Относительное изменение gauge, значение которого еще неизвестно, откладывается до сброса,
+// чтобы не обращаться к хранилищу в цикле чтения пакетов.
+func (l *StatsdListener) add(sample ingest.StatsdSample) {
+	key := models.SeriesKey(sample.Name, sample.Labels)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	switch sample.Type {
+	case ingest.StatsdCounter:
+		l.counters[key] += sample.Value / sample.SampleRate
+	case ingest.StatsdGauge:
+		if !sample.Relative {
+			l.gauges[key] = sample.Value
+			delete(l.unseeded, key)
+		} else if _, ok := l.gauges[key]; ok {
+			l.gauges[key] += sample.Value
+		} else {
+			l.unseeded[key] += sample.Value
+		}
+		l.updatedGauges[key] = struct{}{}
+	case ingest.StatsdTimer:
+		timer, ok := l.timers[key]
+		if !ok {
+			timer = &statsdTimer{}
+			l.timers[key] = timer
+		}
+		timer.values = append(timer.values, models.Sample{Value: sample.Value})
+		timer.count += 1 / sample.SampleRate
+	}
+}
+
+// seedGauges загружает из хранилища текущие значения gauge, для которых накоплены только
+// относительные изменения, и применяет к ним эти изменения.
+func (l *StatsdListener) seedGauges(ctx context.Context) {
+	l.mu.Lock()
+	keys := make([]string, 0, len(l.unseeded))
+	for key := range l.unseeded {
+		keys = append(keys, key)
+	}
+	l.mu.Unlock()
+	if len(keys) == 0 {
+		return
+	}
+
+	values := make(map[string]float64, len(keys))
+	for _, key := range keys {
+		value, err := l.service.GetGauge(ctx, key)
+		if err != nil && !errors.Is(err, models.ErrMetricNotFound) {
+			l.logger.WithError(err).Warn("Failed to load statsd gauge")
+		}
+		values[key] = value
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for key, value := range values {
+		// За время загрузки gauge могло прийти абсолютное значение, тогда изменения уже отброшены.
+		if delta, ok := l.unseeded[key]; ok {
+			l.gauges[key] = value + delta
+			delete(l.unseeded, key)
+		}
+	}
+}
+
+// flush сохраняет агрегаты интервала в режиме частичного приема: метрика, отклоненная сервисом
+// (например, из-за конфликта типов), не мешает сохранить остальные. Дробная часть счетчиков, возникающая из-за частоты выборки,
+// переносится в следующий интервал. Значения gauge сохраняются между интервалами для относительных изменений.
+func (l *StatsdListener) flush(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, statsdWriteTimeout)
+	defer cancel()
+	l.seedGauges(ctx)
+
+	l.mu.Lock()
+	var batch []models.Metrics
+	for key, value := range l.counters {
+		delta := int64(math.Trunc(value))
+		if delta != 0 {
+			name, labels, _ := models.ParseSeriesKey(key)
+			batch = append(batch, models.Metrics{ID: name, MType: models.Counter, Delta: &delta, Labels: labels})
+		}
+		if rest := value - float64(delta); rest != 0 {
+			l.counters[key] = rest
+		} else {
+			delete(l.counters, key)
+		}
+	}
+	for key := range l.updatedGauges {
+		value, ok := l.gauges[key]
+		if !ok {
+			continue
+		}
+		name, labels, _ := models.ParseSeriesKey(key)
+		batch = append(batch, models.Metrics{ID: name, MType: models.Gauge, Value: &value, Labels: labels})
+	}
+	for key, timer := range l.timers {
+		name, labels, _ := models.ParseSeriesKey(key)
+		batch = append(batch, timerMetrics(name, labels, timer)...)
+	}
+	l.updatedGauges = make(map[string]struct{})
+	l.timers = make(map[string]*statsdTimer)
+	l.mu.Unlock()
+
+	if len(batch) == 0 {
+		return
+	}
+	result, _, err := l.service.UpdateMetricsBatchPartial(ctx, "", batch)
+	if err != nil {
+		l.logger.WithError(err).Error("Failed to save statsd metrics")
+		return
+	}
+	for _, rejected := range result.Rejected {
+		l.logger.WithField("metric", rejected.ID).WithField("reason", rejected.Reason).Warn("Rejected statsd metric")
+	}
+}
+
+// timerMetrics преобразует таймер в счетчик <name>.count и gauge <name>.<stat> для каждой статистики.
+func timerMetrics(name string, labels map[string]string, timer *statsdTimer) []models.Metrics {
+	count := int64(math.Round(timer.count))
+	metrics := []models.Metrics{{ID: name + ".count", MType: models.Counter, Delta: &count, Labels: labels}}
+	for _, stat := range statsdTimerStats {
+		value, err := aggregate.Apply(stat, timer.values)
+		if err != nil {
+			continue
+		}
+		metrics = append(metrics, models.Metrics{ID: name + "." + stat, MType: models.Gauge, Value: &value, Labels: labels})
+	}
+	return metrics
+}
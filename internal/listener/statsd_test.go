@@ -0,0 +1,121 @@
+package listener
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/chestorix/monmetrics/internal/metrics/ingest"
+	"github.com/chestorix/monmetrics/internal/metrics/repository"
+	"github.com/chestorix/monmetrics/internal/metrics/service"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestStatsd(t *testing.T) (*StatsdListener, *service.MetricsService) {
+	t.Helper()
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	svc := service.NewService(repository.NewMemStorage(""))
+	return NewStatsdListener("", time.Second, svc, logger), svc
+}
+
+func addLines(t *testing.T, l *StatsdListener, lines ...string) {
+	t.Helper()
+	for _, line := range lines {
+		sample, err := ingest.ParseStatsdLine(line)
+		require.NoError(t, err)
+		l.add(sample)
+	}
+}
+
+func TestStatsdListener_CounterSampleRate(t *testing.T) {
+	ctx := context.Background()
+	l, svc := newTestStatsd(t)
+
+	var totals []int64
+	for range 3 {
+		addLines(t, l, "hits:1|c|@0.3")
+		l.flush(ctx)
+		total, err := svc.GetCounter(ctx, "hits")
+		require.NoError(t, err)
+		totals = append(totals, total)
+	}
+	// 1/0.3 = 3.33..., дробная часть накапливается и попадает в третий интервал.
+	assert.Equal(t, []int64{3, 6, 10}, totals)
+}
+
+func TestStatsdListener_RelativeGauge(t *testing.T) {
+	ctx := context.Background()
+	l, svc := newTestStatsd(t)
+	require.NoError(t, svc.UpdateGauge(ctx, "queue", 10))
+
+	addLines(t, l, "queue:+5|g")
+	l.flush(ctx)
+	value, err := svc.GetGauge(ctx, "queue")
+	require.NoError(t, err)
+	assert.Equal(t, 15.0, value)
+
+	addLines(t, l, "queue:-3|g")
+	l.flush(ctx)
+	value, err = svc.GetGauge(ctx, "queue")
+	require.NoError(t, err)
+	assert.Equal(t, 12.0, value)
+
+	// Абсолютное значение отменяет изменения, пришедшие до него.
+	addLines(t, l, "fresh:+2|g", "fresh:7|g", "fresh:+1|g")
+	l.flush(ctx)
+	value, err = svc.GetGauge(ctx, "fresh")
+	require.NoError(t, err)
+	assert.Equal(t, 8.0, value)
+}
+
+func TestStatsdListener_Timer(t *testing.T) {
+	ctx := context.Background()
+	l, svc := newTestStatsd(t)
+
+	addLines(t, l, "db.query:10|ms|@0.5", "db.query:20|ms|@0.5", "db.query:30|ms|@0.5")
+	l.flush(ctx)
+
+	count, err := svc.GetCounter(ctx, "db.query.count")
+	require.NoError(t, err)
+	assert.Equal(t, int64(6), count)
+	avg, err := svc.GetGauge(ctx, "db.query.avg")
+	require.NoError(t, err)
+	assert.Equal(t, 20.0, avg)
+	maxValue, err := svc.GetGauge(ctx, "db.query.max")
+	require.NoError(t, err)
+	assert.Equal(t, 30.0, maxValue)
+
+	// Таймеры не переносятся между интервалами.
+	l.flush(ctx)
+	count, err = svc.GetCounter(ctx, "db.query.count")
+	require.NoError(t, err)
+	assert.Equal(t, int64(6), count)
+}
+
+func TestStatsdListener_BadLines(t *testing.T) {
+	ctx := context.Background()
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	svc := service.NewService(repository.NewMemStorage(""), service.WithStrictTypes(true))
+	l := NewStatsdListener("", time.Second, svc, logger)
+	require.NoError(t, svc.UpdateGauge(ctx, "conflict", 1))
+
+	// Строка с недопустимым именем отбрасывается при чтении, а метрика с конфликтом типов
+	// отклоняется при сохранении, не мешая остальным.
+	l.handlePacket([]byte("good:5|c\nokgauge:3|g\nbad{x:1|c\nconflict:2|c\n"))
+	l.flush(ctx)
+
+	good, err := svc.GetCounter(ctx, "good")
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), good)
+	okgauge, err := svc.GetGauge(ctx, "okgauge")
+	require.NoError(t, err)
+	assert.Equal(t, 3.0, okgauge)
+	conflict, err := svc.GetGauge(ctx, "conflict")
+	require.NoError(t, err)
+	assert.Equal(t, 1.0, conflict)
+}
@@ -0,0 +1,177 @@
+// Package aggregate содержит функции агрегации истории метрик.
+package aggregate
+
+import (
+	"errors"
+	"math"
+	"sort"
+
+	models "github.com/chestorix/monmetrics/internal/metrics"
+)
+
+// Поддерживаемые функции агрегации.
+const (
+	Last     = "last"
+	Avg      = "avg"
+	Min      = "min"
+	Max      = "max"
+	Sum      = "sum"
+	Count    = "count"
+	P50      = "p50"
+	P95      = "p95"
+	P99      = "p99"
+	Rate     = "rate"
+	Increase = "increase"
+)
+
+var (
+	ErrUnknownFunc     = errors.New("unknown aggregation function")
+	ErrNotEnoughPoints = errors.New("not enough samples")
+)
+
+// IsValid сообщает, поддерживается ли функция агрегации.
+func IsValid(fn string) bool {
+	switch fn {
+	case Last, Avg, Min, Max, Sum, Count, P50, P95, P99, Rate, Increase:
+		return true
+	}
+	return false
+}
+
+// CounterOnly сообщает, применима ли функция только к счетчикам.
+func CounterOnly(fn string) bool {
+	return fn == Rate || fn == Increase
+}
+
+// Apply вычисляет функцию fn над значениями, упорядоченными по времени.
+// Для rate и increase значения считаются накопленными значениями счетчика,
+// уменьшение значения трактуется как сброс счетчика.
+func Apply(fn string, samples []models.Sample) (float64, error) {
+	if fn == Count {
+		return float64(len(samples)), nil
+	}
+	if len(samples) == 0 {
+		return 0, ErrNotEnoughPoints
+	}
+
+	switch fn {
+	case Last:
+		return samples[len(samples)-1].Value, nil
+	case Avg:
+		return sum(samples) / float64(len(samples)), nil
+	case Min:
+		result := samples[0].Value
+		for _, s := range samples[1:] {
+			result = math.Min(result, s.Value)
+		}
+		return result, nil
+	case Max:
+		result := samples[0].Value
+		for _, s := range samples[1:] {
+			result = math.Max(result, s.Value)
+		}
+		return result, nil
+	case Sum:
+		return sum(samples), nil
+	case P50:
+		return quantile(samples, 0.5), nil
+	case P95:
+		return quantile(samples, 0.95), nil
+	case P99:
+		return quantile(samples, 0.99), nil
+	case Increase:
+		if len(samples) < 2 {
+			return 0, ErrNotEnoughPoints
+		}
+		return increase(samples), nil
+	case Rate:
+		if len(samples) < 2 {
+			return 0, ErrNotEnoughPoints
+		}
+		elapsed := samples[len(samples)-1].Timestamp.Sub(samples[0].Timestamp).Seconds()
+		if elapsed <= 0 {
+			return 0, ErrNotEnoughPoints
+		}
+		return increase(samples) / elapsed, nil
+	default:
+		return 0, ErrUnknownFunc
+	}
+}
+
+// IsSketchFunc сообщает, можно ли вычислить функцию по скетчу квантилей.
+func IsSketchFunc(fn string) bool {
+	switch fn {
+	case Avg, Min, Max, Sum, Count, P50, P95, P99:
+		return true
+	}
+	return false
+}
+
+// ApplySketch вычисляет функцию fn по скетчу квантилей.
+func ApplySketch(fn string, sketch models.SketchValue) (float64, error) {
+	if fn == Count {
+		return float64(sketch.Count), nil
+	}
+	if sketch.Count == 0 {
+		return 0, ErrNotEnoughPoints
+	}
+
+	switch fn {
+	case Avg:
+		return sketch.Sum / float64(sketch.Count), nil
+	case Min:
+		return sketch.Min, nil
+	case Max:
+		return sketch.Max, nil
+	case Sum:
+		return sketch.Sum, nil
+	case P50:
+		return sketch.Quantile(0.5)
+	case P95:
+		return sketch.Quantile(0.95)
+	case P99:
+		return sketch.Quantile(0.99)
+	default:
+		return 0, ErrUnknownFunc
+	}
+}
+
+func sum(samples []models.Sample) float64 {
+	var result float64
+	for _, s := range samples {
+		result += s.Value
+	}
+	return result
+}
+
+// increase возвращает прирост счетчика с учетом сбросов:
+// если значение уменьшилось, счетчик начался заново с нуля.
+func increase(samples []models.Sample) float64 {
+	var result float64
+	for i := 1; i < len(samples); i++ {
+		prev, cur := samples[i-1].Value, samples[i].Value
+		if cur < prev {
+			result += cur
+			continue
+		}
+		result += cur - prev
+	}
+	return result
+}
+
+// quantile вычисляет квантиль q с линейной интерполяцией между соседними значениями.
+func quantile(samples []models.Sample, q float64) float64 {
+	values := make([]float64, len(samples))
+	for i, s := range samples {
+		values[i] = s.Value
+	}
+	sort.Float64s(values)
+
+	rank := q * float64(len(values)-1)
+	lower := int(math.Floor(rank))
+	upper := int(math.Ceil(rank))
+	if lower == upper {
+		return values[lower]
+	}
+	return values[lower] + (values[upper]-values[lower])*(rank-float64(lower))
+}
@@ -0,0 +1,92 @@
+package aggregate
+
+import (
+	"testing"
+	"time"
+
+	models "github.com/chestorix/monmetrics/internal/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func samplesOf(values ...float64) []models.Sample {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	samples := make([]models.Sample, len(values))
+	for i, v := range values {
+		samples[i] = models.Sample{Timestamp: start.Add(time.Duration(i) * 10 * time.Second), Value: v}
+	}
+	return samples
+}
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name    string
+		fn      string
+		samples []models.Sample
+		want    float64
+	}{
+		{name: "last", fn: Last, samples: samplesOf(1, 2, 3), want: 3},
+		{name: "avg", fn: Avg, samples: samplesOf(1, 2, 3, 4), want: 2.5},
+		{name: "min", fn: Min, samples: samplesOf(3, 1, 2), want: 1},
+		{name: "max", fn: Max, samples: samplesOf(3, 1, 2), want: 3},
+		{name: "sum", fn: Sum, samples: samplesOf(1, 2, 3), want: 6},
+		{name: "count", fn: Count, samples: samplesOf(1, 2, 3), want: 3},
+		{name: "p50 interpolated", fn: P50, samples: samplesOf(4, 1, 3, 2), want: 2.5},
+		{name: "p99 of single", fn: P99, samples: samplesOf(7), want: 7},
+		{name: "increase", fn: Increase, samples: samplesOf(10, 15, 30), want: 20},
+		{name: "increase with reset", fn: Increase, samples: samplesOf(10, 15, 5, 8), want: 13},
+		{name: "rate with reset", fn: Rate, samples: samplesOf(10, 15, 5, 8), want: 13.0 / 30},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Apply(tt.fn, tt.samples)
+			require.NoError(t, err)
+			assert.InDelta(t, tt.want, got, 1e-9)
+		})
+	}
+}
+
+func TestApply_Errors(t *testing.T) {
+	_, err := Apply(Rate, samplesOf(1))
+	assert.ErrorIs(t, err, ErrNotEnoughPoints)
+
+	_, err = Apply(Avg, nil)
+	assert.ErrorIs(t, err, ErrNotEnoughPoints)
+
+	_, err = Apply("median", samplesOf(1))
+	assert.ErrorIs(t, err, ErrUnknownFunc)
+}
+
+func TestApplySketch(t *testing.T) {
+	sketch := models.NewSketch(models.DefaultSketchAlpha)
+	for i := 1; i <= 100; i++ {
+		sketch.Add(float64(i))
+	}
+
+	tests := []struct {
+		fn   string
+		want float64
+	}{
+		{fn: Count, want: 100},
+		{fn: Sum, want: 5050},
+		{fn: Avg, want: 50.5},
+		{fn: Min, want: 1},
+		{fn: Max, want: 100},
+		{fn: P50, want: 50},
+		{fn: P99, want: 99},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fn, func(t *testing.T) {
+			got, err := ApplySketch(tt.fn, sketch)
+			require.NoError(t, err)
+			assert.InEpsilon(t, tt.want, got, models.DefaultSketchAlpha)
+		})
+	}
+
+	_, err := ApplySketch(P50, models.NewSketch(models.DefaultSketchAlpha))
+	assert.ErrorIs(t, err, ErrNotEnoughPoints)
+
+	_, err = ApplySketch(Rate, sketch)
+	assert.ErrorIs(t, err, ErrUnknownFunc)
+}
@@ -0,0 +1,162 @@
+// Package collector - содержит логику сбора метрик.
+package collector
+
+import (
+	"path/filepath"
+	"slices"
+
+	models "github.com/chestorix/monmetrics/internal/metrics"
+	"github.com/shirou/gopsutil/v3/disk"
+)
+
+// DiskFilter задает, какие файловые системы учитывает DiskCollector.
+// Пустые списки Include не ограничивают выборку, списки Exclude проверяются после них.
+// Точки монтирования задаются шаблонами filepath.Match, например "/mnt/*".
+type DiskFilter struct {
+	IncludeFSTypes     []string
+	ExcludeFSTypes     []string
+	IncludeMountpoints []string
+	ExcludeMountpoints []string
+}
+
+// DiskCollector собирает заполненность файловых систем с метками mountpoint и fstype
+// и счетчики ввода-вывода их устройств с меткой device.
+type DiskCollector struct {
+	filter     DiskFilter
+	deltas     counterDeltas
+	partitions func(all bool) ([]disk.PartitionStat, error)
+	usage      func(path string) (*disk.UsageStat, error)
+	ioCounters func(names ...string) (map[string]disk.IOCountersStat, error)
+}
+
+func NewDiskCollector(filter DiskFilter) *DiskCollector {
+	return &DiskCollector{
+		filter:     filter,
+		partitions: disk.Partitions,
+		usage:      disk.Usage,
+		ioCounters: disk.IOCounters,
+	}
+}
+
+// Collect возвращает метрики дисков. Файловые системы и устройства, данные которых
+// не удалось получить, пропускаются.
+func (c *DiskCollector) Collect() []models.Metric {
+	partitions, err := c.partitions(false)
+	if err != nil {
+		return nil
+	}
+
+	var metrics []models.Metric
+	var devices []string
+	for _, p := range partitions {
+		if !c.filter.match(p) {
+			continue
+		}
+		if p.Device != "" {
+			if device := deviceName(p.Device); !slices.Contains(devices, device) {
+				devices = append(devices, device)
+			}
+		}
+		usage, err := c.usage(p.Mountpoint)
+		if err != nil {
+			continue
+		}
+		labels := map[string]string{"mountpoint": p.Mountpoint, "fstype": p.Fstype}
+		metrics = append(metrics,
+			models.Metric{Name: "DiskTotal", Type: models.Gauge, Value: float64(usage.Total), Labels: labels},
+			models.Metric{Name: "DiskUsed", Type: models.Gauge, Value: float64(usage.Used), Labels: labels},
+			models.Metric{Name: "DiskFree", Type: models.Gauge, Value: float64(usage.Free), Labels: labels},
+			models.Metric{Name: "DiskInodesUsed", Type: models.Gauge, Value: float64(usage.InodesUsed), Labels: labels},
+			models.Metric{Name: "DiskInodesFree", Type: models.Gauge, Value: float64(usage.InodesFree), Labels: labels},
+		)
+	}
+	if len(devices) == 0 {
+		return metrics
+	}
+
+	counters, err := c.ioCounters(devices...)
+	if err != nil {
+		return metrics
+	}
+	slices.Sort(devices)
+	for _, device := range devices {
+		cur, ok := counters[device]
+		if !ok {
+			continue
+		}
+		labels := map[string]string{"device": device}
+		metrics = c.deltas.add(metrics, "DiskReadBytes", labels, cur.ReadBytes)
+		metrics = c.deltas.add(metrics, "DiskWriteBytes", labels, cur.WriteBytes)
+		metrics = c.deltas.add(metrics, "DiskReads", labels, cur.ReadCount)
+		metrics = c.deltas.add(metrics, "DiskWrites", labels, cur.WriteCount)
+	}
+	c.deltas.next()
+	return metrics
+}
+
+func (f DiskFilter) match(p disk.PartitionStat) bool {
+	if len(f.IncludeFSTypes) > 0 && !slices.Contains(f.IncludeFSTypes, p.Fstype) {
+		return false
+	}
+	if slices.Contains(f.ExcludeFSTypes, p.Fstype) {
+		return false
+	}
+	if len(f.IncludeMountpoints) > 0 && !matchAny(f.IncludeMountpoints, p.Mountpoint) {
+		return false
+	}
+	return !matchAny(f.ExcludeMountpoints, p.Mountpoint)
+}
+
+// deviceName возвращает имя устройства, под которым его учитывает /proc/diskstats.
+// Пути /dev/mapper/* и /dev/disk/by-* - символические ссылки на dm-N и sdX, поэтому сначала они разрешаются.
+func deviceName(device string) string {
+	if resolved, err := filepath.EvalSymlinks(device); err == nil {
+		device = resolved
+	}
+	return filepath.Base(device)
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// counterDeltas переводит накопленные системные счетчики в приращения с предыдущего опроса,
+// которые агент суммирует до отправки. Первое значение счетчика только запоминается: приращение
+// с загрузки системы не относится к интервалу опроса. Счетчики, пропавшие из опроса, забываются.
+type counterDeltas struct {
+	prev map[string]uint64
+	cur  map[string]uint64
+}
+
+// add запоминает значение value счетчика name с метками labels и, если известно значение
+// с предыдущего опроса, добавляет в metrics приращение.
+func (d *counterDeltas) add(metrics []models.Metric, name string, labels map[string]string, value uint64) []models.Metric {
+	key := models.SeriesKey(name, labels)
+	if d.cur == nil {
+		d.cur = make(map[string]uint64)
+	}
+	d.cur[key] = value
+	if prev, ok := d.prev[key]; ok {
+		metrics = append(metrics, models.Metric{Name: name, Type: models.Counter, Value: counterDelta(prev, value), Labels: labels})
+	}
+	return metrics
+}
+
+// next завершает опрос: запомненные значения становятся предыдущими.
+func (d *counterDeltas) next() {
+	d.prev, d.cur = d.cur, nil
+}
+
+// counterDelta возвращает приращение системного счетчика. Если счетчик уменьшился
+// (устройство переподключено), приращением считается его текущее значение.
+func counterDelta(prev, cur uint64) int64 {
+	if cur < prev {
+		return int64(cur)
+	}
+	return int64(cur - prev)
+}
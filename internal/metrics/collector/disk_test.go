@@ -0,0 +1,79 @@
+package collector
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	models "github.com/chestorix/monmetrics/internal/metrics"
+	"github.com/shirou/gopsutil/v3/disk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiskCollector_Collect(t *testing.T) {
+	c := NewDiskCollector(DiskFilter{ExcludeFSTypes: []string{"tmpfs"}, ExcludeMountpoints: []string{"/mnt/*"}})
+	c.partitions = func(bool) ([]disk.PartitionStat, error) {
+		return []disk.PartitionStat{
+			{Device: "/dev/sda1", Mountpoint: "/", Fstype: "ext4"},
+			{Device: "tmpfs", Mountpoint: "/run", Fstype: "tmpfs"},
+			{Device: "/dev/sdb1", Mountpoint: "/mnt/backup", Fstype: "ext4"},
+		}, nil
+	}
+	c.usage = func(path string) (*disk.UsageStat, error) {
+		return &disk.UsageStat{Path: path, Total: 100, Used: 40, Free: 60, InodesUsed: 5, InodesFree: 95}, nil
+	}
+	reads := uint64(10)
+	c.ioCounters = func(names ...string) (map[string]disk.IOCountersStat, error) {
+		assert.Equal(t, []string{"sda1"}, names)
+		return map[string]disk.IOCountersStat{
+			"sda1": {Name: "sda1", ReadBytes: reads * 512, WriteBytes: 4096, ReadCount: reads, WriteCount: 1},
+		}, nil
+	}
+
+	metrics := c.Collect()
+	require.Len(t, metrics, 5)
+	for _, m := range metrics {
+		assert.Equal(t, models.Gauge, m.Type)
+		assert.Equal(t, map[string]string{"mountpoint": "/", "fstype": "ext4"}, m.Labels)
+	}
+	assert.Equal(t, "DiskUsed", metrics[1].Name)
+	assert.Equal(t, 40.0, metrics[1].Value)
+
+	reads = 25
+	metrics = c.Collect()
+	require.Len(t, metrics, 9)
+	got := make(map[string]any)
+	for _, m := range metrics[5:] {
+		assert.Equal(t, models.Counter, m.Type)
+		assert.Equal(t, map[string]string{"device": "sda1"}, m.Labels)
+		got[m.Name] = m.Value
+	}
+	assert.Equal(t, map[string]any{
+		"DiskReadBytes":  int64(15 * 512),
+		"DiskWriteBytes": int64(0),
+		"DiskReads":      int64(15),
+		"DiskWrites":     int64(0),
+	}, got)
+}
+
+func TestDiskFilter_Include(t *testing.T) {
+	f := DiskFilter{IncludeFSTypes: []string{"ext4", "xfs"}, IncludeMountpoints: []string{"/", "/data*"}}
+	assert.True(t, f.match(disk.PartitionStat{Mountpoint: "/", Fstype: "ext4"}))
+	assert.True(t, f.match(disk.PartitionStat{Mountpoint: "/data2", Fstype: "xfs"}))
+	assert.False(t, f.match(disk.PartitionStat{Mountpoint: "/home", Fstype: "ext4"}))
+	assert.False(t, f.match(disk.PartitionStat{Mountpoint: "/", Fstype: "btrfs"}))
+}
+
+func TestDeviceName(t *testing.T) {
+	dir := t.TempDir()
+	dm := filepath.Join(dir, "dm-0")
+	require.NoError(t, os.WriteFile(dm, nil, 0o644))
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "mapper"), 0o755))
+	require.NoError(t, os.Symlink("../dm-0", filepath.Join(dir, "mapper", "vg-root")))
+
+	assert.Equal(t, "dm-0", deviceName(filepath.Join(dir, "mapper", "vg-root")))
+	assert.Equal(t, "dm-0", deviceName(dm))
+	// Путь, которого нет в системе, используется как есть.
+	assert.Equal(t, "sda1", deviceName("/nonexistent/sda1"))
+}
@@ -0,0 +1,116 @@
+// Package collector - содержит логику сбора метрик.
+package collector
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	models "github.com/chestorix/monmetrics/internal/metrics"
+	"github.com/shirou/gopsutil/v3/host"
+	"github.com/shirou/gopsutil/v3/load"
+	"github.com/shirou/gopsutil/v3/process"
+)
+
+// HostCollector собирает загрузку, время работы (в секундах), процессы, потоки, дескрипторы
+// и переключения контекста хоста. Дескрипторы читаются из /proc и доступны только в Linux.
+type HostCollector struct {
+	deltas  counterDeltas
+	procDir string
+	avg     func() (*load.AvgStat, error)
+	misc    func() (*load.MiscStat, error)
+	uptime  func() (uint64, error)
+	threads func() (uint64, error)
+}
+
+func NewHostCollector() *HostCollector {
+	return &HostCollector{
+		procDir: "/proc",
+		avg:     load.Avg,
+		misc:    load.Misc,
+		uptime:  host.Uptime,
+		threads: processThreads,
+	}
+}
+
+// Collect возвращает метрики хоста. Показатели, которые не удалось получить, пропускаются.
+func (c *HostCollector) Collect() []models.Metric {
+	var metrics []models.Metric
+
+	if avg, err := c.avg(); err == nil {
+		metrics = append(metrics,
+			models.Metric{Name: "HostLoad1", Type: models.Gauge, Value: avg.Load1},
+			models.Metric{Name: "HostLoad5", Type: models.Gauge, Value: avg.Load5},
+			models.Metric{Name: "HostLoad15", Type: models.Gauge, Value: avg.Load15},
+		)
+	}
+	if uptime, err := c.uptime(); err == nil {
+		metrics = append(metrics, models.Metric{Name: "HostUptime", Type: models.Gauge, Value: float64(uptime)})
+	}
+	// Misc возвращает прочитанную часть статистики и при ошибке подсчета процессов.
+	if misc, err := c.misc(); misc != nil {
+		if err == nil {
+			metrics = append(metrics, models.Metric{Name: "HostProcs", Type: models.Gauge, Value: float64(misc.ProcsTotal)})
+		}
+		metrics = append(metrics,
+			models.Metric{Name: "HostProcsRunning", Type: models.Gauge, Value: float64(misc.ProcsRunning)},
+			models.Metric{Name: "HostProcsBlocked", Type: models.Gauge, Value: float64(misc.ProcsBlocked)},
+		)
+		metrics = c.deltas.add(metrics, "HostContextSwitches", nil, uint64(misc.Ctxt))
+		c.deltas.next()
+	}
+	if threads, err := c.threads(); err == nil {
+		metrics = append(metrics, models.Metric{Name: "HostThreads", Type: models.Gauge, Value: float64(threads)})
+	}
+	if used, limit, err := c.fileDescriptors(); err == nil {
+		metrics = append(metrics,
+			models.Metric{Name: "HostFDUsed", Type: models.Gauge, Value: float64(used)},
+			models.Metric{Name: "HostFDMax", Type: models.Gauge, Value: float64(limit)},
+		)
+	}
+	return metrics
+}
+
+// processThreads возвращает суммарное число потоков всех процессов.
+// Процессы, завершившиеся во время обхода, пропускаются.
+func processThreads() (uint64, error) {
+	procs, err := process.Processes()
+	if err != nil {
+		return 0, err
+	}
+	var total uint64
+	for _, p := range procs {
+		if n, err := p.NumThreads(); err == nil {
+			total += uint64(n)
+		}
+	}
+	return total, nil
+}
+
+// fileDescriptors возвращает число используемых дескрипторов и системный предел из /proc/sys/fs/file-nr.
+func (c *HostCollector) fileDescriptors() (uint64, uint64, error) {
+	fields, err := c.readFields("sys", "fs", "file-nr")
+	if err != nil {
+		return 0, 0, err
+	}
+	if len(fields) < 3 {
+		return 0, 0, strconv.ErrSyntax
+	}
+	var values [3]uint64
+	for i := range values {
+		if values[i], err = strconv.ParseUint(fields[i], 10, 64); err != nil {
+			return 0, 0, err
+		}
+	}
+	allocated, unused, limit := values[0], values[1], values[2]
+	return allocated - min(unused, allocated), limit, nil
+}
+
+func (c *HostCollector) readFields(path ...string) ([]string, error) {
+	data, err := os.ReadFile(filepath.Join(append([]string{c.procDir}, path...)...))
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(string(data)), nil
+}
@@ -0,0 +1,72 @@
+package collector
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	models "github.com/chestorix/monmetrics/internal/metrics"
+	"github.com/shirou/gopsutil/v3/load"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHostCollector_Collect(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "sys", "fs"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "sys", "fs", "file-nr"), []byte("1024\t0\t65536\n"), 0o644))
+
+	c := NewHostCollector()
+	c.procDir = dir
+	c.avg = func() (*load.AvgStat, error) {
+		return &load.AvgStat{Load1: 0.5, Load5: 0.4, Load15: 0.3}, nil
+	}
+	ctxt := 1000
+	c.misc = func() (*load.MiscStat, error) {
+		return &load.MiscStat{ProcsTotal: 120, ProcsRunning: 2, ProcsBlocked: 1, Ctxt: ctxt}, nil
+	}
+	c.uptime = func() (uint64, error) { return 0, errors.New("uptime unavailable") }
+	c.threads = func() (uint64, error) { return 345, nil }
+
+	values := func(metrics []models.Metric) map[string]any {
+		got := make(map[string]any, len(metrics))
+		for _, m := range metrics {
+			got[m.Name] = m.Value
+		}
+		return got
+	}
+
+	assert.Equal(t, map[string]any{
+		"HostLoad1":        0.5,
+		"HostLoad5":        0.4,
+		"HostLoad15":       0.3,
+		"HostProcs":        120.0,
+		"HostProcsRunning": 2.0,
+		"HostProcsBlocked": 1.0,
+		"HostThreads":      345.0,
+		"HostFDUsed":       1024.0,
+		"HostFDMax":        65536.0,
+	}, values(c.Collect()))
+
+	// Misc не смог подсчитать процессы, но вернул остальную статистику.
+	ctxt = 1500
+	c.misc = func() (*load.MiscStat, error) {
+		return &load.MiscStat{ProcsRunning: 3, Ctxt: ctxt}, errors.New("open /proc: too many open files")
+	}
+	got := values(c.Collect())
+	assert.NotContains(t, got, "HostProcs")
+	assert.Equal(t, 3.0, got["HostProcsRunning"])
+	assert.Equal(t, int64(500), got["HostContextSwitches"])
+}
+
+func TestProcessThreads(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("process table is read from /proc")
+	}
+	threads, err := processThreads()
+	require.NoError(t, err)
+	// В таблице процессов есть как минимум процесс теста.
+	assert.Positive(t, threads)
+}
@@ -0,0 +1,87 @@
+// Package collector - содержит логику сбора метрик.
+package collector
+
+import (
+	"sort"
+
+	models "github.com/chestorix/monmetrics/internal/metrics"
+	"github.com/shirou/gopsutil/v3/net"
+)
+
+// NetFilter задает шаблоны filepath.Match имен сетевых интерфейсов, которые учитывает NetCollector.
+// Пустой список Include не ограничивает выборку, список Exclude проверяется после него.
+type NetFilter struct {
+	IncludeInterfaces []string
+	ExcludeInterfaces []string
+}
+
+// NetCollector собирает счетчики сетевых интерфейсов с меткой interface
+// и число TCP-соединений NetTCPConnections с меткой state.
+type NetCollector struct {
+	filter      NetFilter
+	deltas      counterDeltas
+	ioCounters  func(pernic bool) ([]net.IOCountersStat, error)
+	connections func(kind string) ([]net.ConnectionStat, error)
+}
+
+func NewNetCollector(filter NetFilter) *NetCollector {
+	return &NetCollector{
+		filter:      filter,
+		ioCounters:  net.IOCounters,
+		connections: net.Connections,
+	}
+}
+
+// Collect возвращает сетевые метрики. Данные, которые не удалось получить, пропускаются.
+func (c *NetCollector) Collect() []models.Metric {
+	var metrics []models.Metric
+
+	if counters, err := c.ioCounters(true); err == nil {
+		sort.Slice(counters, func(i, j int) bool { return counters[i].Name < counters[j].Name })
+		for _, cur := range counters {
+			if !c.filter.match(cur.Name) {
+				continue
+			}
+			labels := map[string]string{"interface": cur.Name}
+			metrics = c.deltas.add(metrics, "NetBytesSent", labels, cur.BytesSent)
+			metrics = c.deltas.add(metrics, "NetBytesRecv", labels, cur.BytesRecv)
+			metrics = c.deltas.add(metrics, "NetPacketsSent", labels, cur.PacketsSent)
+			metrics = c.deltas.add(metrics, "NetPacketsRecv", labels, cur.PacketsRecv)
+			metrics = c.deltas.add(metrics, "NetErrIn", labels, cur.Errin)
+			metrics = c.deltas.add(metrics, "NetErrOut", labels, cur.Errout)
+			metrics = c.deltas.add(metrics, "NetDropIn", labels, cur.Dropin)
+			metrics = c.deltas.add(metrics, "NetDropOut", labels, cur.Dropout)
+		}
+		c.deltas.next()
+	}
+
+	if conns, err := c.connections("tcp"); err == nil {
+		states := make(map[string]int)
+		for _, conn := range conns {
+			if conn.Status != "" {
+				states[conn.Status]++
+			}
+		}
+		names := make([]string, 0, len(states))
+		for state := range states {
+			names = append(names, state)
+		}
+		sort.Strings(names)
+		for _, state := range names {
+			metrics = append(metrics, models.Metric{
+				Name:   "NetTCPConnections",
+				Type:   models.Gauge,
+				Value:  float64(states[state]),
+				Labels: map[string]string{"state": state},
+			})
+		}
+	}
+	return metrics
+}
+
+func (f NetFilter) match(name string) bool {
+	if len(f.IncludeInterfaces) > 0 && !matchAny(f.IncludeInterfaces, name) {
+		return false
+	}
+	return !matchAny(f.ExcludeInterfaces, name)
+}
@@ -0,0 +1,70 @@
+package collector
+
+import (
+	"errors"
+	"testing"
+
+	models "github.com/chestorix/monmetrics/internal/metrics"
+	"github.com/shirou/gopsutil/v3/net"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNetCollector_Collect(t *testing.T) {
+	c := NewNetCollector(NetFilter{ExcludeInterfaces: []string{"lo", "veth*"}})
+	polls := [][]net.IOCountersStat{
+		{{Name: "lo", BytesSent: 1}, {Name: "eth0", BytesSent: 1000}},
+		{{Name: "lo", BytesSent: 9}, {Name: "eth0", BytesSent: 1600}, {Name: "veth1a2b", BytesSent: 7}, {Name: "eth1", BytesSent: 50}},
+		// eth0 переподключен и начал счет заново, eth1 пропал.
+		{{Name: "eth0", BytesSent: 200}},
+		// eth1 вернулся: его прежнее значение забыто, приращение появится со следующего опроса.
+		{{Name: "eth0", BytesSent: 300}, {Name: "eth1", BytesSent: 80}},
+	}
+	want := []map[string]int64{
+		{},
+		{"eth0": 600},
+		{"eth0": 200},
+		{"eth0": 100},
+	}
+
+	var poll int
+	c.ioCounters = func(pernic bool) ([]net.IOCountersStat, error) {
+		assert.True(t, pernic)
+		return polls[poll], nil
+	}
+	c.connections = func(string) ([]net.ConnectionStat, error) {
+		return nil, errors.New("permission denied")
+	}
+	for poll = range polls {
+		sent := make(map[string]int64)
+		for _, m := range c.Collect() {
+			require.Equal(t, models.Counter, m.Type)
+			if m.Name == "NetBytesSent" {
+				sent[m.Labels["interface"]] = m.Value.(int64)
+			}
+		}
+		assert.Equal(t, want[poll], sent, "poll %d", poll)
+	}
+}
+
+func TestNetCollector_Connections(t *testing.T) {
+	c := NewNetCollector(NetFilter{})
+	c.ioCounters = func(bool) ([]net.IOCountersStat, error) { return nil, errors.New("unsupported") }
+	c.connections = func(kind string) ([]net.ConnectionStat, error) {
+		assert.Equal(t, "tcp", kind)
+		return []net.ConnectionStat{{Status: "LISTEN"}, {Status: "ESTABLISHED"}, {Status: "ESTABLISHED"}, {}}, nil
+	}
+
+	assert.Equal(t, []models.Metric{
+		{Name: "NetTCPConnections", Type: models.Gauge, Value: 2.0, Labels: map[string]string{"state": "ESTABLISHED"}},
+		{Name: "NetTCPConnections", Type: models.Gauge, Value: 1.0, Labels: map[string]string{"state": "LISTEN"}},
+	}, c.Collect())
+}
+
+func TestNetFilter_Include(t *testing.T) {
+	f := NetFilter{IncludeInterfaces: []string{"eth*", "wlan0"}, ExcludeInterfaces: []string{"eth9"}}
+	assert.True(t, f.match("eth0"))
+	assert.True(t, f.match("wlan0"))
+	assert.False(t, f.match("eth9"))
+	assert.False(t, f.match("docker0"))
+}
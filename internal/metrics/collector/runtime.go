@@ -8,9 +8,7 @@ import (
 	models "github.com/chestorix/monmetrics/internal/metrics"
 )
 
-type RuntimeCollector struct {
-	pollCount int64
-}
+type RuntimeCollector struct{}
 
 func NewRuntimeCollector() *RuntimeCollector {
 	return &RuntimeCollector{}
@@ -50,14 +48,12 @@ func (c *RuntimeCollector) Collect() []models.Metric {
 		{Name: "TotalAlloc", Type: models.Gauge, Value: float64(stats.TotalAlloc)},
 		{Name: "RandomValue", Type: models.Gauge, Value: rand.Float64()},
 	}
-	metric := metrics
-
-	c.pollCount++
-	metric = append(metric, models.Metric{
+	// PollCount передается как приращение: агент суммирует приращения счетчиков между отправками.
+	metrics = append(metrics, models.Metric{
 		Name:  "PollCount",
 		Type:  models.Counter,
-		Value: c.pollCount,
+		Value: int64(1),
 	})
 
-	return metric
+	return metrics
 }
@@ -0,0 +1,110 @@
+// Package models  содержит бизнес-сущности приложения.
+package models
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidHistogram = errors.New("invalid histogram")
+
+// HistogramValue - распределение значений по интервалам.
+// Bounds - верхние границы интервалов по возрастанию (без +Inf),
+// Counts - количество значений в каждом интервале (не накопительное),
+// последний элемент Counts относится к интервалу (Bounds[len-1], +Inf).
+// Обновления гистограммы передаются как приращения и складываются с сохраненным значением.
+type HistogramValue struct {
+	Bounds []float64 `json:"bounds"`
+	Counts []uint64  `json:"counts"`
+	Sum    float64   `json:"sum"`
+	Count  uint64    `json:"count"`
+}
+
+// Validate проверяет согласованность гистограммы: границы конечны и строго возрастают,
+// количество интервалов на один больше количества границ, Count равен сумме Counts.
+func (h HistogramValue) Validate() error {
+	if len(h.Counts) != len(h.Bounds)+1 {
+		return fmt.Errorf("%w: expected %d counts, got %d", ErrInvalidHistogram, len(h.Bounds)+1, len(h.Counts))
+	}
+	for i, bound := range h.Bounds {
+		if math.IsNaN(bound) || math.IsInf(bound, 0) {
+			return fmt.Errorf("%w: bound %v is not finite", ErrInvalidHistogram, bound)
+		}
+		if i > 0 && bound <= h.Bounds[i-1] {
+			return fmt.Errorf("%w: bounds must be strictly increasing", ErrInvalidHistogram)
+		}
+	}
+	var total uint64
+	for _, c := range h.Counts {
+		total += c
+	}
+	if total != h.Count {
+		return fmt.Errorf("%w: count %d does not match buckets total %d", ErrInvalidHistogram, h.Count, total)
+	}
+	if math.IsNaN(h.Sum) {
+		return fmt.Errorf("%w: sum is NaN", ErrInvalidHistogram)
+	}
+	return nil
+}
+
+// Merge складывает приращение delta с гистограммой. Границы интервалов должны совпадать.
+func (h HistogramValue) Merge(delta HistogramValue) (HistogramValue, error) {
+	if !h.SameBounds(delta) {
+		return h, fmt.Errorf("%w: bucket bounds differ from stored histogram", ErrInvalidHistogram)
+	}
+	merged := HistogramValue{
+		Bounds: append([]float64(nil), h.Bounds...),
+		Counts: make([]uint64, len(h.Counts)),
+		Sum:    h.Sum + delta.Sum,
+		Count:  h.Count + delta.Count,
+	}
+	for i := range h.Counts {
+		merged.Counts[i] = h.Counts[i] + delta.Counts[i]
+	}
+	return merged, nil
+}
+
+// SameBounds проверяет, что у гистограмм одинаковые границы интервалов.
+func (h HistogramValue) SameBounds(other HistogramValue) bool {
+	if len(h.Bounds) != len(other.Bounds) {
+		return false
+	}
+	for i := range h.Bounds {
+		if h.Bounds[i] != other.Bounds[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Cumulative возвращает накопительные количества значений для каждой границы, включая +Inf.
+func (h HistogramValue) Cumulative() []uint64 {
+	cumulative := make([]uint64, len(h.Counts))
+	var total uint64
+	for i, c := range h.Counts {
+		total += c
+		cumulative[i] = total
+	}
+	return cumulative
+}
+
+// String форматирует гистограмму для отображения: count, sum и накопительное количество значений для каждой границы.
+func (h HistogramValue) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "count=%d sum=%s buckets{", h.Count, strconv.FormatFloat(h.Sum, 'g', -1, 64))
+	for i, c := range h.Cumulative() {
+		le := "+Inf"
+		if i < len(h.Bounds) {
+			le = strconv.FormatFloat(h.Bounds[i], 'g', -1, 64)
+		}
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		fmt.Fprintf(&b, "%s:%d", le, c)
+	}
+	b.WriteByte('}')
+	return b.String()
+}
@@ -0,0 +1,34 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistogramValue_Merge(t *testing.T) {
+	stored := HistogramValue{Bounds: []float64{0.1, 0.5}, Counts: []uint64{2, 1, 0}, Sum: 0.6, Count: 3}
+	require.NoError(t, stored.Validate())
+
+	merged, err := stored.Merge(HistogramValue{Bounds: []float64{0.1, 0.5}, Counts: []uint64{0, 1, 1}, Sum: 1.3, Count: 2})
+	require.NoError(t, err)
+	assert.Equal(t, []uint64{2, 2, 1}, merged.Counts)
+	assert.Equal(t, uint64(5), merged.Count)
+	assert.InDelta(t, 1.9, merged.Sum, 1e-9)
+	assert.Equal(t, []uint64{2, 4, 5}, merged.Cumulative())
+	assert.Equal(t, "count=5 sum=1.9 buckets{0.1:2 0.5:4 +Inf:5}", merged.String())
+
+	_, err = stored.Merge(HistogramValue{Bounds: []float64{1}, Counts: []uint64{1, 0}, Count: 1})
+	assert.ErrorIs(t, err, ErrInvalidHistogram)
+}
+
+func TestHistogramValue_Validate(t *testing.T) {
+	for _, h := range []HistogramValue{
+		{Bounds: []float64{1}, Counts: []uint64{1}, Count: 1},
+		{Bounds: []float64{1, 1}, Counts: []uint64{0, 0, 0}},
+		{Bounds: []float64{1}, Counts: []uint64{1, 1}, Count: 1},
+	} {
+		assert.ErrorIs(t, h.Validate(), ErrInvalidHistogram)
+	}
+}
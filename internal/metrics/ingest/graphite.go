@@ -0,0 +1,68 @@
+// Package ingest содержит разбор сторонних форматов метрик и их преобразование в модель monmetrics.
+package ingest
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	models "github.com/chestorix/monmetrics/internal/metrics"
+)
+
+// ParseGraphiteLine разбирает строку Graphite plaintext протокола: "path value [timestamp]".
+// Метрика сохраняется как gauge с именем path. Timestamp задается в секундах unix,
+// значения -1 и N, как и отсутствие timestamp, означают время получения.
+// Теги в формате path;tag=value сохраняются как метки.
+// Строки с недопустимым именем или метками отклоняются, чтобы не попасть в пакет сохранения.
+func ParseGraphiteLine(line string) (models.Metrics, error) {
+	parts := strings.Fields(line)
+	if len(parts) != 2 && len(parts) != 3 {
+		return models.Metrics{}, fmt.Errorf("%w: expected \"path value [timestamp]\"", ErrInvalidPayload)
+	}
+
+	path := strings.Split(parts[0], ";")
+	name := path[0]
+	if name == "" {
+		return models.Metrics{}, fmt.Errorf("%w: empty path", ErrInvalidPayload)
+	}
+	if err := models.ValidateName(name); err != nil {
+		return models.Metrics{}, fmt.Errorf("%w: %v", ErrInvalidPayload, err)
+	}
+	var labels map[string]string
+	for _, tag := range path[1:] {
+		label, value, ok := strings.Cut(tag, "=")
+		if !ok || label == "" || value == "" {
+			return models.Metrics{}, fmt.Errorf("%w: invalid tag %q", ErrInvalidPayload, tag)
+		}
+		if labels == nil {
+			labels = make(map[string]string)
+		}
+		labels[models.SanitizeLabelName(label)] = value
+	}
+	if err := models.ValidateLabels(labels); err != nil {
+		return models.Metrics{}, fmt.Errorf("%w: %v", ErrInvalidPayload, err)
+	}
+
+	value, err := strconv.ParseFloat(parts[1], 64)
+	if err != nil || math.IsNaN(value) {
+		return models.Metrics{}, fmt.Errorf("%w: invalid value %q", ErrInvalidPayload, parts[1])
+	}
+
+	metric := models.Metrics{
+		ID:     name,
+		MType:  models.Gauge,
+		Value:  &value,
+		Labels: labels,
+	}
+
+	if len(parts) == 3 && parts[2] != "-1" && parts[2] != "N" {
+		seconds, err := strconv.ParseFloat(parts[2], 64)
+		if err != nil {
+			return models.Metrics{}, fmt.Errorf("%w: invalid timestamp %q", ErrInvalidPayload, parts[2])
+		}
+		millis := int64(seconds * 1000)
+		metric.Timestamp = &millis
+	}
+	return metric, nil
+}
@@ -0,0 +1,28 @@
+package ingest
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseGraphiteLine(t *testing.T) {
+	metric, err := ParseGraphiteLine("backup.duration_seconds 12.5 1700000000")
+	require.NoError(t, err)
+	assert.Equal(t, "backup.duration_seconds", metric.ID)
+	assert.Equal(t, "gauge", metric.MType)
+	assert.Equal(t, 12.5, *metric.Value)
+	assert.Equal(t, int64(1700000000000), *metric.Timestamp)
+
+	metric, err = ParseGraphiteLine("jobs.queued;env=prod 3 -1")
+	require.NoError(t, err)
+	assert.Equal(t, "jobs.queued", metric.ID)
+	assert.Equal(t, map[string]string{"env": "prod"}, metric.Labels)
+	assert.Nil(t, metric.Timestamp)
+
+	for _, line := range []string{"jobs.queued", "jobs.queued abc", "jobs.queued 1 yesterday", "a 1 2 3", "jobs nan", "jobs;env 1", "jobs{env} 1", `"jobs" 1`} {
+		_, err := ParseGraphiteLine(line)
+		assert.ErrorIs(t, err, ErrInvalidPayload, line)
+	}
+}
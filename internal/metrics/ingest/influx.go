@@ -0,0 +1,213 @@
+// Package ingest содержит разбор сторонних форматов метрик и их преобразование в модель monmetrics.
+package ingest
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	models "github.com/chestorix/monmetrics/internal/metrics"
+)
+
+// linePoint - одна строка InfluxDB line protocol.
+type linePoint struct {
+	tags        map[string]string
+	fields      map[string]float64
+	timestamp   *int64
+	measurement string
+}
+
+// ParseLineProtocol разбирает данные в формате InfluxDB line protocol:
+//
+//	measurement[,tag=value...] field=value[,field=value...] [timestamp]
+//
+// Каждое числовое или логическое поле становится gauge с именем measurement_field
+// и метками из тегов строки: значения line protocol абсолютные, поэтому целые поля тоже сохраняются как gauge.
+// Строковые поля пропускаются. precision задает единицы времени timestamp
+// (ns, us, ms, s, а также n, u, m, h из API InfluxDB v1), по умолчанию ns.
+func ParseLineProtocol(data []byte, precision string) ([]models.Metrics, error) {
+	unit, err := precisionUnit(precision)
+	if err != nil {
+		return nil, err
+	}
+
+	var metrics []models.Metrics
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		point, err := parseLine(line, unit)
+		if err != nil {
+			return nil, fmt.Errorf("%w: line %d: %v", ErrInvalidPayload, lineNum, err)
+		}
+		for field, value := range point.fields {
+			metrics = append(metrics, models.Metrics{
+				ID:        point.measurement + "_" + field,
+				MType:     models.Gauge,
+				Value:     &value,
+				Timestamp: point.timestamp,
+				Labels:    point.tags,
+			})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPayload, err)
+	}
+	return metrics, nil
+}
+
+func precisionUnit(precision string) (time.Duration, error) {
+	switch precision {
+	case "", "ns", "n":
+		return time.Nanosecond, nil
+	case "us", "u":
+		return time.Microsecond, nil
+	case "ms":
+		return time.Millisecond, nil
+	case "s":
+		return time.Second, nil
+	case "m":
+		return time.Minute, nil
+	case "h":
+		return time.Hour, nil
+	default:
+		return 0, fmt.Errorf("%w: unknown precision %q", ErrInvalidPayload, precision)
+	}
+}
+
+func parseLine(line string, unit time.Duration) (linePoint, error) {
+	sections := splitUnescaped(line, ' ', true)
+	if len(sections) != 2 && len(sections) != 3 {
+		return linePoint{}, fmt.Errorf("expected measurement, fields and optional timestamp")
+	}
+
+	point := linePoint{
+		tags:   make(map[string]string),
+		fields: make(map[string]float64),
+	}
+
+	key := splitUnescaped(sections[0], ',', false)
+	point.measurement = unescape(key[0])
+	if point.measurement == "" {
+		return linePoint{}, fmt.Errorf("missing measurement")
+	}
+	for _, tag := range key[1:] {
+		name, value, ok := cutUnescaped(tag, '=')
+		if !ok || name == "" || value == "" {
+			return linePoint{}, fmt.Errorf("invalid tag %q", tag)
+		}
+		point.tags[models.SanitizeLabelName(unescape(name))] = unescape(value)
+	}
+
+	for _, field := range splitUnescaped(sections[1], ',', true) {
+		name, raw, ok := cutUnescaped(field, '=')
+		if !ok || name == "" || raw == "" {
+			return linePoint{}, fmt.Errorf("invalid field %q", field)
+		}
+		value, numeric, err := parseFieldValue(raw)
+		if err != nil {
+			return linePoint{}, fmt.Errorf("field %q: %v", name, err)
+		}
+		if numeric {
+			point.fields[unescape(name)] = value
+		}
+	}
+
+	if len(sections) == 3 {
+		ts, err := strconv.ParseInt(sections[2], 10, 64)
+		if err != nil {
+			return linePoint{}, fmt.Errorf("invalid timestamp %q", sections[2])
+		}
+		millis := toMillis(ts, unit)
+		point.timestamp = &millis
+	}
+	return point, nil
+}
+
+// toMillis переводит время в единицах unit в миллисекунды.
+func toMillis(ts int64, unit time.Duration) int64 {
+	if unit >= time.Millisecond {
+		return ts * int64(unit/time.Millisecond)
+	}
+	return ts / int64(time.Millisecond/unit)
+}
+
+// parseFieldValue разбирает значение поля. Второй результат false означает строковое поле.
+func parseFieldValue(raw string) (float64, bool, error) {
+	switch raw {
+	case "t", "T", "true", "True", "TRUE":
+		return 1, true, nil
+	case "f", "F", "false", "False", "FALSE":
+		return 0, true, nil
+	}
+	if strings.HasPrefix(raw, `"`) {
+		if len(raw) < 2 || !strings.HasSuffix(raw, `"`) {
+			return 0, false, fmt.Errorf("unterminated string")
+		}
+		return 0, false, nil
+	}
+	switch raw[len(raw)-1] {
+	case 'i':
+		v, err := strconv.ParseInt(raw[:len(raw)-1], 10, 64)
+		return float64(v), err == nil, err
+	case 'u':
+		v, err := strconv.ParseUint(raw[:len(raw)-1], 10, 64)
+		return float64(v), err == nil, err
+	}
+	v, err := strconv.ParseFloat(raw, 64)
+	return v, err == nil, err
+}
+
+// splitUnescaped разбивает строку по разделителю sep, не учитывая экранированные символы
+// и, если quotes, разделители внутри строк в двойных кавычках.
+func splitUnescaped(s string, sep byte, quotes bool) []string {
+	var parts []string
+	inQuote := false
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\':
+			i++
+		case quotes && s[i] == '"':
+			inQuote = !inQuote
+		case s[i] == sep && !inQuote:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// cutUnescaped делит строку по первому неэкранированному символу sep.
+func cutUnescaped(s string, sep byte) (string, string, bool) {
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case sep:
+			return s[:i], s[i+1:], true
+		}
+	}
+	return s, "", false
+}
+
+// unescape убирает экранирование запятых, пробелов, знаков равенства, кавычек и обратных слэшей.
+func unescape(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) && strings.IndexByte(`, ="\`, s[i+1]) >= 0 {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
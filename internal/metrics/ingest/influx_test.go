@@ -0,0 +1,61 @@
+package ingest
+
+import (
+	"sort"
+	"testing"
+
+	models "github.com/chestorix/monmetrics/internal/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLineProtocol(t *testing.T) {
+	data := []byte(`# comment
+cpu,host=web-1,region=eu usage_idle=97.5,usage_user=1i,enabled=true 1700000000000000000
+disk\ io,path=/var\,log reads=10u,label="a b,c" 1700000000
+mem free=42
+`)
+
+	metrics, err := ParseLineProtocol(data, "")
+	require.NoError(t, err)
+
+	sort.Slice(metrics, func(i, j int) bool { return metrics[i].ID < metrics[j].ID })
+	ids := make([]string, len(metrics))
+	for i, m := range metrics {
+		ids[i] = m.ID
+		assert.Equal(t, models.Gauge, m.MType)
+	}
+	assert.Equal(t, []string{"cpu_enabled", "cpu_usage_idle", "cpu_usage_user", "disk io_reads", "mem_free"}, ids)
+
+	assert.Equal(t, 1.0, *metrics[0].Value)
+	assert.Equal(t, int64(1700000000000), *metrics[0].Timestamp)
+	assert.Equal(t, 97.5, *metrics[1].Value)
+	assert.Equal(t, map[string]string{"host": "web-1", "region": "eu"}, metrics[1].Labels)
+	assert.Equal(t, 10.0, *metrics[3].Value)
+	assert.Equal(t, int64(1700), *metrics[3].Timestamp)
+	assert.Nil(t, metrics[4].Timestamp)
+}
+
+func TestParseLineProtocol_Precision(t *testing.T) {
+	metrics, err := ParseLineProtocol([]byte("mem free=42 1700000000"), "s")
+	require.NoError(t, err)
+	require.Len(t, metrics, 1)
+	assert.Equal(t, int64(1700000000000), *metrics[0].Timestamp)
+}
+
+func TestParseLineProtocol_Invalid(t *testing.T) {
+	tests := []string{
+		"cpu",
+		"cpu usage",
+		"cpu usage=abc",
+		"cpu,host usage=1",
+		"cpu usage=1 notatime",
+		`cpu msg="unterminated`,
+	}
+	for _, line := range tests {
+		t.Run(line, func(t *testing.T) {
+			_, err := ParseLineProtocol([]byte(line), "")
+			assert.ErrorIs(t, err, ErrInvalidPayload)
+		})
+	}
+}
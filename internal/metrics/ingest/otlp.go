@@ -0,0 +1,334 @@
+// Package ingest содержит разбор сторонних форматов метрик и их преобразование в модель monmetrics.
+package ingest
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+
+	models "github.com/chestorix/monmetrics/internal/metrics"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Значения перечисления AggregationTemporality и маска флага NO_RECORDED_VALUE точек OTLP.
+const (
+	otlpTemporalityDelta      otlpTemporality = 1
+	otlpTemporalityCumulative otlpTemporality = 2
+	otlpNoRecordedValue       uint32          = 1
+)
+
+// OTLPRequest - поддерживаемая часть запроса ExportMetricsServiceRequest.
+// Запрос разбирается вручную, без сгенерированного кода OTLP, который тянет за собой gRPC:
+// protobuf - через protowire, как remote_write, JSON - по правилам отображения protobuf в JSON.
+type OTLPRequest struct {
+	ResourceMetrics []otlpResourceMetrics `json:"resourceMetrics"`
+}
+
+type otlpResourceMetrics struct {
+	Resource     otlpResource       `json:"resource"`
+	ScopeMetrics []otlpScopeMetrics `json:"scopeMetrics"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeMetrics struct {
+	Metrics []otlpMetric `json:"metrics"`
+}
+
+type otlpMetric struct {
+	Gauge                *otlpGauge      `json:"gauge"`
+	Sum                  *otlpSum        `json:"sum"`
+	Histogram            *otlpHistogram  `json:"histogram"`
+	ExponentialHistogram *otlpDataPoints `json:"exponentialHistogram"`
+	Summary              *otlpDataPoints `json:"summary"`
+	Name                 string          `json:"name"`
+}
+
+type otlpGauge struct {
+	DataPoints []otlpNumberDataPoint `json:"dataPoints"`
+}
+
+type otlpSum struct {
+	DataPoints             []otlpNumberDataPoint `json:"dataPoints"`
+	AggregationTemporality otlpTemporality       `json:"aggregationTemporality"`
+	IsMonotonic            bool                  `json:"isMonotonic"`
+}
+
+type otlpHistogram struct {
+	DataPoints             []otlpHistogramDataPoint `json:"dataPoints"`
+	AggregationTemporality otlpTemporality          `json:"aggregationTemporality"`
+}
+
+// otlpDataPoints - метрика неподдерживаемого типа, от которой нужно только количество точек.
+type otlpDataPoints struct {
+	DataPoints []struct{} `json:"dataPoints"`
+}
+
+type otlpNumberDataPoint struct {
+	Attributes   []otlpKeyValue `json:"attributes"`
+	AsDouble     *otlpDouble    `json:"asDouble"`
+	AsInt        *otlpInt64     `json:"asInt"`
+	TimeUnixNano otlpUint64     `json:"timeUnixNano"`
+	Flags        uint32         `json:"flags"`
+}
+
+type otlpHistogramDataPoint struct {
+	Attributes     []otlpKeyValue `json:"attributes"`
+	BucketCounts   []otlpUint64   `json:"bucketCounts"`
+	ExplicitBounds []otlpDouble   `json:"explicitBounds"`
+	TimeUnixNano   otlpUint64     `json:"timeUnixNano"`
+	Count          otlpUint64     `json:"count"`
+	Sum            otlpDouble     `json:"sum"`
+	Flags          uint32         `json:"flags"`
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpAnyValue struct {
+	StringValue *string     `json:"stringValue"`
+	BoolValue   *bool       `json:"boolValue"`
+	IntValue    *otlpInt64  `json:"intValue"`
+	DoubleValue *otlpDouble `json:"doubleValue"`
+}
+
+// DecodeOTLP разбирает запрос OTLP/HTTP ExportMetricsServiceRequest в формате protobuf или JSON.
+// Неизвестные поля пропускаются.
+func DecodeOTLP(data []byte, isJSON bool) (*OTLPRequest, error) {
+	req := &OTLPRequest{}
+	var err error
+	if isJSON {
+		err = json.Unmarshal(data, req)
+	} else {
+		err = decodeOTLPRequest(data, req)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPayload, err)
+	}
+	return req, nil
+}
+
+// ConvertOTLP преобразует точки OTLP в метрики monmetrics:
+//   - Gauge сохраняется как gauge;
+//   - Sum с дельта-темпоральностью сохраняется как counter (дробные значения округляются);
+//   - монотонный Sum с кумулятивной темпоральностью сохраняется как counter с операцией cumulative,
+//     сервер переводит накопленный итог в приращение;
+//   - немонотонный Sum с кумулятивной темпоральностью содержит абсолютное значение и сохраняется как gauge;
+//   - Histogram с дельта-темпоральностью сохраняется как histogram.
+//
+// Остальные типы точек (кумулятивные и экспоненциальные гистограммы, summary) не поддерживаются,
+// их количество возвращается как rejected.
+// Атрибуты точек сохраняются как метки, имена атрибутов приводятся к допустимому виду.
+// Из атрибутов ресурса сохраняется только service.name - в метке service_name.
+func ConvertOTLP(req *OTLPRequest) ([]models.Metrics, int64) {
+	var metrics []models.Metrics
+	var rejected int64
+	for _, rm := range req.ResourceMetrics {
+		var service string
+		for _, attr := range rm.Resource.Attributes {
+			if attr.Key == "service.name" && attr.Value.StringValue != nil {
+				service = *attr.Value.StringValue
+			}
+		}
+		for _, sm := range rm.ScopeMetrics {
+			for _, m := range sm.Metrics {
+				switch {
+				case m.Gauge != nil:
+					for _, dp := range m.Gauge.DataPoints {
+						if metric, ok := otlpGaugeMetric(m.Name, dp); ok {
+							metric.Labels = otlpLabels(dp.Attributes, service)
+							metrics = append(metrics, metric)
+						}
+					}
+				case m.Sum != nil:
+					delta := m.Sum.AggregationTemporality == otlpTemporalityDelta
+					cumulative := !delta && m.Sum.IsMonotonic
+					for _, dp := range m.Sum.DataPoints {
+						var metric models.Metrics
+						var ok bool
+						switch {
+						case delta:
+							metric, ok = otlpCounterMetric(m.Name, dp)
+						case cumulative:
+							metric, ok = otlpCounterMetric(m.Name, dp)
+							metric.Op = models.CounterCumulative
+						default:
+							metric, ok = otlpGaugeMetric(m.Name, dp)
+						}
+						if ok {
+							metric.Labels = otlpLabels(dp.Attributes, service)
+							metrics = append(metrics, metric)
+						}
+					}
+				case m.Histogram != nil:
+					if m.Histogram.AggregationTemporality != otlpTemporalityDelta {
+						rejected += int64(len(m.Histogram.DataPoints))
+						continue
+					}
+					for _, dp := range m.Histogram.DataPoints {
+						metric, ok := otlpHistogramMetric(m.Name, dp)
+						if !ok {
+							rejected++
+							continue
+						}
+						metric.Labels = otlpLabels(dp.Attributes, service)
+						metrics = append(metrics, metric)
+					}
+				case m.ExponentialHistogram != nil:
+					rejected += int64(len(m.ExponentialHistogram.DataPoints))
+				case m.Summary != nil:
+					rejected += int64(len(m.Summary.DataPoints))
+				}
+			}
+		}
+	}
+	return metrics, rejected
+}
+
+// EncodeOTLPResponse кодирует ответ ExportMetricsServiceResponse в формате protobuf или JSON.
+// Если точки отклонены, в ответ добавляется partial_success с их количеством и сообщением message.
+func EncodeOTLPResponse(rejected int64, message string, isJSON bool) ([]byte, error) {
+	if isJSON {
+		type partialSuccess struct {
+			ErrorMessage       string `json:"errorMessage,omitempty"`
+			RejectedDataPoints int64  `json:"rejectedDataPoints,string"`
+		}
+		var resp struct {
+			PartialSuccess *partialSuccess `json:"partialSuccess,omitempty"`
+		}
+		if rejected > 0 {
+			resp.PartialSuccess = &partialSuccess{RejectedDataPoints: rejected, ErrorMessage: message}
+		}
+		return json.Marshal(resp)
+	}
+
+	if rejected == 0 {
+		return []byte{}, nil
+	}
+	var partial []byte
+	partial = protowire.AppendTag(partial, 1, protowire.VarintType)
+	partial = protowire.AppendVarint(partial, uint64(rejected))
+	partial = protowire.AppendTag(partial, 2, protowire.BytesType)
+	partial = protowire.AppendString(partial, message)
+	resp := protowire.AppendTag(nil, 1, protowire.BytesType)
+	return protowire.AppendBytes(resp, partial), nil
+}
+
+func otlpGaugeMetric(name string, dp otlpNumberDataPoint) (models.Metrics, bool) {
+	if dp.Flags&otlpNoRecordedValue != 0 {
+		return models.Metrics{}, false
+	}
+	var value float64
+	switch {
+	case dp.AsDouble != nil:
+		value = float64(*dp.AsDouble)
+	case dp.AsInt != nil:
+		value = float64(*dp.AsInt)
+	default:
+		return models.Metrics{}, false
+	}
+	return models.Metrics{
+		ID:        name,
+		MType:     models.Gauge,
+		Value:     &value,
+		Timestamp: otlpTimestamp(dp.TimeUnixNano),
+	}, true
+}
+
+func otlpCounterMetric(name string, dp otlpNumberDataPoint) (models.Metrics, bool) {
+	if dp.Flags&otlpNoRecordedValue != 0 {
+		return models.Metrics{}, false
+	}
+	var delta int64
+	switch {
+	case dp.AsDouble != nil:
+		delta = int64(math.Round(float64(*dp.AsDouble)))
+	case dp.AsInt != nil:
+		delta = int64(*dp.AsInt)
+	default:
+		return models.Metrics{}, false
+	}
+	return models.Metrics{
+		ID:        name,
+		MType:     models.Counter,
+		Delta:     &delta,
+		Timestamp: otlpTimestamp(dp.TimeUnixNano),
+	}, true
+}
+
+func otlpHistogramMetric(name string, dp otlpHistogramDataPoint) (models.Metrics, bool) {
+	if dp.Flags&otlpNoRecordedValue != 0 {
+		return models.Metrics{}, false
+	}
+	hist := models.HistogramValue{
+		Sum:   float64(dp.Sum),
+		Count: uint64(dp.Count),
+	}
+	for _, bound := range dp.ExplicitBounds {
+		hist.Bounds = append(hist.Bounds, float64(bound))
+	}
+	for _, count := range dp.BucketCounts {
+		hist.Counts = append(hist.Counts, uint64(count))
+	}
+	if len(hist.Bounds) == 0 && len(hist.Counts) == 0 {
+		hist.Counts = []uint64{hist.Count}
+	}
+	if hist.Validate() != nil {
+		return models.Metrics{}, false
+	}
+	return models.Metrics{
+		ID:        name,
+		MType:     models.Histogram,
+		Histogram: &hist,
+		Timestamp: otlpTimestamp(dp.TimeUnixNano),
+	}, true
+}
+
+// otlpLabels преобразует атрибуты точки в метки. Значения, не являющиеся строками,
+// записываются в текстовом виде; пустые значения пропускаются.
+func otlpLabels(attrs []otlpKeyValue, service string) map[string]string {
+	if len(attrs) == 0 && service == "" {
+		return nil
+	}
+	labels := make(map[string]string, len(attrs)+1)
+	if service != "" {
+		labels["service_name"] = service
+	}
+	for _, attr := range attrs {
+		value := attr.Value.String()
+		if value == "" {
+			continue
+		}
+		labels[models.SanitizeLabelName(attr.Key)] = value
+	}
+	return labels
+}
+
+// String возвращает значение атрибута в текстовом виде. Массивы, списки и байты не поддерживаются.
+func (v otlpAnyValue) String() string {
+	switch {
+	case v.StringValue != nil:
+		return *v.StringValue
+	case v.BoolValue != nil:
+		return strconv.FormatBool(*v.BoolValue)
+	case v.IntValue != nil:
+		return strconv.FormatInt(int64(*v.IntValue), 10)
+	case v.DoubleValue != nil:
+		return strconv.FormatFloat(float64(*v.DoubleValue), 'g', -1, 64)
+	default:
+		return ""
+	}
+}
+
+func otlpTimestamp(nanos otlpUint64) *int64 {
+	if nanos == 0 {
+		return nil
+	}
+	millis := int64(nanos / 1e6)
+	return &millis
+}
@@ -0,0 +1,311 @@
+package ingest
+
+import (
+	"encoding/json"
+	"math"
+	"strconv"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Разбор ExportMetricsServiceRequest из protobuf. Номера полей соответствуют
+// opentelemetry/proto/metrics/v1/metrics.proto и common/v1/common.proto.
+// Поля с неожиданным типом и неизвестные поля пропускаются.
+
+func decodeOTLPRequest(data []byte, req *OTLPRequest) error {
+	return walkMessage(data, func(f protoField) error {
+		if f.num != 1 || f.typ != protowire.BytesType {
+			return nil
+		}
+		var rm otlpResourceMetrics
+		if err := decodeResourceMetrics(f.bytes, &rm); err != nil {
+			return err
+		}
+		req.ResourceMetrics = append(req.ResourceMetrics, rm)
+		return nil
+	})
+}
+
+func decodeResourceMetrics(data []byte, rm *otlpResourceMetrics) error {
+	return walkMessage(data, func(f protoField) error {
+		if f.typ != protowire.BytesType {
+			return nil
+		}
+		switch f.num {
+		case 1:
+			return walkMessage(f.bytes, func(f protoField) error {
+				if f.num != 1 || f.typ != protowire.BytesType {
+					return nil
+				}
+				attr, err := decodeKeyValue(f.bytes)
+				rm.Resource.Attributes = append(rm.Resource.Attributes, attr)
+				return err
+			})
+		case 2:
+			var sm otlpScopeMetrics
+			err := walkMessage(f.bytes, func(f protoField) error {
+				if f.num != 2 || f.typ != protowire.BytesType {
+					return nil
+				}
+				var m otlpMetric
+				if err := decodeMetric(f.bytes, &m); err != nil {
+					return err
+				}
+				sm.Metrics = append(sm.Metrics, m)
+				return nil
+			})
+			rm.ScopeMetrics = append(rm.ScopeMetrics, sm)
+			return err
+		}
+		return nil
+	})
+}
+
+func decodeMetric(data []byte, m *otlpMetric) error {
+	return walkMessage(data, func(f protoField) error {
+		if f.typ != protowire.BytesType {
+			return nil
+		}
+		switch f.num {
+		case 1:
+			m.Name = string(f.bytes)
+		case 5:
+			m.Gauge = &otlpGauge{}
+			return walkMessage(f.bytes, func(f protoField) error {
+				if f.num != 1 || f.typ != protowire.BytesType {
+					return nil
+				}
+				dp, err := decodeNumberDataPoint(f.bytes)
+				m.Gauge.DataPoints = append(m.Gauge.DataPoints, dp)
+				return err
+			})
+		case 7:
+			m.Sum = &otlpSum{}
+			return walkMessage(f.bytes, func(f protoField) error {
+				switch {
+				case f.num == 1 && f.typ == protowire.BytesType:
+					dp, err := decodeNumberDataPoint(f.bytes)
+					m.Sum.DataPoints = append(m.Sum.DataPoints, dp)
+					return err
+				case f.num == 2 && f.typ == protowire.VarintType:
+					m.Sum.AggregationTemporality = otlpTemporality(f.scalar)
+				case f.num == 3 && f.typ == protowire.VarintType:
+					m.Sum.IsMonotonic = f.scalar != 0
+				}
+				return nil
+			})
+		case 9:
+			m.Histogram = &otlpHistogram{}
+			return walkMessage(f.bytes, func(f protoField) error {
+				switch {
+				case f.num == 1 && f.typ == protowire.BytesType:
+					dp, err := decodeHistogramDataPoint(f.bytes)
+					m.Histogram.DataPoints = append(m.Histogram.DataPoints, dp)
+					return err
+				case f.num == 2 && f.typ == protowire.VarintType:
+					m.Histogram.AggregationTemporality = otlpTemporality(f.scalar)
+				}
+				return nil
+			})
+		case 10:
+			m.ExponentialHistogram = &otlpDataPoints{}
+			return countDataPoints(f.bytes, m.ExponentialHistogram)
+		case 11:
+			m.Summary = &otlpDataPoints{}
+			return countDataPoints(f.bytes, m.Summary)
+		}
+		return nil
+	})
+}
+
+// countDataPoints учитывает точки метрики неподдерживаемого типа, не разбирая их.
+func countDataPoints(data []byte, points *otlpDataPoints) error {
+	return walkMessage(data, func(f protoField) error {
+		if f.num == 1 && f.typ == protowire.BytesType {
+			points.DataPoints = append(points.DataPoints, struct{}{})
+		}
+		return nil
+	})
+}
+
+func decodeNumberDataPoint(data []byte) (otlpNumberDataPoint, error) {
+	var dp otlpNumberDataPoint
+	err := walkMessage(data, func(f protoField) error {
+		switch {
+		case f.num == 3 && f.typ == protowire.Fixed64Type:
+			dp.TimeUnixNano = otlpUint64(f.scalar)
+		case f.num == 4 && f.typ == protowire.Fixed64Type:
+			value := otlpDouble(math.Float64frombits(f.scalar))
+			dp.AsDouble, dp.AsInt = &value, nil
+		case f.num == 6 && f.typ == protowire.Fixed64Type:
+			value := otlpInt64(f.scalar)
+			dp.AsInt, dp.AsDouble = &value, nil
+		case f.num == 7 && f.typ == protowire.BytesType:
+			attr, err := decodeKeyValue(f.bytes)
+			dp.Attributes = append(dp.Attributes, attr)
+			return err
+		case f.num == 8 && f.typ == protowire.VarintType:
+			dp.Flags = uint32(f.scalar)
+		}
+		return nil
+	})
+	return dp, err
+}
+
+func decodeHistogramDataPoint(data []byte) (otlpHistogramDataPoint, error) {
+	var dp otlpHistogramDataPoint
+	err := walkMessage(data, func(f protoField) error {
+		switch {
+		case f.num == 3 && f.typ == protowire.Fixed64Type:
+			dp.TimeUnixNano = otlpUint64(f.scalar)
+		case f.num == 4 && f.typ == protowire.Fixed64Type:
+			dp.Count = otlpUint64(f.scalar)
+		case f.num == 5 && f.typ == protowire.Fixed64Type:
+			dp.Sum = otlpDouble(math.Float64frombits(f.scalar))
+		case f.num == 6:
+			return repeatedFixed64(f, func(v uint64) {
+				dp.BucketCounts = append(dp.BucketCounts, otlpUint64(v))
+			})
+		case f.num == 7:
+			return repeatedFixed64(f, func(v uint64) {
+				dp.ExplicitBounds = append(dp.ExplicitBounds, otlpDouble(math.Float64frombits(v)))
+			})
+		case f.num == 9 && f.typ == protowire.BytesType:
+			attr, err := decodeKeyValue(f.bytes)
+			dp.Attributes = append(dp.Attributes, attr)
+			return err
+		case f.num == 10 && f.typ == protowire.VarintType:
+			dp.Flags = uint32(f.scalar)
+		}
+		return nil
+	})
+	return dp, err
+}
+
+// repeatedFixed64 передает в fn значения повторяемого поля fixed64 или double,
+// записанного как упакованным, так и отдельными значениями.
+func repeatedFixed64(f protoField, fn func(v uint64)) error {
+	switch f.typ {
+	case protowire.Fixed64Type:
+		fn(f.scalar)
+	case protowire.BytesType:
+		for data := f.bytes; len(data) > 0; {
+			v, n := protowire.ConsumeFixed64(data)
+			if n < 0 {
+				return ErrInvalidPayload
+			}
+			fn(v)
+			data = data[n:]
+		}
+	}
+	return nil
+}
+
+func decodeKeyValue(data []byte) (otlpKeyValue, error) {
+	var kv otlpKeyValue
+	err := walkMessage(data, func(f protoField) error {
+		if f.typ != protowire.BytesType {
+			return nil
+		}
+		switch f.num {
+		case 1:
+			kv.Key = string(f.bytes)
+		case 2:
+			return walkMessage(f.bytes, func(f protoField) error {
+				v := &kv.Value
+				switch {
+				case f.num == 1 && f.typ == protowire.BytesType:
+					value := string(f.bytes)
+					*v = otlpAnyValue{StringValue: &value}
+				case f.num == 2 && f.typ == protowire.VarintType:
+					value := f.scalar != 0
+					*v = otlpAnyValue{BoolValue: &value}
+				case f.num == 3 && f.typ == protowire.VarintType:
+					value := otlpInt64(f.scalar)
+					*v = otlpAnyValue{IntValue: &value}
+				case f.num == 4 && f.typ == protowire.Fixed64Type:
+					value := otlpDouble(math.Float64frombits(f.scalar))
+					*v = otlpAnyValue{DoubleValue: &value}
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+	return kv, err
+}
+
+// Числовые типы JSON-представления OTLP. По правилам отображения protobuf в JSON 64-битные целые
+// передаются строками, double - числом или строкой ("NaN", "Infinity"), а перечисления - числом
+// или именем значения. Принимаются оба варианта.
+type (
+	otlpInt64       int64
+	otlpUint64      uint64
+	otlpDouble      float64
+	otlpTemporality int32
+)
+
+func (v *otlpInt64) UnmarshalJSON(data []byte) error {
+	s, err := jsonScalar(data)
+	if err != nil || s == "" {
+		return err
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	*v = otlpInt64(n)
+	return err
+}
+
+func (v *otlpUint64) UnmarshalJSON(data []byte) error {
+	s, err := jsonScalar(data)
+	if err != nil || s == "" {
+		return err
+	}
+	n, err := strconv.ParseUint(s, 10, 64)
+	*v = otlpUint64(n)
+	return err
+}
+
+func (v *otlpDouble) UnmarshalJSON(data []byte) error {
+	s, err := jsonScalar(data)
+	if err != nil || s == "" {
+		return err
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	*v = otlpDouble(n)
+	return err
+}
+
+func (v *otlpTemporality) UnmarshalJSON(data []byte) error {
+	s, err := jsonScalar(data)
+	if err != nil || s == "" {
+		return err
+	}
+	switch s {
+	case "AGGREGATION_TEMPORALITY_DELTA":
+		*v = otlpTemporalityDelta
+	case "AGGREGATION_TEMPORALITY_CUMULATIVE":
+		*v = otlpTemporalityCumulative
+	case "AGGREGATION_TEMPORALITY_UNSPECIFIED":
+		*v = 0
+	default:
+		n, err := strconv.ParseInt(s, 10, 32)
+		if err != nil {
+			return err
+		}
+		*v = otlpTemporality(n)
+	}
+	return nil
+}
+
+// jsonScalar возвращает значение JSON-скаляра без кавычек. Для null возвращается пустая строка.
+func jsonScalar(data []byte) (string, error) {
+	if string(data) == "null" {
+		return "", nil
+	}
+	if len(data) > 0 && data[0] == '"' {
+		var s string
+		err := json.Unmarshal(data, &s)
+		return s, err
+	}
+	return string(data), nil
+}
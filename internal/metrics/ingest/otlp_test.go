@@ -0,0 +1,179 @@
+package ingest
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func appendMessage(b []byte, num protowire.Number, msg []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, msg)
+}
+
+func encodeStringAttr(key, value string) []byte {
+	var anyValue []byte
+	anyValue = protowire.AppendTag(anyValue, 1, protowire.BytesType)
+	anyValue = protowire.AppendString(anyValue, value)
+	var kv []byte
+	kv = protowire.AppendTag(kv, 1, protowire.BytesType)
+	kv = protowire.AppendString(kv, key)
+	return appendMessage(kv, 2, anyValue)
+}
+
+func TestDecodeAndConvertOTLP_JSON(t *testing.T) {
+	body := []byte(`{
+	  "resourceMetrics": [{
+	    "resource": {"attributes": [{"key": "service.name", "value": {"stringValue": "checkout"}}, {"key": "host.name", "value": {"stringValue": "web-1"}}]},
+	    "scopeMetrics": [{
+	      "metrics": [
+	        {"name": "queue.size", "gauge": {"dataPoints": [{"asDouble": 12.5, "timeUnixNano": "1700000000000000000"}]}},
+	        {"name": "http.requests", "sum": {"aggregationTemporality": 1, "isMonotonic": true, "dataPoints": [{"asInt": "7", "attributes": [{"key": "http.status_code", "value": {"intValue": "200"}}]}]}},
+	        {"name": "process.cpu.time", "sum": {"aggregationTemporality": 2, "isMonotonic": true, "dataPoints": [{"asDouble": 3.25}]}},
+	        {"name": "db.connections", "sum": {"aggregationTemporality": 2, "dataPoints": [{"asInt": "4"}]}},
+	        {"name": "http.duration", "histogram": {"dataPoints": [{"count": "2"}, {"count": "3"}]}},
+	        {"name": "rpc.duration", "histogram": {"aggregationTemporality": 1, "dataPoints": [{"count": "3", "sum": 0.7, "explicitBounds": [0.1, 0.5], "bucketCounts": ["1", "2", "0"]}]}}
+	      ]
+	    }]
+	  }]
+	}`)
+
+	req, err := DecodeOTLP(body, true)
+	require.NoError(t, err)
+
+	metrics, rejected := ConvertOTLP(req)
+	assert.Equal(t, int64(2), rejected)
+	require.Len(t, metrics, 5)
+
+	assert.Equal(t, "queue.size", metrics[0].ID)
+	assert.Equal(t, "gauge", metrics[0].MType)
+	assert.Equal(t, 12.5, *metrics[0].Value)
+	assert.Equal(t, int64(1700000000000), *metrics[0].Timestamp)
+
+	assert.Equal(t, "http.requests", metrics[1].ID)
+	assert.Equal(t, "counter", metrics[1].MType)
+	assert.Equal(t, int64(7), *metrics[1].Delta)
+	assert.Nil(t, metrics[1].Timestamp)
+	assert.Equal(t, map[string]string{"service_name": "checkout", "http_status_code": "200"}, metrics[1].Labels)
+
+	assert.Equal(t, "process.cpu.time", metrics[2].ID)
+	assert.Equal(t, "counter", metrics[2].MType)
+	assert.Equal(t, "cumulative", metrics[2].Op)
+	assert.Equal(t, int64(3), *metrics[2].Delta)
+
+	assert.Equal(t, "db.connections", metrics[3].ID)
+	assert.Equal(t, "gauge", metrics[3].MType)
+	assert.Equal(t, 4.0, *metrics[3].Value)
+
+	assert.Equal(t, "rpc.duration", metrics[4].ID)
+	assert.Equal(t, "histogram", metrics[4].MType)
+	assert.Equal(t, []uint64{1, 2, 0}, metrics[4].Histogram.Counts)
+	assert.Equal(t, uint64(3), metrics[4].Histogram.Count)
+}
+
+func TestDecodeOTLP_Invalid(t *testing.T) {
+	_, err := DecodeOTLP([]byte("{"), true)
+	assert.ErrorIs(t, err, ErrInvalidPayload)
+
+	_, err = DecodeOTLP([]byte{0x0a, 0xff}, false)
+	assert.ErrorIs(t, err, ErrInvalidPayload)
+}
+
+func TestDecodeAndConvertOTLP_Protobuf(t *testing.T) {
+	var gaugePoint []byte
+	gaugePoint = protowire.AppendTag(gaugePoint, 3, protowire.Fixed64Type)
+	gaugePoint = protowire.AppendFixed64(gaugePoint, 1700000000000000000)
+	gaugePoint = protowire.AppendTag(gaugePoint, 4, protowire.Fixed64Type)
+	gaugePoint = protowire.AppendFixed64(gaugePoint, math.Float64bits(0.5))
+	gaugePoint = appendMessage(gaugePoint, 7, encodeStringAttr("cpu", "0"))
+	gauge := appendMessage(nil, 1, gaugePoint)
+
+	var sumPoint []byte
+	sumPoint = protowire.AppendTag(sumPoint, 6, protowire.Fixed64Type)
+	sumPoint = protowire.AppendFixed64(sumPoint, 42)
+	sum := appendMessage(nil, 1, sumPoint)
+	sum = protowire.AppendTag(sum, 2, protowire.VarintType)
+	sum = protowire.AppendVarint(sum, 2)
+	sum = protowire.AppendTag(sum, 3, protowire.VarintType)
+	sum = protowire.AppendVarint(sum, 1)
+
+	// Границы записаны упакованными, счетчики корзин - отдельными значениями.
+	var bounds []byte
+	bounds = protowire.AppendFixed64(bounds, math.Float64bits(1))
+	var histPoint []byte
+	histPoint = protowire.AppendTag(histPoint, 4, protowire.Fixed64Type)
+	histPoint = protowire.AppendFixed64(histPoint, 5)
+	histPoint = protowire.AppendTag(histPoint, 5, protowire.Fixed64Type)
+	histPoint = protowire.AppendFixed64(histPoint, math.Float64bits(6.5))
+	for _, count := range []uint64{2, 3} {
+		histPoint = protowire.AppendTag(histPoint, 6, protowire.Fixed64Type)
+		histPoint = protowire.AppendFixed64(histPoint, count)
+	}
+	histPoint = appendMessage(histPoint, 7, bounds)
+	hist := appendMessage(nil, 1, histPoint)
+	hist = protowire.AppendTag(hist, 2, protowire.VarintType)
+	hist = protowire.AppendVarint(hist, 1)
+
+	metric := func(name string, num protowire.Number, data []byte) []byte {
+		var m []byte
+		m = protowire.AppendTag(m, 1, protowire.BytesType)
+		m = protowire.AppendString(m, name)
+		return appendMessage(m, num, data)
+	}
+	var scope []byte
+	scope = appendMessage(scope, 2, metric("cpu.load", 5, gauge))
+	scope = appendMessage(scope, 2, metric("bytes.total", 7, sum))
+	scope = appendMessage(scope, 2, metric("latency", 9, hist))
+	scope = appendMessage(scope, 2, metric("rpc.summary", 11, appendMessage(nil, 1, nil)))
+
+	rm := appendMessage(nil, 1, appendMessage(nil, 1, encodeStringAttr("service.name", "api")))
+	rm = appendMessage(rm, 2, scope)
+	body := appendMessage(nil, 1, rm)
+
+	req, err := DecodeOTLP(body, false)
+	require.NoError(t, err)
+
+	metrics, rejected := ConvertOTLP(req)
+	assert.Equal(t, int64(1), rejected)
+	require.Len(t, metrics, 3)
+
+	assert.Equal(t, "cpu.load", metrics[0].ID)
+	assert.Equal(t, 0.5, *metrics[0].Value)
+	assert.Equal(t, int64(1700000000000), *metrics[0].Timestamp)
+	assert.Equal(t, map[string]string{"service_name": "api", "cpu": "0"}, metrics[0].Labels)
+
+	assert.Equal(t, "bytes.total", metrics[1].ID)
+	assert.Equal(t, "cumulative", metrics[1].Op)
+	assert.Equal(t, int64(42), *metrics[1].Delta)
+
+	assert.Equal(t, "latency", metrics[2].ID)
+	assert.Equal(t, []float64{1}, metrics[2].Histogram.Bounds)
+	assert.Equal(t, []uint64{2, 3}, metrics[2].Histogram.Counts)
+	assert.Equal(t, 6.5, metrics[2].Histogram.Sum)
+}
+
+func TestEncodeOTLPResponse(t *testing.T) {
+	body, err := EncodeOTLPResponse(0, "unsupported", true)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{}`, string(body))
+
+	body, err = EncodeOTLPResponse(3, "unsupported", true)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"partialSuccess": {"rejectedDataPoints": "3", "errorMessage": "unsupported"}}`, string(body))
+
+	body, err = EncodeOTLPResponse(0, "unsupported", false)
+	require.NoError(t, err)
+	assert.Empty(t, body)
+
+	body, err = EncodeOTLPResponse(3, "unsupported", false)
+	require.NoError(t, err)
+	var partial []byte
+	partial = protowire.AppendTag(partial, 1, protowire.VarintType)
+	partial = protowire.AppendVarint(partial, 3)
+	partial = protowire.AppendTag(partial, 2, protowire.BytesType)
+	partial = protowire.AppendString(partial, "unsupported")
+	assert.Equal(t, appendMessage(nil, 1, partial), body)
+}
@@ -0,0 +1,265 @@
+// Package ingest содержит разбор сторонних форматов метрик и их преобразование в модель monmetrics.
+package ingest
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	models "github.com/chestorix/monmetrics/internal/metrics"
+	"github.com/golang/snappy"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const (
+	// staleNaN - значение, которым Prometheus помечает исчезнувшие ряды.
+	staleNaN uint64 = 0x7ff0000000000002
+	// remoteCounterType - значение COUNTER перечисления MetricMetadata.MetricType.
+	remoteCounterType = 1
+)
+
+var ErrInvalidPayload = errors.New("invalid payload")
+
+// remoteSeries - ряд из WriteRequest: метки и значения с временными метками в миллисекундах.
+type remoteSeries struct {
+	labels  map[string]string
+	samples []remoteSample
+}
+
+type remoteSample struct {
+	value     float64
+	timestamp int64
+}
+
+// DecodeRemoteWrite разбирает сжатый snappy WriteRequest протокола Prometheus remote_write.
+// Имя метрики берется из метки __name__, остальные метки ряда сохраняются как метки метрики.
+// remote_write передает абсолютные значения, поэтому ряды счетчиков сохраняются как counter
+// с операцией cumulative (дробные значения округляются), а остальные ряды - как gauge.
+// Ряд считается счетчиком, если метаданные запроса задают для него тип COUNTER, а при отсутствии
+// метаданных - если имя оканчивается на _total.
+// Ряды без имени и значения-маркеры устаревания пропускаются, как и NaN и бесконечности счетчиков.
+func DecodeRemoteWrite(compressed []byte) ([]models.Metrics, error) {
+	data, err := snappy.Decode(nil, compressed)
+	if err != nil {
+		return nil, fmt.Errorf("%w: snappy: %v", ErrInvalidPayload, err)
+	}
+
+	var all []remoteSeries
+	types := make(map[string]uint64)
+	err = walkFields(data, func(num protowire.Number, typ protowire.Type, value []byte) error {
+		if typ != protowire.BytesType {
+			return nil
+		}
+		switch num {
+		case 1:
+			series, err := decodeTimeSeries(value)
+			if err != nil {
+				return err
+			}
+			all = append(all, series)
+		case 3:
+			family, mType, err := decodeMetadata(value)
+			if err != nil {
+				return err
+			}
+			types[family] = mType
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var metrics []models.Metrics
+	for _, series := range all {
+		name := series.labels["__name__"]
+		if name == "" {
+			continue
+		}
+		delete(series.labels, "__name__")
+		counter := remoteCounter(name, types)
+		for _, sample := range series.samples {
+			if math.Float64bits(sample.value) == staleNaN {
+				continue
+			}
+			timestamp := sample.timestamp
+			metric := models.Metrics{ID: name, Timestamp: &timestamp, Labels: series.labels}
+			if counter {
+				if math.IsNaN(sample.value) || math.IsInf(sample.value, 0) {
+					continue
+				}
+				total := int64(math.Round(sample.value))
+				metric.MType = models.Counter
+				metric.Op = models.CounterCumulative
+				metric.Delta = &total
+			} else {
+				value := sample.value
+				metric.MType = models.Gauge
+				metric.Value = &value
+			}
+			metrics = append(metrics, metric)
+		}
+	}
+	return metrics, nil
+}
+
+// remoteCounter сообщает, что ряд с именем name - счетчик. Метаданные счетчика могут быть заданы
+// как для полного имени, так и для имени без суффикса _total.
+func remoteCounter(name string, types map[string]uint64) bool {
+	if mType, ok := types[name]; ok {
+		return mType == remoteCounterType
+	}
+	if family, ok := strings.CutSuffix(name, "_total"); ok {
+		if mType, ok := types[family]; ok {
+			return mType == remoteCounterType
+		}
+		return true
+	}
+	return false
+}
+
+// decodeMetadata разбирает MetricMetadata и возвращает имя семейства метрик и его тип.
+func decodeMetadata(data []byte) (string, uint64, error) {
+	var family string
+	var mType uint64
+	err := walkMessage(data, func(f protoField) error {
+		switch {
+		case f.num == 1 && f.typ == protowire.VarintType:
+			mType = f.scalar
+		case f.num == 2 && f.typ == protowire.BytesType:
+			family = string(f.bytes)
+		}
+		return nil
+	})
+	return family, mType, err
+}
+
+func decodeTimeSeries(data []byte) (remoteSeries, error) {
+	series := remoteSeries{labels: make(map[string]string)}
+	err := walkFields(data, func(num protowire.Number, typ protowire.Type, value []byte) error {
+		if typ != protowire.BytesType {
+			return nil
+		}
+		switch num {
+		case 1:
+			name, val, err := decodeLabel(value)
+			if err != nil {
+				return err
+			}
+			series.labels[name] = val
+		case 2:
+			sample, err := decodeSample(value)
+			if err != nil {
+				return err
+			}
+			series.samples = append(series.samples, sample)
+		}
+		return nil
+	})
+	return series, err
+}
+
+func decodeLabel(data []byte) (string, string, error) {
+	var name, value string
+	err := walkFields(data, func(num protowire.Number, typ protowire.Type, raw []byte) error {
+		if typ != protowire.BytesType {
+			return nil
+		}
+		switch num {
+		case 1:
+			name = string(raw)
+		case 2:
+			value = string(raw)
+		}
+		return nil
+	})
+	return name, value, err
+}
+
+func decodeSample(data []byte) (remoteSample, error) {
+	var sample remoteSample
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return sample, ErrInvalidPayload
+		}
+		data = data[n:]
+		switch {
+		case num == 1 && typ == protowire.Fixed64Type:
+			v, n := protowire.ConsumeFixed64(data)
+			if n < 0 {
+				return sample, ErrInvalidPayload
+			}
+			sample.value = math.Float64frombits(v)
+			data = data[n:]
+		case num == 2 && typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(data)
+			if n < 0 {
+				return sample, ErrInvalidPayload
+			}
+			sample.timestamp = int64(v)
+			data = data[n:]
+		default:
+			n := protowire.ConsumeFieldValue(num, typ, data)
+			if n < 0 {
+				return sample, ErrInvalidPayload
+			}
+			data = data[n:]
+		}
+	}
+	return sample, nil
+}
+
+// walkFields обходит поля protobuf сообщения. Для полей с типом bytes в fn передается содержимое поля,
+// для остальных типов - nil.
+func walkFields(data []byte, fn func(num protowire.Number, typ protowire.Type, value []byte) error) error {
+	return walkMessage(data, func(f protoField) error {
+		return fn(f.num, f.typ, f.bytes)
+	})
+}
+
+// protoField - поле protobuf сообщения. Содержимое полей с типом bytes записывается в bytes,
+// значения varint, fixed32 и fixed64 - в scalar.
+type protoField struct {
+	num    protowire.Number
+	typ    protowire.Type
+	bytes  []byte
+	scalar uint64
+}
+
+// walkMessage обходит поля protobuf сообщения и передает их значения в fn.
+func walkMessage(data []byte, fn func(f protoField) error) error {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return ErrInvalidPayload
+		}
+		data = data[n:]
+
+		f := protoField{num: num, typ: typ}
+		switch typ {
+		case protowire.BytesType:
+			f.bytes, n = protowire.ConsumeBytes(data)
+		case protowire.VarintType:
+			f.scalar, n = protowire.ConsumeVarint(data)
+		case protowire.Fixed64Type:
+			f.scalar, n = protowire.ConsumeFixed64(data)
+		case protowire.Fixed32Type:
+			var v uint32
+			v, n = protowire.ConsumeFixed32(data)
+			f.scalar = uint64(v)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, data)
+		}
+		if n < 0 {
+			return ErrInvalidPayload
+		}
+		data = data[n:]
+
+		if err := fn(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package ingest
+
+import (
+	"math"
+	"testing"
+
+	"github.com/golang/snappy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func encodeLabel(name, value string) []byte {
+	var b []byte
+	b = protowire.AppendTag(b, 1, protowire.BytesType)
+	b = protowire.AppendString(b, name)
+	b = protowire.AppendTag(b, 2, protowire.BytesType)
+	b = protowire.AppendString(b, value)
+	return b
+}
+
+func encodeSample(value float64, timestamp int64) []byte {
+	var b []byte
+	b = protowire.AppendTag(b, 1, protowire.Fixed64Type)
+	b = protowire.AppendFixed64(b, math.Float64bits(value))
+	b = protowire.AppendTag(b, 2, protowire.VarintType)
+	b = protowire.AppendVarint(b, uint64(timestamp))
+	return b
+}
+
+func encodeSeries(labels [][2]string, samples ...[]byte) []byte {
+	var b []byte
+	for _, l := range labels {
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendBytes(b, encodeLabel(l[0], l[1]))
+	}
+	for _, s := range samples {
+		b = protowire.AppendTag(b, 2, protowire.BytesType)
+		b = protowire.AppendBytes(b, s)
+	}
+	return b
+}
+
+func TestDecodeRemoteWrite(t *testing.T) {
+	var req []byte
+	req = protowire.AppendTag(req, 1, protowire.BytesType)
+	req = protowire.AppendBytes(req, encodeSeries(
+		[][2]string{{"__name__", "http_requests_total"}, {"job", "api"}},
+		encodeSample(10, 1700000000000),
+		encodeSample(math.Float64frombits(staleNaN), 1700000015000),
+	))
+	req = protowire.AppendTag(req, 1, protowire.BytesType)
+	req = protowire.AppendBytes(req, encodeSeries(
+		[][2]string{{"job", "api"}},
+		encodeSample(1, 1700000000000),
+	))
+
+	metrics, err := DecodeRemoteWrite(snappy.Encode(nil, req))
+	require.NoError(t, err)
+	require.Len(t, metrics, 1)
+
+	assert.Equal(t, "http_requests_total", metrics[0].ID)
+	assert.Equal(t, "counter", metrics[0].MType)
+	assert.Equal(t, "cumulative", metrics[0].Op)
+	assert.Equal(t, int64(10), *metrics[0].Delta)
+	assert.Equal(t, int64(1700000000000), *metrics[0].Timestamp)
+	assert.Equal(t, map[string]string{"job": "api"}, metrics[0].Labels)
+}
+
+func encodeMetadata(family string, mType uint64) []byte {
+	var b []byte
+	b = protowire.AppendTag(b, 1, protowire.VarintType)
+	b = protowire.AppendVarint(b, mType)
+	b = protowire.AppendTag(b, 2, protowire.BytesType)
+	return protowire.AppendString(b, family)
+}
+
+func TestDecodeRemoteWrite_Metadata(t *testing.T) {
+	var req []byte
+	for _, series := range [][]byte{
+		encodeSeries([][2]string{{"__name__", "process_cpu_seconds"}}, encodeSample(1.4, 1000), encodeSample(2.6, 2000)),
+		encodeSeries([][2]string{{"__name__", "queue_total"}}, encodeSample(5, 1000)),
+		encodeSeries([][2]string{{"__name__", "memory_bytes"}}, encodeSample(7.5, 1000)),
+	} {
+		req = protowire.AppendTag(req, 1, protowire.BytesType)
+		req = protowire.AppendBytes(req, series)
+	}
+	// Метаданные следуют за рядами; COUNTER = 1, GAUGE = 2.
+	for _, meta := range [][]byte{encodeMetadata("process_cpu_seconds", 1), encodeMetadata("queue", 2)} {
+		req = protowire.AppendTag(req, 3, protowire.BytesType)
+		req = protowire.AppendBytes(req, meta)
+	}
+
+	metrics, err := DecodeRemoteWrite(snappy.Encode(nil, req))
+	require.NoError(t, err)
+	require.Len(t, metrics, 4)
+
+	for i, total := range []int64{1, 3} {
+		assert.Equal(t, "process_cpu_seconds", metrics[i].ID)
+		assert.Equal(t, "counter", metrics[i].MType)
+		assert.Equal(t, "cumulative", metrics[i].Op)
+		assert.Equal(t, total, *metrics[i].Delta)
+	}
+	assert.Equal(t, "queue_total", metrics[2].ID)
+	assert.Equal(t, "gauge", metrics[2].MType)
+	assert.Equal(t, 5.0, *metrics[2].Value)
+	assert.Equal(t, "memory_bytes", metrics[3].ID)
+	assert.Equal(t, "gauge", metrics[3].MType)
+}
+
+func TestDecodeRemoteWrite_Invalid(t *testing.T) {
+	_, err := DecodeRemoteWrite([]byte("not snappy"))
+	assert.ErrorIs(t, err, ErrInvalidPayload)
+
+	_, err = DecodeRemoteWrite(snappy.Encode(nil, []byte{0x0a, 0xff}))
+	assert.ErrorIs(t, err, ErrInvalidPayload)
+}
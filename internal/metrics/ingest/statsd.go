@@ -0,0 +1,99 @@
+// Package ingest содержит разбор сторонних форматов метрик и их преобразование в модель monmetrics.
+package ingest
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	models "github.com/chestorix/monmetrics/internal/metrics"
+)
+
+// Типы метрик StatsD.
+const (
+	StatsdCounter = "c"
+	StatsdGauge   = "g"
+	StatsdTimer   = "ms"
+)
+
+// StatsdSample - одно значение, полученное по протоколу StatsD.
+// Relative означает относительное изменение gauge (значение со знаком + или -).
+type StatsdSample struct {
+	Labels     map[string]string
+	Name       string
+	Type       string
+	Value      float64
+	SampleRate float64
+	Relative   bool
+}
+
+// ParseStatsdLine разбирает строку StatsD: "name:value|type[|@rate][|#tags]".
+// Поддерживаются счетчики (c), gauge (g) с относительными изменениями и таймеры (ms, h).
+// Теги DogStatsD (#tag:value,tag2) сохраняются как метки, теги без значения получают значение "true".
+// Строки с недопустимым именем или метками отклоняются, чтобы не попасть в пакет сохранения.
+func ParseStatsdLine(line string) (StatsdSample, error) {
+	name, rest, ok := strings.Cut(line, ":")
+	if !ok || name == "" {
+		return StatsdSample{}, fmt.Errorf("%w: expected \"name:value|type\"", ErrInvalidPayload)
+	}
+	if err := models.ValidateName(name); err != nil {
+		return StatsdSample{}, fmt.Errorf("%w: %v", ErrInvalidPayload, err)
+	}
+
+	parts := strings.Split(rest, "|")
+	if len(parts) < 2 {
+		return StatsdSample{}, fmt.Errorf("%w: missing metric type", ErrInvalidPayload)
+	}
+
+	sample := StatsdSample{Name: name, SampleRate: 1}
+	switch parts[1] {
+	case StatsdCounter, StatsdGauge, StatsdTimer:
+		sample.Type = parts[1]
+	case "h":
+		sample.Type = StatsdTimer
+	default:
+		return StatsdSample{}, fmt.Errorf("%w: unsupported metric type %q", ErrInvalidPayload, parts[1])
+	}
+
+	raw := parts[0]
+	if sample.Type == StatsdGauge && (strings.HasPrefix(raw, "+") || strings.HasPrefix(raw, "-")) {
+		sample.Relative = true
+	}
+	value, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return StatsdSample{}, fmt.Errorf("%w: invalid value %q", ErrInvalidPayload, raw)
+	}
+	sample.Value = value
+
+	for _, opt := range parts[2:] {
+		switch {
+		case strings.HasPrefix(opt, "@"):
+			rate, err := strconv.ParseFloat(opt[1:], 64)
+			if err != nil || rate <= 0 || rate > 1 {
+				return StatsdSample{}, fmt.Errorf("%w: invalid sample rate %q", ErrInvalidPayload, opt)
+			}
+			sample.SampleRate = rate
+		case strings.HasPrefix(opt, "#"):
+			sample.Labels = parseStatsdTags(opt[1:])
+			if err := models.ValidateLabels(sample.Labels); err != nil {
+				return StatsdSample{}, fmt.Errorf("%w: %v", ErrInvalidPayload, err)
+			}
+		}
+	}
+	return sample, nil
+}
+
+func parseStatsdTags(raw string) map[string]string {
+	labels := make(map[string]string)
+	for _, tag := range strings.Split(raw, ",") {
+		if tag == "" {
+			continue
+		}
+		label, value, ok := strings.Cut(tag, ":")
+		if !ok {
+			value = "true"
+		}
+		labels[models.SanitizeLabelName(label)] = value
+	}
+	return labels
+}
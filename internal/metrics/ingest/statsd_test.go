@@ -0,0 +1,36 @@
+package ingest
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseStatsdLine(t *testing.T) {
+	tests := []struct {
+		line string
+		want StatsdSample
+	}{
+		{line: "api.requests:1|c", want: StatsdSample{Name: "api.requests", Type: StatsdCounter, Value: 1, SampleRate: 1}},
+		{line: "api.requests:3|c|@0.1|#env:prod", want: StatsdSample{Name: "api.requests", Type: StatsdCounter, Value: 3, SampleRate: 0.1, Labels: map[string]string{"env": "prod"}}},
+		{line: "api.requests:1|c|#env:prod,canary,host.name:web-1", want: StatsdSample{Name: "api.requests", Type: StatsdCounter, Value: 1, SampleRate: 1, Labels: map[string]string{"env": "prod", "canary": "true", "host_name": "web-1"}}},
+		{line: "queue.size:42|g", want: StatsdSample{Name: "queue.size", Type: StatsdGauge, Value: 42, SampleRate: 1}},
+		{line: "queue.size:-5|g", want: StatsdSample{Name: "queue.size", Type: StatsdGauge, Value: -5, SampleRate: 1, Relative: true}},
+		{line: "queue.size:+2.5|g", want: StatsdSample{Name: "queue.size", Type: StatsdGauge, Value: 2.5, SampleRate: 1, Relative: true}},
+		{line: "db.query:320|ms", want: StatsdSample{Name: "db.query", Type: StatsdTimer, Value: 320, SampleRate: 1}},
+		{line: "db.query:12|h", want: StatsdSample{Name: "db.query", Type: StatsdTimer, Value: 12, SampleRate: 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			got, err := ParseStatsdLine(tt.line)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	for _, line := range []string{"api.requests", "api.requests:1", "api.requests:x|c", "api.requests:1|zz", "api.requests:1|c|@2", `api{x:1|c`, `"api":1|c`} {
+		_, err := ParseStatsdLine(line)
+		assert.ErrorIs(t, err, ErrInvalidPayload, line)
+	}
+}
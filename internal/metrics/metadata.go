@@ -0,0 +1,30 @@
+// Package models  содержит бизнес-сущности приложения.
+package models
+
+import (
+	"errors"
+	"fmt"
+)
+
+var ErrInvalidMetadata = errors.New("invalid metadata")
+
+// Metadata - описание метрики: единица измерения, текст справки, команда-владелец
+// и ожидаемый тип. Метаданные относятся к имени метрики и общие для всех ее рядов.
+type Metadata struct {
+	ID    string `json:"id"`
+	Unit  string `json:"unit,omitempty"`
+	Help  string `json:"help,omitempty"`
+	Owner string `json:"owner,omitempty"`
+	Type  string `json:"type,omitempty"`
+}
+
+// Validate проверяет, что имя метрики задано, а ожидаемый тип, если указан, поддерживается сервером.
+func (m Metadata) Validate() error {
+	if m.ID == "" {
+		return fmt.Errorf("%w: missing id", ErrInvalidMetadata)
+	}
+	if m.Type != "" && !IsValidType(m.Type) {
+		return fmt.Errorf("%w: unknown type %q", ErrInvalidMetadata, m.Type)
+	}
+	return nil
+}
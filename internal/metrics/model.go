@@ -1,27 +1,176 @@
 // Package models  содержит бизнес-сущности приложения.
 package models
 
-import "errors"
+import (
+	"errors"
+	"time"
+)
 
 var (
 	ErrMetricNotFound    = errors.New("metric not found")
 	ErrInvalidMetricType = errors.New("invalid metric type")
+	ErrInvalidQuery      = errors.New("invalid query")
+	ErrTypeConflict      = errors.New("metric type conflict")
+	ErrInvalidCounterOp  = errors.New("invalid counter operation")
+)
+
+const (
+	Gauge     = "gauge"
+	Counter   = "counter"
+	Histogram = "histogram"
+	Summary   = "summary"
+	Set       = "set"
 )
 
+// Операции над счетчиком в поле Op.
 const (
-	Gauge   = "gauge"
-	Counter = "counter"
+	// CounterAdd - значение Delta добавляется к счетчику (по умолчанию).
+	CounterAdd = "add"
+	// CounterSet - счетчику присваивается абсолютное значение Delta.
+	CounterSet = "set"
+	// CounterReset - счетчик сбрасывается в ноль, Delta не требуется.
+	CounterReset = "reset"
+	// CounterCumulative - Delta содержит накопленный итог источника, сервер
+	// переводит его в приращение относительно предыдущего итога этого ряда.
+	CounterCumulative = "cumulative"
 )
 
+// IsValidType сообщает, поддерживается ли тип метрики сервером.
+func IsValidType(mType string) bool {
+	switch mType {
+	case Gauge, Counter, Histogram, Summary, Set:
+		return true
+	}
+	return false
+}
+
 type Metric struct {
-	Value interface{}
-	Name  string
-	Type  string
+	Value  interface{}
+	Labels map[string]string
+	Name   string
+	Type   string
 }
 
+// Metrics - метрика в формате JSON API.
+// Ряд метрики определяется именем ID, типом MType и набором меток Labels.
+// Timestamp - необязательное время измерения в миллисекундах unix,
+// если оно не задано, используется время получения метрики сервером.
+// Для метрик типа histogram значение передается в поле Histogram, для summary - скетч в поле Sketch.
+// Для метрик типа set клиент передает элементы в поле Members, а в ответе сервер возвращает
+// оценку количества уникальных элементов в поле Delta. Элементы считаются за окно сервера,
+// которое определяется по Timestamp.
+// Для счетчиков поле Op задает операцию: add, set, reset или cumulative.
 type Metrics struct {
-	Delta *int64   `json:"delta,omitempty"`
-	Value *float64 `json:"value,omitempty"`
-	ID    string   `json:"id"`
-	MType string   `json:"type"`
+	Delta     *int64            `json:"delta,omitempty"`
+	Value     *float64          `json:"value,omitempty"`
+	Histogram *HistogramValue   `json:"histogram,omitempty"`
+	Sketch    *SketchValue      `json:"sketch,omitempty"`
+	Members   []string          `json:"members,omitempty"`
+	Timestamp *int64            `json:"timestamp,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	ID        string            `json:"id"`
+	MType     string            `json:"type"`
+	Op        string            `json:"op,omitempty"`
+}
+
+// RejectedMetric - метрика пакета, отклоненная при частичном приеме.
+// Index - позиция метрики в пакете, Reason - причина отклонения.
+type RejectedMetric struct {
+	ID     string `json:"id"`
+	Reason string `json:"reason"`
+	Index  int    `json:"index"`
+}
+
+// BatchResult - результат частичного приема пакета: количество примененных метрик и отклоненные метрики.
+type BatchResult struct {
+	Rejected []RejectedMetric `json:"rejected"`
+	Accepted int              `json:"accepted"`
+}
+
+// SampleTime возвращает время измерения метрики.
+func (m Metrics) SampleTime() time.Time {
+	if m.Timestamp == nil {
+		return time.Now()
+	}
+	return time.UnixMilli(*m.Timestamp)
+}
+
+// Sample - значение метрики, зафиксированное в определенный момент времени.
+// Для счетчиков хранится накопленное значение после обновления.
+type Sample struct {
+	Timestamp time.Time `json:"timestamp"`
+	Value     float64   `json:"value"`
+}
+
+// RangeQuery - параметры запроса истории метрики за период.
+// Func задает функцию агрегации значений (avg, max, rate и т.д.), по умолчанию last.
+// В запросах по селектору ID содержит селектор, By - метки группировки рядов,
+// а Agg - функцию объединения рядов внутри группы (sum, avg, min, max, count).
+type RangeQuery struct {
+	From  time.Time
+	To    time.Time
+	ID    string
+	MType string
+	Func  string
+	Agg   string
+	By    []string
+	Step  time.Duration
+}
+
+// RangeResult - история метрики, разбитая на интервалы длиной Step.
+// Каждая точка содержит начало интервала и результат функции Func над значениями внутри него.
+type RangeResult struct {
+	ID     string   `json:"id"`
+	MType  string   `json:"type"`
+	Func   string   `json:"func"`
+	Step   string   `json:"step"`
+	Points []Sample `json:"points"`
+}
+
+// AggregateResult - результат функции агрегации над историей метрики за весь период.
+type AggregateResult struct {
+	From  time.Time `json:"from"`
+	To    time.Time `json:"to"`
+	ID    string    `json:"id"`
+	MType string    `json:"type"`
+	Func  string    `json:"func"`
+	Value float64   `json:"value"`
+}
+
+// SeriesRange - история одного ряда или группы рядов в ответе на запрос по селектору.
+// ID заполняется только для рядов без группировки.
+type SeriesRange struct {
+	Labels map[string]string `json:"labels"`
+	ID     string            `json:"id,omitempty"`
+	Points []Sample          `json:"points"`
+}
+
+// SeriesValue - значение одного ряда или группы рядов в ответе на запрос по селектору.
+type SeriesValue struct {
+	Labels map[string]string `json:"labels"`
+	ID     string            `json:"id,omitempty"`
+	Value  float64           `json:"value"`
+}
+
+// SelectRangeResult - история рядов, выбранных селектором Match.
+type SelectRangeResult struct {
+	Match  string        `json:"match"`
+	MType  string        `json:"type"`
+	Func   string        `json:"func"`
+	Agg    string        `json:"agg,omitempty"`
+	Step   string        `json:"step"`
+	By     []string      `json:"by,omitempty"`
+	Series []SeriesRange `json:"series"`
+}
+
+// SelectAggregateResult - результат функции агрегации для рядов, выбранных селектором Match.
+type SelectAggregateResult struct {
+	From   time.Time     `json:"from"`
+	To     time.Time     `json:"to"`
+	Match  string        `json:"match"`
+	MType  string        `json:"type"`
+	Func   string        `json:"func"`
+	Agg    string        `json:"agg,omitempty"`
+	By     []string      `json:"by,omitempty"`
+	Series []SeriesValue `json:"series"`
 }
@@ -18,22 +18,24 @@ func NewInitStorage() *InitStorage {
 	}
 }
 
-func (i *InitStorage) CreateStorage(dbDSN, filePath string) (interfaces.Repository, error) {
-	var storage interfaces.Repository
+// CreateStorage создает хранилище PostgreSQL, если задана строка подключения, иначе хранилище в памяти.
+// Размер истории из opts применяется только к хранилищу в памяти.
+func (i *InitStorage) CreateStorage(dbDSN, filePath string, opts ...Option) (interfaces.HistoryRepository, error) {
+	var storage interfaces.HistoryRepository
 	var err error
 
 	if dbDSN != "" {
 		err = utils.Retry(3, i.retryDelays, func() error {
-			storage, err = NewPostgresStorage(dbDSN)
+			storage, err = NewPostgresStorage(dbDSN, opts...)
 			return err
 		})
 		if err != nil {
 			return nil, fmt.Errorf("failed to initialize PostgreSQL storage: %w", err)
 		}
 	} else if filePath != "" {
-		storage = NewMemStorage(filePath)
+		storage = NewMemStorage(filePath, opts...)
 	} else {
-		storage = NewMemStorage("")
+		storage = NewMemStorage("", opts...)
 	}
 
 	return storage, nil
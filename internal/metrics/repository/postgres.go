@@ -4,6 +4,7 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"time"
@@ -15,13 +16,67 @@ import (
 	_ "github.com/jackc/pgx/v5/stdlib"
 )
 
+// upsertGaugeQuery регистрирует ряд и отмечает время его обновления, обновляет текущее значение gauge
+// и записывает его в историю.
+// Параметры: ключ ряда, значение, время измерения, имя метрики, метки в JSON.
+const upsertGaugeQuery = `
+	WITH s AS (
+		INSERT INTO series (type, key, name, labels)
+		VALUES ('gauge', $1, $4, $5::jsonb)
+		ON CONFLICT (type, key) DO UPDATE SET updated_at = now()
+	), upd AS (
+		INSERT INTO gauges (name, value)
+		VALUES ($1, $2)
+		ON CONFLICT (name) DO UPDATE SET value = EXCLUDED.value
+		RETURNING name, value
+	)
+	INSERT INTO metric_samples (type, name, ts, value)
+	SELECT 'gauge', name, $3::timestamptz, value FROM upd
+`
+
+// upsertCounterQuery регистрирует ряд, увеличивает счетчик и записывает в историю накопленное значение.
+// Параметры совпадают с upsertGaugeQuery.
+const upsertCounterQuery = `
+	WITH s AS (
+		INSERT INTO series (type, key, name, labels)
+		VALUES ('counter', $1, $4, $5::jsonb)
+		ON CONFLICT (type, key) DO UPDATE SET updated_at = now()
+	), upd AS (
+		INSERT INTO counters (name, value)
+		VALUES ($1, $2)
+		ON CONFLICT (name) DO UPDATE SET value = counters.value + EXCLUDED.value
+		RETURNING name, value
+	)
+	INSERT INTO metric_samples (type, name, ts, value)
+	SELECT 'counter', name, $3::timestamptz, value FROM upd
+`
+
+// setCounterQuery регистрирует ряд, присваивает счетчику абсолютное значение и записывает его в историю.
+// Параметры совпадают с upsertGaugeQuery.
+const setCounterQuery = `
+	WITH s AS (
+		INSERT INTO series (type, key, name, labels)
+		VALUES ('counter', $1, $4, $5::jsonb)
+		ON CONFLICT (type, key) DO UPDATE SET updated_at = now()
+	), upd AS (
+		INSERT INTO counters (name, value)
+		VALUES ($1, $2)
+		ON CONFLICT (name) DO UPDATE SET value = EXCLUDED.value
+		RETURNING name, value
+	)
+	INSERT INTO metric_samples (type, name, ts, value)
+	SELECT 'counter', name, $3::timestamptz, value FROM upd
+`
+
 type PostgresStorage struct {
 	db          *sql.DB
 	dbDSN       string
 	retryDelays []time.Duration
+	setWindow   time.Duration
 }
 
-func NewPostgresStorage(dsn string) (*PostgresStorage, error) {
+// NewPostgresStorage подключается к базе и создает таблицы. Из параметров opts учитывается окно множеств.
+func NewPostgresStorage(dsn string, opts ...Option) (*PostgresStorage, error) {
 	db, err := sql.Open("pgx", dsn)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
@@ -39,6 +94,7 @@ func NewPostgresStorage(dsn string) (*PostgresStorage, error) {
 		db:          db,
 		dbDSN:       dsn,
 		retryDelays: []time.Duration{time.Second, 3 * time.Second, 5 * time.Second},
+		setWindow:   newOptions(opts).setWindow,
 	}, nil
 }
 
@@ -53,17 +109,77 @@ func createTables(db *sql.DB) error {
 			name TEXT PRIMARY KEY,
 			value BIGINT NOT NULL
 		);
+
+		CREATE TABLE IF NOT EXISTS histograms (
+			name TEXT PRIMARY KEY,
+			data JSONB NOT NULL
+		);
+
+		CREATE TABLE IF NOT EXISTS sketches (
+			name TEXT PRIMARY KEY,
+			data JSONB NOT NULL
+		);
+
+		CREATE TABLE IF NOT EXISTS sets (
+			name TEXT PRIMARY KEY,
+			data JSONB NOT NULL
+		);
+
+		CREATE TABLE IF NOT EXISTS metadata (
+			name TEXT PRIMARY KEY,
+			unit TEXT NOT NULL DEFAULT '',
+			help TEXT NOT NULL DEFAULT '',
+			owner TEXT NOT NULL DEFAULT '',
+			type TEXT NOT NULL DEFAULT ''
+		);
+
+		CREATE TABLE IF NOT EXISTS idempotency_keys (
+			key TEXT PRIMARY KEY,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+		);
+
+		CREATE TABLE IF NOT EXISTS series (
+			type TEXT NOT NULL,
+			key TEXT NOT NULL,
+			name TEXT NOT NULL,
+			labels JSONB NOT NULL DEFAULT '{}',
+			PRIMARY KEY (type, key)
+		);
+
+		ALTER TABLE series ADD COLUMN IF NOT EXISTS updated_at TIMESTAMPTZ NOT NULL DEFAULT now();
+
+		CREATE INDEX IF NOT EXISTS series_name_idx ON series (name);
+		CREATE INDEX IF NOT EXISTS series_updated_at_idx ON series (updated_at);
+		CREATE INDEX IF NOT EXISTS series_labels_idx ON series USING GIN (labels);
+
+		INSERT INTO series (type, key, name)
+		SELECT 'gauge', name, name FROM gauges
+		ON CONFLICT (type, key) DO NOTHING;
+
+		INSERT INTO series (type, key, name)
+		SELECT 'counter', name, name FROM counters
+		ON CONFLICT (type, key) DO NOTHING;
+
+		CREATE TABLE IF NOT EXISTS metric_samples (
+			type TEXT NOT NULL,
+			name TEXT NOT NULL,
+			ts TIMESTAMPTZ NOT NULL,
+			value DOUBLE PRECISION NOT NULL
+		);
+
+		CREATE INDEX IF NOT EXISTS metric_samples_type_name_ts_idx
+			ON metric_samples (type, name, ts);
+
+		CREATE INDEX IF NOT EXISTS metric_samples_ts_idx
+			ON metric_samples (ts);
 	`)
 	return err
 }
 
 func (p *PostgresStorage) UpdateGauge(ctx context.Context, name string, value float64) error {
 	err := utils.Retry(3, p.retryDelays, func() error {
-		_, err := p.db.ExecContext(ctx, `
-		INSERT INTO gauges (name, value)
-		VALUES ($1, $2)
-		ON CONFLICT (name) DO UPDATE SET value = EXCLUDED.value
-	`, name, value)
+		metricName, labels := splitSeriesKey(name)
+		_, err := p.db.ExecContext(ctx, upsertGaugeQuery, name, value, time.Now(), metricName, labelsJSON(labels))
 		return checkError(err)
 	})
 
@@ -72,72 +188,248 @@ func (p *PostgresStorage) UpdateGauge(ctx context.Context, name string, value fl
 
 func (p *PostgresStorage) UpdateCounter(ctx context.Context, name string, value int64) error {
 	err := utils.Retry(3, p.retryDelays, func() error {
-		_, err := p.db.ExecContext(ctx, `
-		INSERT INTO counters (name, value)
-		VALUES ($1, $2)
-		ON CONFLICT (name) DO UPDATE SET value = counters.value + EXCLUDED.value
-	`, name, value)
+		metricName, labels := splitSeriesKey(name)
+		_, err := p.db.ExecContext(ctx, upsertCounterQuery, name, value, time.Now(), metricName, labelsJSON(labels))
 		return checkError(err)
 	})
 	return err
 
 }
-func (p *PostgresStorage) UpdateMetricsBatch(ctx context.Context, metrics []models.Metrics) error {
+
+func (p *PostgresStorage) SetCounter(ctx context.Context, name string, value int64) error {
 	err := utils.Retry(3, p.retryDelays, func() error {
+		metricName, labels := splitSeriesKey(name)
+		_, err := p.db.ExecContext(ctx, setCounterQuery, name, value, time.Now(), metricName, labelsJSON(labels))
+		return checkError(err)
+	})
+	return err
+}
 
+// UpdateHistogram добавляет приращение к гистограмме в отдельной транзакции.
+// Ошибка несовпадения границ не повторяется и возвращается как есть.
+func (p *PostgresStorage) UpdateHistogram(ctx context.Context, name string, value models.HistogramValue) error {
+	var mergeErr error
+	err := utils.Retry(3, p.retryDelays, func() error {
 		tx, err := p.db.BeginTx(ctx, nil)
 		if err != nil {
 			return checkError(fmt.Errorf("failed to begin transaction: %w", err))
 		}
 		defer tx.Rollback()
 
-		gaugeStmt, err := tx.Prepare(`
-            INSERT INTO gauges (name, value)
-            VALUES ($1, $2)
-            ON CONFLICT (name) DO UPDATE SET value = EXCLUDED.value
-        `)
+		metricName, labels := splitSeriesKey(name)
+		if err := mergeHistogram(ctx, tx, name, metricName, labels, value); err != nil {
+			if isMergeError(err) {
+				mergeErr = err
+				return nil
+			}
+			return checkError(err)
+		}
+		return checkError(tx.Commit())
+	})
+	if mergeErr != nil {
+		return mergeErr
+	}
+	return err
+}
+
+// UpdateSketch добавляет скетч к сохраненному в отдельной транзакции.
+// Ошибка несовпадения точности не повторяется и возвращается как есть.
+func (p *PostgresStorage) UpdateSketch(ctx context.Context, name string, value models.SketchValue) error {
+	var mergeErr error
+	err := utils.Retry(3, p.retryDelays, func() error {
+		tx, err := p.db.BeginTx(ctx, nil)
 		if err != nil {
-			return checkError(fmt.Errorf("failed to prepare gauge statement: %w", err))
+			return checkError(fmt.Errorf("failed to begin transaction: %w", err))
+		}
+		defer tx.Rollback()
+
+		metricName, labels := splitSeriesKey(name)
+		if err := mergeSketch(ctx, tx, name, metricName, labels, value); err != nil {
+			if isMergeError(err) {
+				mergeErr = err
+				return nil
+			}
+			return checkError(err)
+		}
+		return checkError(tx.Commit())
+	})
+	if mergeErr != nil {
+		return mergeErr
+	}
+	return err
+}
+
+// UpdateSet объединяет множество с сохраненным в отдельной транзакции.
+// Ошибка несовпадения точности не повторяется и возвращается как есть.
+func (p *PostgresStorage) UpdateSet(ctx context.Context, name string, value models.SetValue) error {
+	var mergeErr error
+	err := utils.Retry(3, p.retryDelays, func() error {
+		tx, err := p.db.BeginTx(ctx, nil)
+		if err != nil {
+			return checkError(fmt.Errorf("failed to begin transaction: %w", err))
+		}
+		defer tx.Rollback()
+
+		metricName, labels := splitSeriesKey(name)
+		now := time.Now()
+		if err := mergeSet(ctx, tx, name, metricName, labels, value.InWindow(now, p.setWindow), now); err != nil {
+			if isMergeError(err) {
+				mergeErr = err
+				return nil
+			}
+			return checkError(err)
+		}
+		return checkError(tx.Commit())
+	})
+	if mergeErr != nil {
+		return mergeErr
+	}
+	return err
+}
+
+func (p *PostgresStorage) UpdateMetricsBatch(ctx context.Context, metrics []models.Metrics) error {
+	_, err := p.updateMetricsBatch(ctx, "", time.Time{}, metrics)
+	return err
+}
+
+// UpdateMetricsBatchOnce применяет пакет, если ключ key не встречался после since.
+// Ключ записывается в той же транзакции, что и метрики, поэтому повтор, пришедший одновременно
+// с первым запросом, ждет его завершения и не применяется. Ключи старше since удаляются.
+func (p *PostgresStorage) UpdateMetricsBatchOnce(ctx context.Context, key string, since time.Time, metrics []models.Metrics) (bool, error) {
+	return p.updateMetricsBatch(ctx, key, since, metrics)
+}
+
+func (p *PostgresStorage) updateMetricsBatch(ctx context.Context, key string, since time.Time, metrics []models.Metrics) (bool, error) {
+	var mergeErr, failErr error
+	var duplicate bool
+	// fail возвращает ошибку для повтора попытки, если она сетевая. Остальные ошибки не повторяются:
+	// попытка завершается, а ошибка возвращается вызывающему после отката транзакции.
+	fail := func(err error) error {
+		if retryable := checkError(err); retryable != nil {
+			return retryable
+		}
+		failErr = err
+		return nil
+	}
+	err := utils.Retry(3, p.retryDelays, func() error {
+		tx, err := p.db.BeginTx(ctx, nil)
+		if err != nil {
+			return fail(fmt.Errorf("failed to begin transaction: %w", err))
+		}
+		defer tx.Rollback()
+
+		if key != "" {
+			if _, err := tx.ExecContext(ctx, "DELETE FROM idempotency_keys WHERE created_at < $1", since); err != nil {
+				return fail(fmt.Errorf("failed to expire idempotency keys: %w", err))
+			}
+			res, err := tx.ExecContext(ctx, `
+				INSERT INTO idempotency_keys (key, created_at) VALUES ($1, now())
+				ON CONFLICT (key) DO NOTHING`, key)
+			if err != nil {
+				return fail(fmt.Errorf("failed to store idempotency key: %w", err))
+			}
+			if n, err := res.RowsAffected(); err != nil {
+				return fail(err)
+			} else if n == 0 {
+				duplicate = true
+				return nil
+			}
+		}
+
+		gaugeStmt, err := tx.Prepare(upsertGaugeQuery)
+		if err != nil {
+			return fail(fmt.Errorf("failed to prepare gauge statement: %w", err))
 		}
 		defer gaugeStmt.Close()
 
-		counterStmt, err := tx.Prepare(`
-            INSERT INTO counters (name, value)
-            VALUES ($1, $2)
-            ON CONFLICT (name) DO UPDATE SET value = counters.value + EXCLUDED.value
-        `)
+		counterStmt, err := tx.Prepare(upsertCounterQuery)
 		if err != nil {
-			return checkError(fmt.Errorf("failed to prepare counter statement: %w", err))
+			return fail(fmt.Errorf("failed to prepare counter statement: %w", err))
 		}
 		defer counterStmt.Close()
 
+		setCounterStmt, err := tx.Prepare(setCounterQuery)
+		if err != nil {
+			return fail(fmt.Errorf("failed to prepare counter statement: %w", err))
+		}
+		defer setCounterStmt.Close()
+
 		for _, metric := range metrics {
 			switch metric.MType {
 			case models.Gauge:
 				if metric.Value == nil {
 					return fmt.Errorf("gauge value is nil for metric %s", metric.ID)
 				}
-				if _, err := gaugeStmt.Exec(metric.ID, *metric.Value); err != nil {
-					return checkError(fmt.Errorf("failed to update gauge: %w", err))
+				if _, err := gaugeStmt.Exec(metric.Key(), *metric.Value, metric.SampleTime(), metric.ID, labelsJSON(metric.Labels)); err != nil {
+					return fail(fmt.Errorf("failed to update gauge: %w", err))
 				}
 
 			case models.Counter:
 				if metric.Delta == nil {
 					return fmt.Errorf("counter delta is nil for metric %s", metric.ID)
 				}
-				if _, err := counterStmt.Exec(metric.ID, *metric.Delta); err != nil {
-					return checkError(fmt.Errorf("failed to update counter: %w", err))
+				stmt := counterStmt
+				if metric.Op == models.CounterSet {
+					stmt = setCounterStmt
+				}
+				if _, err := stmt.Exec(metric.Key(), *metric.Delta, metric.SampleTime(), metric.ID, labelsJSON(metric.Labels)); err != nil {
+					return fail(fmt.Errorf("failed to update counter: %w", err))
+				}
+
+			case models.Histogram:
+				if metric.Histogram == nil {
+					return fmt.Errorf("histogram value is nil for metric %s", metric.ID)
+				}
+				if err := mergeHistogram(ctx, tx, metric.Key(), metric.ID, metric.Labels, *metric.Histogram); err != nil {
+					if isMergeError(err) {
+						mergeErr = err
+						return nil
+					}
+					return fail(fmt.Errorf("failed to update histogram: %w", err))
+				}
+
+			case models.Summary:
+				if metric.Sketch == nil {
+					return fmt.Errorf("sketch is nil for metric %s", metric.ID)
+				}
+				if err := mergeSketch(ctx, tx, metric.Key(), metric.ID, metric.Labels, *metric.Sketch); err != nil {
+					if isMergeError(err) {
+						mergeErr = err
+						return nil
+					}
+					return fail(fmt.Errorf("failed to update sketch: %w", err))
+				}
+
+			case models.Set:
+				if metric.Members == nil {
+					return fmt.Errorf("set members are nil for metric %s", metric.ID)
+				}
+				set := models.NewSetOf(metric.Members...).InWindow(metric.SampleTime(), p.setWindow)
+				if err := mergeSet(ctx, tx, metric.Key(), metric.ID, metric.Labels, set, metric.SampleTime()); err != nil {
+					if isMergeError(err) {
+						mergeErr = err
+						return nil
+					}
+					return fail(fmt.Errorf("failed to update set: %w", err))
 				}
 			}
 		}
 
 		if err := tx.Commit(); err != nil {
-			return checkError(fmt.Errorf("failed to commit transaction: %w", err))
+			return fail(fmt.Errorf("failed to commit transaction: %w", err))
 		}
 		return nil
 	})
-
-	return err
+	if err != nil {
+		return false, err
+	}
+	if failErr != nil {
+		return false, failErr
+	}
+	if mergeErr != nil {
+		return false, mergeErr
+	}
+	return !duplicate, nil
 }
 func (p *PostgresStorage) GetGauge(ctx context.Context, name string) (float64, bool, error) {
 
@@ -165,6 +457,54 @@ func (p *PostgresStorage) GetCounter(ctx context.Context, name string) (int64, b
 	return value, true, nil
 }
 
+func (p *PostgresStorage) GetHistogram(ctx context.Context, name string) (models.HistogramValue, bool, error) {
+	var data []byte
+	err := p.db.QueryRowContext(ctx, "SELECT data FROM histograms WHERE name = $1", name).Scan(&data)
+	if err == sql.ErrNoRows {
+		return models.HistogramValue{}, false, nil
+	}
+	if err != nil {
+		return models.HistogramValue{}, false, err
+	}
+	var value models.HistogramValue
+	if err := json.Unmarshal(data, &value); err != nil {
+		return models.HistogramValue{}, false, fmt.Errorf("failed to decode histogram %s: %w", name, err)
+	}
+	return value, true, nil
+}
+
+func (p *PostgresStorage) GetSketch(ctx context.Context, name string) (models.SketchValue, bool, error) {
+	var data []byte
+	err := p.db.QueryRowContext(ctx, "SELECT data FROM sketches WHERE name = $1", name).Scan(&data)
+	if err == sql.ErrNoRows {
+		return models.SketchValue{}, false, nil
+	}
+	if err != nil {
+		return models.SketchValue{}, false, err
+	}
+	var value models.SketchValue
+	if err := json.Unmarshal(data, &value); err != nil {
+		return models.SketchValue{}, false, fmt.Errorf("failed to decode sketch %s: %w", name, err)
+	}
+	return value, true, nil
+}
+
+func (p *PostgresStorage) GetSet(ctx context.Context, name string) (models.SetValue, bool, error) {
+	var data []byte
+	err := p.db.QueryRowContext(ctx, "SELECT data FROM sets WHERE name = $1", name).Scan(&data)
+	if err == sql.ErrNoRows {
+		return models.SetValue{}, false, nil
+	}
+	if err != nil {
+		return models.SetValue{}, false, err
+	}
+	var value models.SetValue
+	if err := json.Unmarshal(data, &value); err != nil {
+		return models.SetValue{}, false, fmt.Errorf("failed to decode set %s: %w", name, err)
+	}
+	return value, true, nil
+}
+
 func (p *PostgresStorage) GetAll(ctx context.Context) ([]models.Metric, error) {
 
 	var metrics []models.Metric
@@ -177,15 +517,17 @@ func (p *PostgresStorage) GetAll(ctx context.Context) ([]models.Metric, error) {
 	defer rows.Close()
 
 	for rows.Next() {
-		var name string
+		var key string
 		var value float64
-		if err := rows.Scan(&name, &value); err != nil {
+		if err := rows.Scan(&key, &value); err != nil {
 			return nil, err
 		}
+		name, labels := splitSeriesKey(key)
 		metrics = append(metrics, models.Metric{
-			Name:  name,
-			Type:  models.Gauge,
-			Value: value,
+			Name:   name,
+			Labels: labels,
+			Type:   models.Gauge,
+			Value:  value,
 		})
 	}
 	if err := rows.Err(); err != nil {
@@ -199,15 +541,101 @@ func (p *PostgresStorage) GetAll(ctx context.Context) ([]models.Metric, error) {
 	defer rows.Close()
 
 	for rows.Next() {
-		var name string
+		var key string
 		var value int64
-		if err := rows.Scan(&name, &value); err != nil {
+		if err := rows.Scan(&key, &value); err != nil {
 			return nil, err
 		}
+		name, labels := splitSeriesKey(key)
 		metrics = append(metrics, models.Metric{
-			Name:  name,
-			Type:  models.Counter,
-			Value: value,
+			Name:   name,
+			Labels: labels,
+			Type:   models.Counter,
+			Value:  value,
+		})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = p.db.QueryContext(ctx, "SELECT name, data FROM histograms")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query all histograms: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var key string
+		var data []byte
+		if err := rows.Scan(&key, &data); err != nil {
+			return nil, err
+		}
+		var value models.HistogramValue
+		if err := json.Unmarshal(data, &value); err != nil {
+			return nil, fmt.Errorf("failed to decode histogram %s: %w", key, err)
+		}
+		name, labels := splitSeriesKey(key)
+		metrics = append(metrics, models.Metric{
+			Name:   name,
+			Labels: labels,
+			Type:   models.Histogram,
+			Value:  value,
+		})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = p.db.QueryContext(ctx, "SELECT name, data FROM sketches")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query all sketches: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var key string
+		var data []byte
+		if err := rows.Scan(&key, &data); err != nil {
+			return nil, err
+		}
+		var value models.SketchValue
+		if err := json.Unmarshal(data, &value); err != nil {
+			return nil, fmt.Errorf("failed to decode sketch %s: %w", key, err)
+		}
+		name, labels := splitSeriesKey(key)
+		metrics = append(metrics, models.Metric{
+			Name:   name,
+			Labels: labels,
+			Type:   models.Summary,
+			Value:  value,
+		})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = p.db.QueryContext(ctx, "SELECT name, data FROM sets")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query all sets: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var key string
+		var data []byte
+		if err := rows.Scan(&key, &data); err != nil {
+			return nil, err
+		}
+		var value models.SetValue
+		if err := json.Unmarshal(data, &value); err != nil {
+			return nil, fmt.Errorf("failed to decode set %s: %w", key, err)
+		}
+		name, labels := splitSeriesKey(key)
+		metrics = append(metrics, models.Metric{
+			Name:   name,
+			Labels: labels,
+			Type:   models.Set,
+			Value:  value,
 		})
 	}
 	if err := rows.Err(); err != nil {
@@ -216,6 +644,154 @@ func (p *PostgresStorage) GetAll(ctx context.Context) ([]models.Metric, error) {
 	return metrics, nil
 }
 
+// Delete удаляет ряд, его значение и историю в одной транзакции.
+func (p *PostgresStorage) Delete(ctx context.Context, mType, name string) (bool, error) {
+	var deleted bool
+	err := utils.Retry(3, p.retryDelays, func() error {
+		tx, err := p.db.BeginTx(ctx, nil)
+		if err != nil {
+			return checkError(fmt.Errorf("failed to begin transaction: %w", err))
+		}
+		defer tx.Rollback()
+
+		if deleted, err = deleteSeries(ctx, tx, mType, name); err != nil {
+			return checkError(err)
+		}
+		return checkError(tx.Commit())
+	})
+	return deleted, err
+}
+
+// PruneHistory удаляет из таблицы metric_samples значения старше before и возвращает их количество.
+func (p *PostgresStorage) PruneHistory(ctx context.Context, before time.Time) (int64, error) {
+	var pruned int64
+	err := utils.Retry(3, p.retryDelays, func() error {
+		result, err := p.db.ExecContext(ctx, "DELETE FROM metric_samples WHERE ts < $1", before)
+		if err != nil {
+			return checkError(fmt.Errorf("failed to prune history: %w", err))
+		}
+		pruned, err = result.RowsAffected()
+		return err
+	})
+	return pruned, err
+}
+
+// ExpireSeries удаляет ряды, время обновления которых в таблице series раньше before.
+func (p *PostgresStorage) ExpireSeries(ctx context.Context, before time.Time) ([]models.Metric, error) {
+	var expired []models.Metric
+	err := utils.Retry(3, p.retryDelays, func() error {
+		tx, err := p.db.BeginTx(ctx, nil)
+		if err != nil {
+			return checkError(fmt.Errorf("failed to begin transaction: %w", err))
+		}
+		defer tx.Rollback()
+
+		rows, err := tx.QueryContext(ctx, "SELECT type, key FROM series WHERE updated_at < $1 FOR UPDATE", before)
+		if err != nil {
+			return checkError(fmt.Errorf("failed to query expired series: %w", err))
+		}
+		var series [][2]string
+		for rows.Next() {
+			var mType, key string
+			if err := rows.Scan(&mType, &key); err != nil {
+				rows.Close()
+				return err
+			}
+			series = append(series, [2]string{mType, key})
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return checkError(err)
+		}
+
+		for _, s := range series {
+			if _, err := deleteSeries(ctx, tx, s[0], s[1]); err != nil {
+				return checkError(err)
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			return checkError(fmt.Errorf("failed to commit transaction: %w", err))
+		}
+		expired = make([]models.Metric, 0, len(series))
+		for _, s := range series {
+			expired = append(expired, expiredMetric(s[0], s[1]))
+		}
+		return nil
+	})
+	return expired, err
+}
+
+func (p *PostgresStorage) SetMetadata(ctx context.Context, meta models.Metadata) error {
+	return utils.Retry(3, p.retryDelays, func() error {
+		_, err := p.db.ExecContext(ctx, `
+			INSERT INTO metadata (name, unit, help, owner, type)
+			VALUES ($1, $2, $3, $4, $5)
+			ON CONFLICT (name) DO UPDATE SET
+				unit = EXCLUDED.unit, help = EXCLUDED.help, owner = EXCLUDED.owner, type = EXCLUDED.type
+		`, meta.ID, meta.Unit, meta.Help, meta.Owner, meta.Type)
+		return checkError(err)
+	})
+}
+
+func (p *PostgresStorage) GetMetadata(ctx context.Context, name string) (models.Metadata, bool, error) {
+	meta := models.Metadata{ID: name}
+	err := p.db.QueryRowContext(ctx, "SELECT unit, help, owner, type FROM metadata WHERE name = $1", name).
+		Scan(&meta.Unit, &meta.Help, &meta.Owner, &meta.Type)
+	if err == sql.ErrNoRows {
+		return models.Metadata{}, false, nil
+	}
+	if err != nil {
+		return models.Metadata{}, false, err
+	}
+	return meta, true, nil
+}
+
+func (p *PostgresStorage) GetAllMetadata(ctx context.Context) (map[string]models.Metadata, error) {
+	rows, err := p.db.QueryContext(ctx, "SELECT name, unit, help, owner, type FROM metadata")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query metadata: %w", err)
+	}
+	defer rows.Close()
+
+	result := make(map[string]models.Metadata)
+	for rows.Next() {
+		var meta models.Metadata
+		if err := rows.Scan(&meta.ID, &meta.Unit, &meta.Help, &meta.Owner, &meta.Type); err != nil {
+			return nil, err
+		}
+		result[meta.ID] = meta
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (p *PostgresStorage) GetHistory(ctx context.Context, mType, name string, from, to time.Time) ([]models.Sample, error) {
+	rows, err := p.db.QueryContext(ctx, `
+		SELECT ts, value FROM metric_samples
+		WHERE type = $1 AND name = $2 AND ts BETWEEN $3 AND $4
+		ORDER BY ts
+	`, mType, name, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query history: %w", err)
+	}
+	defer rows.Close()
+
+	var samples []models.Sample
+	for rows.Next() {
+		var sample models.Sample
+		if err := rows.Scan(&sample.Timestamp, &sample.Value); err != nil {
+			return nil, err
+		}
+		samples = append(samples, sample)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return samples, nil
+}
+
 func (p *PostgresStorage) Save(ctx context.Context) error {
 	ctx.Done()
 	return nil
@@ -231,6 +807,143 @@ func (p *PostgresStorage) Close() error {
 	return p.db.Close()
 }
 
+// mergeHistogram добавляет приращение к гистограмме внутри транзакции tx.
+func mergeHistogram(ctx context.Context, tx *sql.Tx, key, name string, labels map[string]string, delta models.HistogramValue) error {
+	empty := models.HistogramValue{Bounds: delta.Bounds, Counts: make([]uint64, len(delta.Counts))}
+	return mergeValue(ctx, tx, "histograms", models.Histogram, key, name, labels, empty, func(data []byte) (interface{}, error) {
+		var current models.HistogramValue
+		if err := json.Unmarshal(data, &current); err != nil {
+			return nil, fmt.Errorf("failed to decode histogram %s: %w", key, err)
+		}
+		return current.Merge(delta)
+	})
+}
+
+// mergeSketch добавляет скетч к сохраненному внутри транзакции tx.
+func mergeSketch(ctx context.Context, tx *sql.Tx, key, name string, labels map[string]string, delta models.SketchValue) error {
+	return mergeValue(ctx, tx, "sketches", models.Summary, key, name, labels, models.NewSketch(delta.Alpha), func(data []byte) (interface{}, error) {
+		var current models.SketchValue
+		if err := json.Unmarshal(data, &current); err != nil {
+			return nil, fmt.Errorf("failed to decode sketch %s: %w", key, err)
+		}
+		return current.Merge(delta)
+	})
+}
+
+// mergeSet объединяет множество с сохраненным внутри транзакции tx
+// и записывает в историю оценку количества элементов на момент ts.
+// Элементы окна, которое уже сменилось, отбрасываются.
+func mergeSet(ctx context.Context, tx *sql.Tx, key, name string, labels map[string]string, delta models.SetValue, ts time.Time) error {
+	var merged models.SetValue
+	var stale bool
+	err := mergeValue(ctx, tx, "sets", models.Set, key, name, labels, models.NewSet(delta.Precision), func(data []byte) (interface{}, error) {
+		var current models.SetValue
+		if err := json.Unmarshal(data, &current); err != nil {
+			return nil, fmt.Errorf("failed to decode set %s: %w", key, err)
+		}
+		stale = delta.Start < current.Start
+		var err error
+		merged, err = current.Merge(delta)
+		return merged, err
+	})
+	if err != nil || stale {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "INSERT INTO metric_samples (type, name, ts, value) VALUES ($1, $2, $3, $4)",
+		models.Set, key, ts, float64(merged.Estimate())); err != nil {
+		return fmt.Errorf("failed to record set history: %w", err)
+	}
+	return nil
+}
+
+// mergeValue регистрирует ряд и обновляет значение, хранящееся в JSON в таблице table, функцией merge.
+// Если значения еще нет, сначала создается пустое значение empty. Строка блокируется
+// до конца транзакции, поэтому параллельные обновления не теряются.
+func mergeValue(ctx context.Context, tx *sql.Tx, table, mType, key, name string, labels map[string]string,
+	empty interface{}, merge func(data []byte) (interface{}, error)) error {
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO series (type, key, name, labels)
+		VALUES ($1, $2, $3, $4::jsonb)
+		ON CONFLICT (type, key) DO UPDATE SET updated_at = now()
+	`, mType, key, name, labelsJSON(labels)); err != nil {
+		return fmt.Errorf("failed to register %s series: %w", mType, err)
+	}
+
+	data, err := json.Marshal(empty)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "INSERT INTO "+table+" (name, data) VALUES ($1, $2::jsonb) ON CONFLICT (name) DO NOTHING", key, string(data)); err != nil {
+		return fmt.Errorf("failed to create %s: %w", mType, err)
+	}
+
+	if err := tx.QueryRowContext(ctx, "SELECT data FROM "+table+" WHERE name = $1 FOR UPDATE", key).Scan(&data); err != nil {
+		return fmt.Errorf("failed to lock %s: %w", mType, err)
+	}
+	merged, err := merge(data)
+	if err != nil {
+		return err
+	}
+	if data, err = json.Marshal(merged); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE "+table+" SET data = $2::jsonb WHERE name = $1", key, string(data)); err != nil {
+		return fmt.Errorf("failed to update %s: %w", mType, err)
+	}
+	return nil
+}
+
+// valueTables - таблицы текущих значений метрик по типу.
+var valueTables = map[string]string{
+	models.Gauge:     "gauges",
+	models.Counter:   "counters",
+	models.Histogram: "histograms",
+	models.Summary:   "sketches",
+	models.Set:       "sets",
+}
+
+// deleteSeries удаляет ряд, его значение и историю внутри транзакции tx.
+// Возвращает false, если значения ряда не было.
+func deleteSeries(ctx context.Context, tx *sql.Tx, mType, key string) (bool, error) {
+	table, ok := valueTables[mType]
+	if !ok {
+		return false, models.ErrInvalidMetricType
+	}
+	res, err := tx.ExecContext(ctx, "DELETE FROM "+table+" WHERE name = $1", key)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete %s: %w", mType, err)
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM series WHERE type = $1 AND key = $2", mType, key); err != nil {
+		return false, fmt.Errorf("failed to delete %s series: %w", mType, err)
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM metric_samples WHERE type = $1 AND name = $2", mType, key); err != nil {
+		return false, fmt.Errorf("failed to delete %s history: %w", mType, err)
+	}
+	deleted, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return deleted > 0, nil
+}
+
+// isMergeError сообщает, что значение нельзя объединить с сохраненным. Такие ошибки не повторяются.
+func isMergeError(err error) bool {
+	return errors.Is(err, models.ErrInvalidHistogram) || errors.Is(err, models.ErrInvalidSketch) ||
+		errors.Is(err, models.ErrInvalidSet)
+}
+
+// labelsJSON кодирует метки ряда в JSON для колонки series.labels.
+func labelsJSON(labels map[string]string) string {
+	if len(labels) == 0 {
+		return "{}"
+	}
+	data, err := json.Marshal(labels)
+	if err != nil {
+		return "{}"
+	}
+	return string(data)
+}
+
 func checkError(err error) error {
 	var pgErr *pgconn.PgError
 	if errors.As(err, &pgErr) {
@@ -0,0 +1,116 @@
+// Package repository - реализация хранилища.
+package repository
+
+import (
+	"sort"
+	"time"
+
+	models "github.com/chestorix/monmetrics/internal/metrics"
+)
+
+// defaultHistorySize - количество значений, хранимых в памяти для одной метрики.
+// При опросе раз в 2 секунды этого хватает примерно на 5 часов истории.
+const defaultHistorySize = 8640
+
+// minRingAlloc - начальный размер буфера, который затем растет удвоением до capacity.
+const minRingAlloc = 16
+
+// sampleRing - кольцевой буфер истории одной метрики, вмещающий не больше capacity значений.
+// Память выделяется по мере поступления значений, при переполнении самые старые значения вытесняются.
+// Пока буфер не заполнен, start равен нулю.
+type sampleRing struct {
+	samples  []models.Sample
+	start    int
+	size     int
+	capacity int
+}
+
+func newSampleRing(capacity int) *sampleRing {
+	return &sampleRing{capacity: capacity}
+}
+
+// push добавляет значение, сохраняя порядок по времени: значения с временем клиента
+// (remote write, OTLP, Timestamp в JSON) могут приходить не по порядку.
+// Значения с одинаковым временем хранятся в порядке поступления. При переполнении
+// вытесняется самое старое значение, а значение старее всех хранимых отбрасывается.
+func (r *sampleRing) push(sample models.Sample) {
+	if r.capacity <= 0 {
+		return
+	}
+	pos := sort.Search(r.size, func(i int) bool {
+		return r.at(i).Timestamp.After(sample.Timestamp)
+	})
+	if r.size < r.capacity {
+		r.grow()
+	} else {
+		if pos == 0 {
+			return
+		}
+		r.start = (r.start + 1) % len(r.samples)
+		r.size--
+		pos--
+	}
+	for i := r.size; i > pos; i-- {
+		r.samples[r.index(i)] = r.samples[r.index(i-1)]
+	}
+	r.samples[r.index(pos)] = sample
+	r.size++
+}
+
+// grow обеспечивает место для еще одного значения в незаполненном буфере.
+func (r *sampleRing) grow() {
+	if r.size < len(r.samples) {
+		return
+	}
+	if r.size < cap(r.samples) {
+		r.samples = r.samples[:r.size+1]
+		return
+	}
+	grown := make([]models.Sample, r.size+1, min(max(2*r.size, minRingAlloc), r.capacity))
+	copy(grown, r.samples)
+	r.samples = grown
+}
+
+// trim удаляет значения старше before и возвращает их количество.
+func (r *sampleRing) trim(before time.Time) int {
+	n := sort.Search(r.size, func(i int) bool {
+		return !r.at(i).Timestamp.Before(before)
+	})
+	if n == 0 {
+		return 0
+	}
+	remaining := make([]models.Sample, r.size-n)
+	for i := range remaining {
+		remaining[i] = r.at(n + i)
+	}
+	r.samples = remaining
+	r.start = 0
+	r.size = len(remaining)
+	return n
+}
+
+// between возвращает копию значений, попадающих в период [from, to].
+func (r *sampleRing) between(from, to time.Time) []models.Sample {
+	var result []models.Sample
+	for i := 0; i < r.size; i++ {
+		sample := r.at(i)
+		if sample.Timestamp.Before(from) || sample.Timestamp.After(to) {
+			continue
+		}
+		result = append(result, sample)
+	}
+	return result
+}
+
+// at возвращает i-е по времени значение буфера.
+func (r *sampleRing) at(i int) models.Sample {
+	return r.samples[r.index(i)]
+}
+
+func (r *sampleRing) index(i int) int {
+	return (r.start + i) % len(r.samples)
+}
+
+func historyKey(mType, name string) string {
+	return mType + ":" + name
+}
@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	models "github.com/chestorix/monmetrics/internal/metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func values(samples []models.Sample) []float64 {
+	result := make([]float64, 0, len(samples))
+	for _, sample := range samples {
+		result = append(result, sample.Value)
+	}
+	return result
+}
+
+func TestSampleRing_OutOfOrder(t *testing.T) {
+	base := time.Unix(1700000000, 0)
+	at := func(sec int) time.Time { return base.Add(time.Duration(sec) * time.Second) }
+
+	r := newSampleRing(4)
+	for _, sec := range []int{10, 30, 20, 40, 20} {
+		r.push(models.Sample{Timestamp: at(sec), Value: float64(sec)})
+	}
+	// Буфер заполнен, самое старое значение (10) вытеснено, равные метки хранятся в порядке поступления.
+	assert.Equal(t, []float64{20, 20, 30, 40}, values(r.between(at(0), at(100))))
+
+	// Значение старее всех хранимых в заполненном буфере отбрасывается.
+	r.push(models.Sample{Timestamp: at(5), Value: 5})
+	assert.Equal(t, []float64{20, 20, 30, 40}, values(r.between(at(0), at(100))))
+
+	r.push(models.Sample{Timestamp: at(35), Value: 35})
+	assert.Equal(t, []float64{20, 30, 35}, values(r.between(at(0), at(39))))
+}
+
+func TestSampleRing_Grow(t *testing.T) {
+	base := time.Unix(1700000000, 0)
+	r := newSampleRing(40)
+	assert.Nil(t, r.samples)
+
+	for i := 0; i < 20; i++ {
+		r.push(models.Sample{Timestamp: base.Add(time.Duration(i) * time.Second), Value: float64(i)})
+	}
+	assert.Equal(t, 20, r.size)
+	assert.Equal(t, 32, cap(r.samples))
+
+	for i := 20; i < 50; i++ {
+		r.push(models.Sample{Timestamp: base.Add(time.Duration(i) * time.Second), Value: float64(i)})
+	}
+	assert.Equal(t, 40, cap(r.samples))
+	got := r.between(base, base.Add(time.Hour))
+	assert.Len(t, got, 40)
+	assert.Equal(t, 10.0, got[0].Value)
+	assert.Equal(t, 49.0, got[39].Value)
+
+	assert.Equal(t, 30, r.trim(base.Add(40*time.Second)))
+	assert.Equal(t, []float64{40, 41, 42, 43, 44, 45, 46, 47, 48, 49}, values(r.between(base, base.Add(time.Hour))))
+	r.push(models.Sample{Timestamp: base.Add(time.Minute), Value: 60})
+	assert.Equal(t, 11, r.size)
+}
@@ -7,23 +7,80 @@ import (
 	"fmt"
 	"os"
 	"sync"
+	"time"
 
 	"github.com/chestorix/monmetrics/internal/domain/interfaces"
 	models "github.com/chestorix/monmetrics/internal/metrics"
 )
 
 type MemStorage struct {
-	Gauges   map[string]float64
-	Counters map[string]int64
-	filePath string
-	mu       sync.RWMutex
+	Gauges      map[string]float64
+	Counters    map[string]int64
+	Histograms  map[string]models.HistogramValue
+	Sketches    map[string]models.SketchValue
+	Sets        map[string]models.SetValue
+	Metadata    map[string]models.Metadata
+	history     map[string]*sampleRing
+	updated     map[string]time.Time
+	batches     map[string]time.Time
+	filePath    string
+	historySize int
+	setWindow   time.Duration
+	mu          sync.RWMutex
 }
 
-func NewMemStorage(filePath string) interfaces.Repository {
+// options - необязательные параметры хранилищ.
+type options struct {
+	historySize int
+	setWindow   time.Duration
+}
+
+// Option задает необязательные параметры хранилища.
+type Option func(*options)
+
+// WithHistorySize задает количество значений истории, хранимых для одного ряда в памяти.
+// Нулевое или отрицательное значение оставляет значение по умолчанию.
+func WithHistorySize(size int) Option {
+	return func(o *options) {
+		if size > 0 {
+			o.historySize = size
+		}
+	}
+}
+
+// WithSetWindow задает длительность окна множеств: элементы, добавленные в разных окнах,
+// не объединяются. Нулевое значение накапливает элементы множества без ограничения по времени.
+func WithSetWindow(window time.Duration) Option {
+	return func(o *options) {
+		if window > 0 {
+			o.setWindow = window
+		}
+	}
+}
+
+func newOptions(opts []Option) options {
+	o := options{historySize: defaultHistorySize}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+func NewMemStorage(filePath string, opts ...Option) interfaces.HistoryRepository {
+	o := newOptions(opts)
 	return &MemStorage{
-		Gauges:   make(map[string]float64),
-		Counters: make(map[string]int64),
-		filePath: filePath,
+		Gauges:      make(map[string]float64),
+		Counters:    make(map[string]int64),
+		Histograms:  make(map[string]models.HistogramValue),
+		Sketches:    make(map[string]models.SketchValue),
+		Sets:        make(map[string]models.SetValue),
+		Metadata:    make(map[string]models.Metadata),
+		history:     make(map[string]*sampleRing),
+		updated:     make(map[string]time.Time),
+		batches:     make(map[string]time.Time),
+		filePath:    filePath,
+		historySize: o.historySize,
+		setWindow:   o.setWindow,
 	}
 }
 
@@ -45,14 +102,30 @@ func (m *MemStorage) Load(ctx context.Context) error {
 		return err
 	}
 	var data struct {
-		Gauges   map[string]float64 `json:"gauges"`
-		Counters map[string]int64   `json:"counters"`
+		Gauges     map[string]float64               `json:"gauges"`
+		Counters   map[string]int64                 `json:"counters"`
+		Histograms map[string]models.HistogramValue `json:"histograms"`
+		Sketches   map[string]models.SketchValue    `json:"sketches"`
+		Sets       map[string]models.SetValue       `json:"sets"`
+		Metadata   map[string]models.Metadata       `json:"metadata"`
 	}
 	if err := json.Unmarshal(file, &data); err != nil {
 		return err
 	}
 	m.Gauges = data.Gauges
 	m.Counters = data.Counters
+	if data.Histograms != nil {
+		m.Histograms = data.Histograms
+	}
+	if data.Sketches != nil {
+		m.Sketches = data.Sketches
+	}
+	if data.Sets != nil {
+		m.Sets = data.Sets
+	}
+	if data.Metadata != nil {
+		m.Metadata = data.Metadata
+	}
 	return nil
 }
 
@@ -66,11 +139,19 @@ func (m *MemStorage) Save(ctx context.Context) error {
 	defer m.mu.RUnlock()
 
 	data := struct {
-		Gauges   map[string]float64 `json:"gauges"`
-		Counters map[string]int64   `json:"counters"`
+		Gauges     map[string]float64               `json:"gauges"`
+		Counters   map[string]int64                 `json:"counters"`
+		Histograms map[string]models.HistogramValue `json:"histograms,omitempty"`
+		Sketches   map[string]models.SketchValue    `json:"sketches,omitempty"`
+		Sets       map[string]models.SetValue       `json:"sets,omitempty"`
+		Metadata   map[string]models.Metadata       `json:"metadata,omitempty"`
 	}{
-		Gauges:   m.Gauges,
-		Counters: m.Counters,
+		Gauges:     m.Gauges,
+		Counters:   m.Counters,
+		Histograms: m.Histograms,
+		Sketches:   m.Sketches,
+		Sets:       m.Sets,
+		Metadata:   m.Metadata,
 	}
 
 	file, err := json.Marshal(data)
@@ -94,6 +175,7 @@ func (m *MemStorage) UpdateGauge(ctx context.Context, name string, value float64
 	}
 	m.mu.Lock()
 	m.Gauges[name] = value
+	m.appendSample(models.Gauge, name, value, time.Now())
 	m.mu.Unlock()
 	return nil
 }
@@ -105,16 +187,65 @@ func (m *MemStorage) UpdateCounter(ctx context.Context, name string, value int64
 	}
 	m.mu.Lock()
 	m.Counters[name] += value
+	m.appendSample(models.Counter, name, float64(m.Counters[name]), time.Now())
 	m.mu.Unlock()
 	return nil
 }
 
+func (m *MemStorage) SetCounter(ctx context.Context, name string, value int64) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+	}
+	m.mu.Lock()
+	m.Counters[name] = value
+	m.appendSample(models.Counter, name, float64(value), time.Now())
+	m.mu.Unlock()
+	return nil
+}
+
+func (m *MemStorage) UpdateHistogram(ctx context.Context, name string, value models.HistogramValue) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.mergeHistogram(name, value)
+}
+
+func (m *MemStorage) UpdateSketch(ctx context.Context, name string, value models.SketchValue) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.mergeSketch(name, value)
+}
+
+func (m *MemStorage) UpdateSet(ctx context.Context, name string, value models.SetValue) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.mergeSet(name, value, time.Now())
+}
+
 func (m *MemStorage) GetGauge(ctx context.Context, name string) (float64, bool, error) {
 	select {
 	case <-ctx.Done():
 		return 0, false, ctx.Err()
 	default:
 	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
 	if value, ok := m.Gauges[name]; ok {
 		return value, true, nil
 	}
@@ -127,12 +258,50 @@ func (m *MemStorage) GetCounter(ctx context.Context, name string) (int64, bool,
 		return 0, false, ctx.Err()
 	default:
 	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
 	if value, ok := m.Counters[name]; ok {
 		return value, true, nil
 	}
 	return 0, false, nil
 }
 
+func (m *MemStorage) GetHistogram(ctx context.Context, name string) (models.HistogramValue, bool, error) {
+	select {
+	case <-ctx.Done():
+		return models.HistogramValue{}, false, ctx.Err()
+	default:
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	value, ok := m.Histograms[name]
+	return value, ok, nil
+}
+
+func (m *MemStorage) GetSketch(ctx context.Context, name string) (models.SketchValue, bool, error) {
+	select {
+	case <-ctx.Done():
+		return models.SketchValue{}, false, ctx.Err()
+	default:
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	value, ok := m.Sketches[name]
+	return value, ok, nil
+}
+
+func (m *MemStorage) GetSet(ctx context.Context, name string) (models.SetValue, bool, error) {
+	select {
+	case <-ctx.Done():
+		return models.SetValue{}, false, ctx.Err()
+	default:
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	value, ok := m.Sets[name]
+	return value, ok, nil
+}
+
 func (m *MemStorage) GetAll(ctx context.Context) ([]models.Metric, error) {
 
 	select {
@@ -140,26 +309,162 @@ func (m *MemStorage) GetAll(ctx context.Context) ([]models.Metric, error) {
 		return nil, ctx.Err()
 	default:
 	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
 	var metric []models.Metric
 
-	for name, value := range m.Gauges {
+	for key, value := range m.Gauges {
+		name, labels := splitSeriesKey(key)
+		metric = append(metric, models.Metric{
+			Name:   name,
+			Labels: labels,
+			Type:   models.Gauge,
+			Value:  value,
+		})
+	}
+
+	for key, value := range m.Counters {
+		name, labels := splitSeriesKey(key)
+		metric = append(metric, models.Metric{
+			Name:   name,
+			Labels: labels,
+			Type:   models.Counter,
+			Value:  value,
+		})
+	}
+
+	for key, value := range m.Histograms {
+		name, labels := splitSeriesKey(key)
+		metric = append(metric, models.Metric{
+			Name:   name,
+			Labels: labels,
+			Type:   models.Histogram,
+			Value:  value,
+		})
+	}
+
+	for key, value := range m.Sketches {
+		name, labels := splitSeriesKey(key)
 		metric = append(metric, models.Metric{
-			Name:  name,
-			Type:  models.Gauge,
-			Value: value,
+			Name:   name,
+			Labels: labels,
+			Type:   models.Summary,
+			Value:  value,
 		})
 	}
 
-	for name, value := range m.Counters {
+	for key, value := range m.Sets {
+		name, labels := splitSeriesKey(key)
 		metric = append(metric, models.Metric{
-			Name:  name,
-			Type:  models.Counter,
-			Value: value,
+			Name:   name,
+			Labels: labels,
+			Type:   models.Set,
+			Value:  value,
 		})
 	}
 
 	return metric, nil
 }
+func (m *MemStorage) Delete(ctx context.Context, mType, name string) (bool, error) {
+	select {
+	case <-ctx.Done():
+		return false, ctx.Err()
+	default:
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.deleteSeries(mType, name), nil
+}
+
+// ExpireSeries удаляет ряды, которые не обновлялись с момента before.
+// Время обновления не сохраняется в файл, поэтому для рядов, загруженных из файла,
+// отсчет начинается с первой проверки после загрузки.
+func (m *MemStorage) ExpireSeries(ctx context.Context, before time.Time) ([]models.Metric, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	var expired [][2]string
+	check := func(mType, name string) {
+		key := historyKey(mType, name)
+		updated, ok := m.updated[key]
+		if !ok {
+			m.updated[key] = now
+			return
+		}
+		if updated.Before(before) {
+			expired = append(expired, [2]string{mType, name})
+		}
+	}
+	for name := range m.Gauges {
+		check(models.Gauge, name)
+	}
+	for name := range m.Counters {
+		check(models.Counter, name)
+	}
+	for name := range m.Histograms {
+		check(models.Histogram, name)
+	}
+	for name := range m.Sketches {
+		check(models.Summary, name)
+	}
+	for name := range m.Sets {
+		check(models.Set, name)
+	}
+
+	result := make([]models.Metric, 0, len(expired))
+	for _, series := range expired {
+		m.deleteSeries(series[0], series[1])
+		result = append(result, expiredMetric(series[0], series[1]))
+	}
+	return result, nil
+}
+
+func (m *MemStorage) SetMetadata(ctx context.Context, meta models.Metadata) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+	}
+	m.mu.Lock()
+	m.Metadata[meta.ID] = meta
+	m.mu.Unlock()
+	return nil
+}
+
+func (m *MemStorage) GetMetadata(ctx context.Context, name string) (models.Metadata, bool, error) {
+	select {
+	case <-ctx.Done():
+		return models.Metadata{}, false, ctx.Err()
+	default:
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	meta, ok := m.Metadata[name]
+	return meta, ok, nil
+}
+
+func (m *MemStorage) GetAllMetadata(ctx context.Context) (map[string]models.Metadata, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	result := make(map[string]models.Metadata, len(m.Metadata))
+	for name, meta := range m.Metadata {
+		result[name] = meta
+	}
+	return result, nil
+}
+
 func (m *MemStorage) Close() error {
 	return nil
 }
@@ -173,20 +478,243 @@ func (m *MemStorage) UpdateMetricsBatch(ctx context.Context, metrics []models.Me
 
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	return m.updateMetricsBatch(metrics)
+}
+
+// UpdateMetricsBatchOnce применяет пакет, если ключ key не встречался после since.
+// Ключи хранятся только в памяти и не сохраняются в файл. Ключи старше since удаляются.
+func (m *MemStorage) UpdateMetricsBatchOnce(ctx context.Context, key string, since time.Time, metrics []models.Metrics) (bool, error) {
+	select {
+	case <-ctx.Done():
+		return false, ctx.Err()
+	default:
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for k, ts := range m.batches {
+		if ts.Before(since) {
+			delete(m.batches, k)
+		}
+	}
+	if _, ok := m.batches[key]; ok {
+		return false, nil
+	}
+	if err := m.updateMetricsBatch(metrics); err != nil {
+		return false, err
+	}
+	m.batches[key] = time.Now()
+	return true, nil
+}
+
+// updateMetricsBatch применяет пакет метрик. Вызывается под блокировкой m.mu.
+func (m *MemStorage) updateMetricsBatch(metrics []models.Metrics) error {
+	// Гистограммы и скетчи проверяются заранее, чтобы несовпадение границ или точности
+	// не оставило пакет примененным частично.
+	for _, metric := range metrics {
+		switch {
+		case metric.MType == models.Histogram && metric.Histogram != nil:
+			if current, ok := m.Histograms[metric.Key()]; ok && !current.SameBounds(*metric.Histogram) {
+				return fmt.Errorf("%w: bucket bounds differ from stored histogram %s", models.ErrInvalidHistogram, metric.Key())
+			}
+		case metric.MType == models.Summary && metric.Sketch != nil:
+			if current, ok := m.Sketches[metric.Key()]; ok && current.Alpha != metric.Sketch.Alpha {
+				return fmt.Errorf("%w: alpha differs from stored sketch %s", models.ErrInvalidSketch, metric.Key())
+			}
+		}
+	}
 
 	for _, metric := range metrics {
+		key := metric.Key()
 		switch metric.MType {
 		case models.Gauge:
 			if metric.Value == nil {
 				return fmt.Errorf("gauge value is nil")
 			}
-			m.Gauges[metric.ID] = *metric.Value
+			m.Gauges[key] = *metric.Value
+			m.appendSample(models.Gauge, key, *metric.Value, metric.SampleTime())
 		case models.Counter:
 			if metric.Delta == nil {
 				return fmt.Errorf("counter delta is nil")
 			}
-			m.Counters[metric.ID] += *metric.Delta
+			if metric.Op == models.CounterSet {
+				m.Counters[key] = *metric.Delta
+			} else {
+				m.Counters[key] += *metric.Delta
+			}
+			m.appendSample(models.Counter, key, float64(m.Counters[key]), metric.SampleTime())
+		case models.Histogram:
+			if metric.Histogram == nil {
+				return fmt.Errorf("histogram value is nil")
+			}
+			if err := m.mergeHistogram(key, *metric.Histogram); err != nil {
+				return err
+			}
+		case models.Summary:
+			if metric.Sketch == nil {
+				return fmt.Errorf("sketch is nil")
+			}
+			if err := m.mergeSketch(key, *metric.Sketch); err != nil {
+				return err
+			}
+		case models.Set:
+			if metric.Members == nil {
+				return fmt.Errorf("set members are nil")
+			}
+			if err := m.mergeSet(key, models.NewSetOf(metric.Members...), metric.SampleTime()); err != nil {
+				return err
+			}
 		}
 	}
 	return nil
 }
+
+func (m *MemStorage) GetHistory(ctx context.Context, mType, name string, from, to time.Time) ([]models.Sample, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	ring, ok := m.history[historyKey(mType, name)]
+	if !ok {
+		return nil, nil
+	}
+	return ring.between(from, to), nil
+}
+
+// PruneHistory удаляет из истории всех рядов значения старше before и возвращает их количество.
+func (m *MemStorage) PruneHistory(ctx context.Context, before time.Time) (int64, error) {
+	select {
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	default:
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var pruned int64
+	for key, ring := range m.history {
+		pruned += int64(ring.trim(before))
+		if ring.size == 0 {
+			delete(m.history, key)
+		}
+	}
+	return pruned, nil
+}
+
+// appendSample добавляет значение в историю метрики и отмечает время обновления ряда.
+// Вызывается под блокировкой m.mu.
+func (m *MemStorage) appendSample(mType, name string, value float64, ts time.Time) {
+	m.touch(mType, name)
+	key := historyKey(mType, name)
+	ring, ok := m.history[key]
+	if !ok {
+		ring = newSampleRing(m.historySize)
+		m.history[key] = ring
+	}
+	ring.push(models.Sample{Timestamp: ts, Value: value})
+}
+
+// mergeHistogram добавляет приращение к сохраненной гистограмме. Вызывается под блокировкой m.mu.
+func (m *MemStorage) mergeHistogram(name string, delta models.HistogramValue) error {
+	current, ok := m.Histograms[name]
+	if !ok {
+		current = models.HistogramValue{
+			Bounds: delta.Bounds,
+			Counts: make([]uint64, len(delta.Counts)),
+		}
+	}
+	merged, err := current.Merge(delta)
+	if err != nil {
+		return err
+	}
+	m.Histograms[name] = merged
+	m.touch(models.Histogram, name)
+	return nil
+}
+
+// mergeSketch объединяет скетч с сохраненным. Вызывается под блокировкой m.mu.
+func (m *MemStorage) mergeSketch(name string, delta models.SketchValue) error {
+	current, ok := m.Sketches[name]
+	if !ok {
+		current = models.NewSketch(delta.Alpha)
+	}
+	merged, err := current.Merge(delta)
+	if err != nil {
+		return err
+	}
+	m.Sketches[name] = merged
+	m.touch(models.Summary, name)
+	return nil
+}
+
+// mergeSet объединяет множество, отнесенное к окну времени ts, с сохраненным и записывает
+// в историю оценку количества элементов. Элементы окна, которое уже сменилось, отбрасываются.
+// Вызывается под блокировкой m.mu.
+func (m *MemStorage) mergeSet(name string, delta models.SetValue, ts time.Time) error {
+	delta = delta.InWindow(ts, m.setWindow)
+	current, ok := m.Sets[name]
+	if !ok {
+		current = models.NewSet(delta.Precision)
+	}
+	if delta.Start < current.Start {
+		return nil
+	}
+	merged, err := current.Merge(delta)
+	if err != nil {
+		return err
+	}
+	m.Sets[name] = merged
+	m.appendSample(models.Set, name, float64(merged.Estimate()), ts)
+	return nil
+}
+
+// touch отмечает время обновления ряда для удаления устаревших рядов. Вызывается под блокировкой m.mu.
+func (m *MemStorage) touch(mType, name string) {
+	m.updated[historyKey(mType, name)] = time.Now()
+}
+
+// deleteSeries удаляет ряд вместе с историей. Вызывается под блокировкой m.mu.
+func (m *MemStorage) deleteSeries(mType, name string) bool {
+	var ok bool
+	switch mType {
+	case models.Gauge:
+		_, ok = m.Gauges[name]
+		delete(m.Gauges, name)
+	case models.Counter:
+		_, ok = m.Counters[name]
+		delete(m.Counters, name)
+	case models.Histogram:
+		_, ok = m.Histograms[name]
+		delete(m.Histograms, name)
+	case models.Summary:
+		_, ok = m.Sketches[name]
+		delete(m.Sketches, name)
+	case models.Set:
+		_, ok = m.Sets[name]
+		delete(m.Sets, name)
+	}
+	key := historyKey(mType, name)
+	delete(m.history, key)
+	delete(m.updated, key)
+	return ok
+}
+
+// splitSeriesKey возвращает имя и метки ряда. Ключ, который не удается разобрать, считается именем.
+func splitSeriesKey(key string) (string, map[string]string) {
+	name, labels, err := models.ParseSeriesKey(key)
+	if err != nil {
+		return key, nil
+	}
+	return name, labels
+}
+
+// expiredMetric описывает удаленный ряд типа mType с ключом key.
+func expiredMetric(mType, key string) models.Metric {
+	name, labels := splitSeriesKey(key)
+	return models.Metric{Name: name, Labels: labels, Type: mType}
+}
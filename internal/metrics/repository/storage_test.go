@@ -0,0 +1,74 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	models "github.com/chestorix/monmetrics/internal/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemStorage_GetHistory(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemStorage("", WithHistorySize(3))
+	base := time.Now().Add(-time.Hour).Truncate(time.Millisecond)
+
+	for i, value := range []float64{1, 2, 3, 4} {
+		ts := base.Add(time.Duration(i) * time.Minute).UnixMilli()
+		require.NoError(t, m.UpdateMetricsBatch(ctx, []models.Metrics{{ID: "load", MType: models.Gauge, Value: &value, Timestamp: &ts}}))
+	}
+	delta := int64(5)
+	require.NoError(t, m.UpdateMetricsBatch(ctx, []models.Metrics{{ID: "hits", MType: models.Counter, Delta: &delta}}))
+
+	history, err := m.GetHistory(ctx, models.Gauge, "load", base, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, []float64{2, 3, 4}, values(history))
+
+	history, err = m.GetHistory(ctx, models.Gauge, "load", base, base.Add(2*time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, []float64{2, 3}, values(history))
+
+	history, err = m.GetHistory(ctx, models.Counter, "hits", base, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, []float64{5}, values(history))
+
+	pruned, err := m.PruneHistory(ctx, base.Add(3*time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), pruned)
+	history, err = m.GetHistory(ctx, models.Gauge, "load", base, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, []float64{4}, values(history))
+}
+
+func TestMemStorage_SetWindow(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemStorage("", WithSetWindow(time.Minute))
+	base := time.Now().Add(-time.Hour).Truncate(time.Minute)
+
+	update := func(offset time.Duration, members ...string) {
+		ts := base.Add(offset).UnixMilli()
+		require.NoError(t, m.UpdateMetricsBatch(ctx, []models.Metrics{{ID: "visitors", MType: models.Set, Members: members, Timestamp: &ts}}))
+	}
+	update(0, "alice", "bob")
+	update(30*time.Second, "bob", "carol")
+	update(time.Minute, "dave")
+	update(50*time.Second, "erin")
+
+	set, ok, err := m.GetSet(ctx, "visitors")
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, uint64(1), set.Estimate())
+	assert.Equal(t, base.Add(time.Minute).UnixMilli(), set.Start)
+
+	history, err := m.GetHistory(ctx, models.Set, "visitors", base, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, []float64{2, 3, 1}, values(history))
+
+	// Обновление без метки времени относится к текущему окну.
+	require.NoError(t, m.UpdateSet(ctx, "visitors", models.NewSetOf("frank", "grace")))
+	set, _, err = m.GetSet(ctx, "visitors")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), set.Estimate())
+}
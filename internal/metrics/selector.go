@@ -0,0 +1,152 @@
+// Package models  содержит бизнес-сущности приложения.
+package models
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidSelector = errors.New("invalid selector")
+
+// Операторы сравнения меток в селекторе.
+const (
+	MatchEqual     = "="
+	MatchNotEqual  = "!="
+	MatchRegexp    = "=~"
+	MatchNotRegexp = "!~"
+)
+
+// LabelMatcher - условие на значение метки. Отсутствующая метка считается пустой строкой.
+// Регулярные выражения должны совпадать со всем значением метки.
+type LabelMatcher struct {
+	re    *regexp.Regexp
+	Label string
+	Op    string
+	Value string
+}
+
+// Selector - выборка рядов по имени метрики и условиям на метки,
+// например HeapAlloc{host="web-1",env=~"prod.*"}. Пустое имя подходит под любую метрику.
+type Selector struct {
+	Name     string
+	Matchers []LabelMatcher
+}
+
+// NewLabelMatcher создает условие на метку, компилируя регулярное выражение для операторов =~ и !~.
+func NewLabelMatcher(label, op, value string) (LabelMatcher, error) {
+	m := LabelMatcher{Label: label, Op: op, Value: value}
+	switch op {
+	case MatchEqual, MatchNotEqual:
+	case MatchRegexp, MatchNotRegexp:
+		re, err := regexp.Compile("^(?:" + value + ")$")
+		if err != nil {
+			return LabelMatcher{}, fmt.Errorf("%w: %v", ErrInvalidSelector, err)
+		}
+		m.re = re
+	default:
+		return LabelMatcher{}, fmt.Errorf("%w: unknown operator %q", ErrInvalidSelector, op)
+	}
+	return m, nil
+}
+
+// Matches проверяет значение метки.
+func (m LabelMatcher) Matches(value string) bool {
+	switch m.Op {
+	case MatchEqual:
+		return value == m.Value
+	case MatchNotEqual:
+		return value != m.Value
+	case MatchRegexp:
+		return m.re.MatchString(value)
+	case MatchNotRegexp:
+		return !m.re.MatchString(value)
+	default:
+		return false
+	}
+}
+
+// Matches проверяет, подходит ли ряд с именем name и метками labels под селектор.
+func (s Selector) Matches(name string, labels map[string]string) bool {
+	if s.Name != "" && s.Name != name {
+		return false
+	}
+	for _, m := range s.Matchers {
+		if !m.Matches(labels[m.Label]) {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseSelector разбирает селектор вида name{label="value",label!="value",label=~"re",label!~"re"}.
+// Имя или условия на метки могут быть опущены, но не одновременно.
+// Значения записываются в двойных кавычках с экранированием по правилам Go.
+func ParseSelector(raw string) (Selector, error) {
+	raw = strings.TrimSpace(raw)
+	open := strings.IndexByte(raw, '{')
+	if open < 0 {
+		if raw == "" {
+			return Selector{}, fmt.Errorf("%w: empty selector", ErrInvalidSelector)
+		}
+		return Selector{Name: raw}, nil
+	}
+	if !strings.HasSuffix(raw, "}") {
+		return Selector{}, fmt.Errorf("%w: missing closing brace", ErrInvalidSelector)
+	}
+
+	sel := Selector{Name: strings.TrimSpace(raw[:open])}
+	rest := strings.TrimSpace(raw[open+1 : len(raw)-1])
+	for rest != "" {
+		i := strings.IndexAny(rest, "=!")
+		if i < 0 {
+			return Selector{}, fmt.Errorf("%w: missing operator in %q", ErrInvalidSelector, rest)
+		}
+		label := strings.TrimSpace(rest[:i])
+		if !labelNameRe.MatchString(label) {
+			return Selector{}, fmt.Errorf("%w: invalid label %q", ErrInvalidSelector, label)
+		}
+		rest = rest[i:]
+
+		var op string
+		for _, candidate := range []string{MatchRegexp, MatchNotEqual, MatchNotRegexp, MatchEqual} {
+			if strings.HasPrefix(rest, candidate) {
+				op = candidate
+				break
+			}
+		}
+		if op == "" {
+			return Selector{}, fmt.Errorf("%w: invalid operator in %q", ErrInvalidSelector, rest)
+		}
+		rest = strings.TrimSpace(rest[len(op):])
+
+		if !strings.HasPrefix(rest, `"`) {
+			return Selector{}, fmt.Errorf("%w: unquoted value for %q", ErrInvalidSelector, label)
+		}
+		quoted, err := strconv.QuotedPrefix(rest)
+		if err != nil {
+			return Selector{}, fmt.Errorf("%w: invalid value for %q", ErrInvalidSelector, label)
+		}
+		value, _ := strconv.Unquote(quoted)
+		matcher, err := NewLabelMatcher(label, op, value)
+		if err != nil {
+			return Selector{}, err
+		}
+		sel.Matchers = append(sel.Matchers, matcher)
+
+		rest = strings.TrimSpace(rest[len(quoted):])
+		if rest != "" {
+			if rest[0] != ',' {
+				return Selector{}, fmt.Errorf("%w: expected comma in %q", ErrInvalidSelector, rest)
+			}
+			rest = strings.TrimSpace(rest[1:])
+		}
+	}
+
+	if sel.Name == "" && len(sel.Matchers) == 0 {
+		return Selector{}, fmt.Errorf("%w: empty selector", ErrInvalidSelector)
+	}
+	return sel, nil
+}
@@ -0,0 +1,34 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSelector(t *testing.T) {
+	sel, err := ParseSelector(`HeapAlloc{host="web-1", env=~"prod.*", dc!="eu", role!~"db|cache"}`)
+	require.NoError(t, err)
+	assert.Equal(t, "HeapAlloc", sel.Name)
+	require.Len(t, sel.Matchers, 4)
+
+	assert.True(t, sel.Matches("HeapAlloc", map[string]string{"host": "web-1", "env": "production", "role": "api"}))
+	assert.False(t, sel.Matches("HeapAlloc", map[string]string{"host": "web-1", "env": "staging"}))
+	assert.False(t, sel.Matches("HeapAlloc", map[string]string{"host": "web-1", "env": "prod", "dc": "eu"}))
+	assert.False(t, sel.Matches("HeapAlloc", map[string]string{"host": "web-1", "env": "prod", "role": "db"}))
+	assert.False(t, sel.Matches("FreeMemory", map[string]string{"host": "web-1", "env": "prod"}))
+
+	sel, err = ParseSelector(`{env="prod"}`)
+	require.NoError(t, err)
+	assert.True(t, sel.Matches("FreeMemory", map[string]string{"env": "prod"}))
+
+	sel, err = ParseSelector("FreeMemory")
+	require.NoError(t, err)
+	assert.True(t, sel.Matches("FreeMemory", nil))
+
+	for _, raw := range []string{"", "{}", `a{env="prod"`, `a{env=prod}`, `a{env~"x"}`, `a{1env="x"}`, `a{env=~"("}`, `a{env="x" host="y"}`} {
+		_, err := ParseSelector(raw)
+		assert.ErrorIs(t, err, ErrInvalidSelector, raw)
+	}
+}
@@ -4,8 +4,12 @@ package sender
 import (
 	"bytes"
 	"compress/gzip"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"time"
 
@@ -59,6 +63,7 @@ func (s *HTTPSender) SendJSON(metric models.Metric) error {
 		var m models.Metrics
 		m.ID = metric.Name
 		m.MType = metric.Type
+		m.Labels = metric.Labels
 
 		switch metric.Type {
 		case models.Gauge:
@@ -114,9 +119,24 @@ func (s *HTTPSender) SendJSON(metric models.Metric) error {
 	})
 }
 
-func (s *HTTPSender) SendBatch(metrics []models.Metrics) error {
+// SendBatch отправляет пакет метрик одним запросом в режиме частичного приема
+// и возвращает метрики, отклоненные сервером. Остальные метрики пакета применены.
+// Ответ 200 без тела от сервера, который не поддерживает частичный прием, означает, что применен весь пакет.
+// Все попытки отправки пакета передают один и тот же заголовок Idempotency-Key,
+// поэтому сервер не применит пакет повторно, если ответ на успешный запрос не дошел до агента.
+func (s *HTTPSender) SendBatch(metrics []models.Metrics) ([]models.RejectedMetric, error) {
+	idempotencyKey, err := NewIdempotencyKey()
+	if err != nil {
+		return nil, err
+	}
+	return s.SendBatchWithKey(idempotencyKey, metrics)
+}
 
-	return utils.Retry(3, s.retryDelays, func() error {
+// SendBatchWithKey отправляет пакет метрик с заданным ключом идемпотентности.
+// Используется для повторной отправки пакетов из дисковой очереди с исходным ключом.
+func (s *HTTPSender) SendBatchWithKey(idempotencyKey string, metrics []models.Metrics) ([]models.RejectedMetric, error) {
+	var result models.BatchResult
+	err := utils.Retry(3, s.retryDelays, func() error {
 
 		jsonData, err := json.Marshal(metrics)
 		if err != nil {
@@ -124,10 +144,6 @@ func (s *HTTPSender) SendBatch(metrics []models.Metrics) error {
 		}
 
 		var buf bytes.Buffer
-		enc := json.NewEncoder(&buf)
-		if err := enc.Encode(metrics); err != nil {
-			return err
-		}
 		gz := gzip.NewWriter(&buf)
 		if _, errWrite := gz.Write(jsonData); errWrite != nil {
 			return utils.ErrMaxRetriesExceeded
@@ -136,12 +152,15 @@ func (s *HTTPSender) SendBatch(metrics []models.Metrics) error {
 			return utils.ErrMaxRetriesExceeded
 		}
 
-		req, err := http.NewRequest("POST", s.baseURL+"/updates/", &buf)
+		req, err := http.NewRequest("POST", s.baseURL+"/updates/?partial=true", &buf)
 		if err != nil {
 			return utils.ErrMaxRetriesExceeded
 		}
 		req.Header.Set("Content-Type", "application/json")
 		req.Header.Set("Content-Encoding", "gzip")
+		// Ответ с результатом приема читается без сжатия.
+		req.Header.Set("Accept-Encoding", "identity")
+		req.Header.Set("Idempotency-Key", idempotencyKey)
 		if hash := utils.CalculateHash(jsonData, s.key); hash != "" {
 			req.Header.Set("HashSHA256", hash)
 		}
@@ -160,6 +179,25 @@ func (s *HTTPSender) SendBatch(metrics []models.Metrics) error {
 		if resp.StatusCode != http.StatusOK {
 			return utils.ErrMaxRetriesExceeded
 		}
+		// Сервер без частичного приема не знает параметра partial и отвечает 200 без тела:
+		// пакет применен целиком.
+		result = models.BatchResult{}
+		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil && !errors.Is(err, io.EOF) {
+			return utils.ErrMaxRetriesExceeded
+		}
 		return nil
 	})
+	if err != nil {
+		return nil, err
+	}
+	return result.Rejected, nil
+}
+
+// NewIdempotencyKey возвращает случайный ключ идемпотентности пакета.
+func NewIdempotencyKey() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate idempotency key: %w", err)
+	}
+	return hex.EncodeToString(b), nil
 }
@@ -0,0 +1,41 @@
+package sender
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	models "github.com/chestorix/monmetrics/internal/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPSender_SendBatchWithKey(t *testing.T) {
+	var body string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "batch-1", r.Header.Get("Idempotency-Key"))
+		if body != "" {
+			w.Header().Set("Content-Type", "application/json")
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(body))
+	}))
+	defer srv.Close()
+	s := NewHTTPSender(srv.URL, "")
+	delta := int64(1)
+	metrics := []models.Metrics{{ID: "requests", MType: models.Counter, Delta: &delta}}
+
+	// Сервер без частичного приема отвечает пустым телом.
+	rejected, err := s.SendBatchWithKey("batch-1", metrics)
+	require.NoError(t, err)
+	assert.Empty(t, rejected)
+
+	want := []models.RejectedMetric{{ID: "requests", Reason: "invalid", Index: 0}}
+	data, err := json.Marshal(models.BatchResult{Rejected: want})
+	require.NoError(t, err)
+	body = string(data)
+	rejected, err = s.SendBatchWithKey("batch-1", metrics)
+	require.NoError(t, err)
+	assert.Equal(t, want, rejected)
+}
@@ -0,0 +1,121 @@
+// Package models  содержит бизнес-сущности приложения.
+package models
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrInvalidLabels     = errors.New("invalid labels")
+	ErrInvalidMetricName = errors.New("invalid metric name")
+)
+
+// labelNameRe - допустимое имя метки.
+var labelNameRe = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// SeriesKey возвращает ключ ряда, однозначно определяющий метрику по имени и набору меток:
+// name{label1="value1",label2="value2"} с метками, отсортированными по имени.
+// Для метрики без меток ключ совпадает с именем, что сохраняет совместимость с ранее сохраненными данными.
+// Ключ однозначен, только если имя прошло ValidateName.
+func SeriesKey(name string, labels map[string]string) string {
+	if len(labels) == 0 {
+		return name
+	}
+	names := make([]string, 0, len(labels))
+	for label := range labels {
+		names = append(names, label)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteString(name)
+	b.WriteByte('{')
+	for i, label := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(label)
+		b.WriteByte('=')
+		b.WriteString(strconv.Quote(labels[label]))
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// ParseSeriesKey разбирает ключ ряда, построенный SeriesKey, на имя и метки.
+// Ключ без меток возвращается как имя с пустыми метками.
+func ParseSeriesKey(key string) (string, map[string]string, error) {
+	open := strings.IndexByte(key, '{')
+	if open < 0 || !strings.HasSuffix(key, "}") {
+		return key, nil, nil
+	}
+	name := key[:open]
+	rest := key[open+1 : len(key)-1]
+
+	labels := make(map[string]string)
+	for rest != "" {
+		label, value, ok := strings.Cut(rest, "=")
+		if !ok || !labelNameRe.MatchString(label) {
+			return "", nil, fmt.Errorf("%w: %q", ErrInvalidLabels, key)
+		}
+		quoted, err := strconv.QuotedPrefix(value)
+		if err != nil {
+			return "", nil, fmt.Errorf("%w: %q", ErrInvalidLabels, key)
+		}
+		labels[label], _ = strconv.Unquote(quoted)
+		rest = strings.TrimPrefix(value[len(quoted):], ",")
+	}
+	return name, labels, nil
+}
+
+// ValidateName проверяет, что имя метрики не содержит символов {, } и ", которыми в ключе ряда
+// записываются метки. Иначе метрика a{b="c"} без меток совпала бы с метрикой a с меткой b=c.
+func ValidateName(name string) error {
+	if strings.ContainsAny(name, `{}"`) {
+		return fmt.Errorf("%w: %q", ErrInvalidMetricName, name)
+	}
+	return nil
+}
+
+// ValidateLabels проверяет, что имена меток допустимы.
+func ValidateLabels(labels map[string]string) error {
+	for label := range labels {
+		if !labelNameRe.MatchString(label) {
+			return fmt.Errorf("%w: %q", ErrInvalidLabels, label)
+		}
+	}
+	return nil
+}
+
+// SanitizeLabelName приводит произвольную строку к допустимому имени метки,
+// заменяя недопустимые символы на подчеркивание.
+func SanitizeLabelName(name string) string {
+	var b strings.Builder
+	for i, c := range name {
+		switch {
+		case c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z'):
+			b.WriteRune(c)
+		case c >= '0' && c <= '9':
+			if i == 0 {
+				b.WriteRune('_')
+			}
+			b.WriteRune(c)
+		default:
+			b.WriteRune('_')
+		}
+	}
+	if b.Len() == 0 {
+		return "_"
+	}
+	return b.String()
+}
+
+// Key возвращает ключ ряда метрики.
+func (m Metrics) Key() string {
+	return SeriesKey(m.ID, m.Labels)
+}
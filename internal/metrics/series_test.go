@@ -0,0 +1,43 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSeriesKey(t *testing.T) {
+	assert.Equal(t, "Alloc", SeriesKey("Alloc", nil))
+
+	labels := map[string]string{"mount": "/var", "device": `sda"1`}
+	key := SeriesKey("disk_free", labels)
+	assert.Equal(t, `disk_free{device="sda\"1",mount="/var"}`, key)
+
+	name, parsed, err := ParseSeriesKey(key)
+	require.NoError(t, err)
+	assert.Equal(t, "disk_free", name)
+	assert.Equal(t, labels, parsed)
+
+	name, parsed, err = ParseSeriesKey("Alloc")
+	require.NoError(t, err)
+	assert.Equal(t, "Alloc", name)
+	assert.Empty(t, parsed)
+
+	_, _, err = ParseSeriesKey(`disk_free{1mount="/"}`)
+	assert.ErrorIs(t, err, ErrInvalidLabels)
+}
+
+func TestValidateName(t *testing.T) {
+	assert.NoError(t, ValidateName("disk_free.bytes"))
+	for _, name := range []string{`a{b="c"}`, "a{", "a}", `a"`} {
+		assert.ErrorIs(t, ValidateName(name), ErrInvalidMetricName, name)
+	}
+}
+
+func TestValidateLabels(t *testing.T) {
+	assert.NoError(t, ValidateLabels(map[string]string{"host": "web-1", "_zone": "a"}))
+	assert.ErrorIs(t, ValidateLabels(map[string]string{"host.name": "web-1"}), ErrInvalidLabels)
+	assert.Equal(t, "host_name", SanitizeLabelName("host.name"))
+	assert.Equal(t, "_1st", SanitizeLabelName("1st"))
+}
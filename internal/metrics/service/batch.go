@@ -0,0 +1,157 @@
+// Package service - реализация бизнес-логики.
+package service
+
+import (
+	"context"
+	"fmt"
+
+	models "github.com/chestorix/monmetrics/internal/metrics"
+)
+
+// UpdateMetricsBatchPartial обновляет пакет метрик в режиме частичного приема: каждая метрика проверяется
+// отдельно, корректные метрики применяются за одну транзакцию, а отклоненные возвращаются в результате
+// с позицией в пакете и причиной. Ключ идемпотентности key обрабатывается как в UpdateMetricsBatchOnce,
+// при повторе пакета второе значение равно false.
+func (s *MetricsService) UpdateMetricsBatchPartial(ctx context.Context, key string, metrics []models.Metrics) (models.BatchResult, bool, error) {
+	result := models.BatchResult{Rejected: []models.RejectedMetric{}}
+	var valid []models.Metrics
+	accepted := newBatchIndex()
+	for i, metric := range metrics {
+		if err := s.checkBatchMetric(ctx, metric, accepted); err != nil {
+			result.Rejected = append(result.Rejected, models.RejectedMetric{ID: metric.ID, Reason: err.Error(), Index: i})
+			continue
+		}
+		accepted.add(metric)
+		valid = append(valid, metric)
+	}
+	if len(valid) == 0 {
+		return result, true, nil
+	}
+
+	applied, err := s.UpdateMetricsBatchOnce(ctx, key, valid)
+	if err != nil {
+		return models.BatchResult{}, false, err
+	}
+	result.Accepted = len(valid)
+	return result, applied, nil
+}
+
+// batchIndex - метрики пакета, уже принятые при частичном приеме. Следующие метрики пакета сверяются
+// с ними так же, как с сохраненными: иначе две новые гистограммы с разными границами прошли бы
+// проверку по отдельности, а хранилище отклонило бы весь пакет.
+type batchIndex struct {
+	types      map[string]string
+	histograms map[string]models.HistogramValue
+	alphas     map[string]float64
+}
+
+func newBatchIndex() *batchIndex {
+	return &batchIndex{
+		types:      make(map[string]string),
+		histograms: make(map[string]models.HistogramValue),
+		alphas:     make(map[string]float64),
+	}
+}
+
+// add запоминает принятую метрику. Учитывается первая метрика ряда: следующие совпадают с ней.
+func (b *batchIndex) add(metric models.Metrics) {
+	if _, ok := b.types[metric.ID]; !ok {
+		b.types[metric.ID] = metric.MType
+	}
+	key := metric.Key()
+	switch metric.MType {
+	case models.Histogram:
+		if _, ok := b.histograms[key]; !ok {
+			b.histograms[key] = *metric.Histogram
+		}
+	case models.Summary:
+		if _, ok := b.alphas[key]; !ok {
+			b.alphas[key] = metric.Sketch.Alpha
+		}
+	}
+}
+
+// checkBatchMetric проверяет метрику пакета целиком, включая тип, зарегистрированный в режиме контроля типов,
+// и совместимость гистограмм и скетчей с сохраненными и принятыми ранее в том же пакете,
+// чтобы ошибка хранилища не отклонила весь пакет.
+func (s *MetricsService) checkBatchMetric(ctx context.Context, metric models.Metrics, accepted *batchIndex) error {
+	if err := validateMetric(metric); err != nil {
+		return err
+	}
+	if registered, ok := accepted.types[metric.ID]; ok && s.strictTypes && registered != metric.MType {
+		return typeConflict(metric.ID, registered, metric.MType)
+	}
+	if _, err := s.checkTypes(ctx, []models.Metrics{metric}); err != nil {
+		return err
+	}
+
+	switch metric.MType {
+	case models.Histogram:
+		if first, ok := accepted.histograms[metric.Key()]; ok {
+			if !first.SameBounds(*metric.Histogram) {
+				return fmt.Errorf("%w: bucket bounds differ from histogram %s earlier in the batch", models.ErrInvalidHistogram, metric.Key())
+			}
+			return nil
+		}
+		current, ok, err := s.repo.GetHistogram(ctx, metric.Key())
+		if err != nil {
+			return err
+		}
+		if ok && !current.SameBounds(*metric.Histogram) {
+			return fmt.Errorf("%w: bucket bounds differ from stored histogram %s", models.ErrInvalidHistogram, metric.Key())
+		}
+	case models.Summary:
+		if alpha, ok := accepted.alphas[metric.Key()]; ok {
+			if alpha != metric.Sketch.Alpha {
+				return fmt.Errorf("%w: alpha differs from sketch %s earlier in the batch", models.ErrInvalidSketch, metric.Key())
+			}
+			return nil
+		}
+		current, ok, err := s.repo.GetSketch(ctx, metric.Key())
+		if err != nil {
+			return err
+		}
+		if ok && current.Alpha != metric.Sketch.Alpha {
+			return fmt.Errorf("%w: alpha differs from stored sketch %s", models.ErrInvalidSketch, metric.Key())
+		}
+	}
+	return nil
+}
+
+// validateMetric проверяет метрику пакета без обращения к хранилищу: тип, наличие значения,
+// операцию над счетчиком, имя, метки, гистограмму и скетч.
+func validateMetric(metric models.Metrics) error {
+	if err := validateCounterOp(metric); err != nil {
+		return err
+	}
+	if err := models.ValidateName(metric.ID); err != nil {
+		return err
+	}
+	if err := models.ValidateLabels(metric.Labels); err != nil {
+		return err
+	}
+
+	var missing bool
+	switch metric.MType {
+	case models.Gauge:
+		missing = metric.Value == nil
+	case models.Counter:
+		missing = metric.Delta == nil && metric.Op != models.CounterReset
+	case models.Histogram:
+		if missing = metric.Histogram == nil; !missing {
+			return metric.Histogram.Validate()
+		}
+	case models.Summary:
+		if missing = metric.Sketch == nil; !missing {
+			return metric.Sketch.Validate()
+		}
+	case models.Set:
+		missing = metric.Members == nil
+	default:
+		return fmt.Errorf("%w: %q", models.ErrInvalidMetricType, metric.MType)
+	}
+	if missing {
+		return fmt.Errorf("%w: missing %s value for %s", models.ErrInvalidMetricType, metric.MType, metric.ID)
+	}
+	return nil
+}
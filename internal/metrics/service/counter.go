@@ -0,0 +1,138 @@
+// Package service - реализация бизнес-логики.
+package service
+
+import (
+	"context"
+	"fmt"
+
+	models "github.com/chestorix/monmetrics/internal/metrics"
+)
+
+// counterOp проверяет операцию метрики и приводит ее к одной из двух, которые выполняет хранилище:
+// приращению (пустая операция) или присваиванию (models.CounterSet).
+// Сброс становится присваиванием нуля, накопленный итог - приращением относительно предыдущего итога.
+// Операция допустима только для счетчиков.
+// В totals собираются итоги, уже учтенные в пакете: следующий итог того же ряда в пакете
+// отсчитывается от них, а не от сохраненного. Для одиночной метрики totals может быть nil.
+func (s *MetricsService) counterOp(ctx context.Context, metric models.Metrics, totals map[string]int64) (models.Metrics, error) {
+	if metric.Op == "" {
+		return metric, nil
+	}
+	if err := validateCounterOp(metric); err != nil {
+		return metric, err
+	}
+
+	switch metric.Op {
+	case models.CounterAdd:
+		metric.Op = ""
+	case models.CounterSet:
+		if metric.Delta == nil {
+			return metric, models.ErrInvalidMetricType
+		}
+	case models.CounterReset:
+		var zero int64
+		metric.Delta = &zero
+		metric.Op = models.CounterSet
+	case models.CounterCumulative:
+		if metric.Delta == nil {
+			return metric, models.ErrInvalidMetricType
+		}
+		if *metric.Delta < 0 {
+			return metric, fmt.Errorf("%w: cumulative total must not be negative", models.ErrInvalidCounterOp)
+		}
+		key := metric.Key()
+		delta, err := s.cumulativeDelta(ctx, key, *metric.Delta, totals)
+		if err != nil {
+			return metric, err
+		}
+		if totals != nil {
+			totals[key] = *metric.Delta
+		}
+		metric.Delta = &delta
+		metric.Op = ""
+	}
+	return metric, nil
+}
+
+// validateCounterOp проверяет, что операция известна и задана для счетчика.
+func validateCounterOp(metric models.Metrics) error {
+	switch metric.Op {
+	case "":
+		return nil
+	case models.CounterAdd, models.CounterSet, models.CounterReset, models.CounterCumulative:
+	default:
+		return fmt.Errorf("%w: unknown operation %q", models.ErrInvalidCounterOp, metric.Op)
+	}
+	if metric.MType != models.Counter {
+		return fmt.Errorf("%w: %s is not supported for %s", models.ErrInvalidCounterOp, metric.Op, metric.MType)
+	}
+	return nil
+}
+
+// cumulativeDelta переводит накопленный итог источника в приращение счетчика key.
+// Если итог уменьшился, источник считается перезапущенным и итог целиком становится приращением.
+// Предыдущим считается итог из batch, если ряд уже встречался в пакете, иначе запомненный итог.
+// Запомненные итоги хранятся в памяти и обновляются commitCumulative только после записи.
+// Если для ряда итог еще не известен, а счетчик уже существует (например, после перезапуска сервера),
+// первый итог только запоминается, чтобы не учесть его повторно.
+func (s *MetricsService) cumulativeDelta(ctx context.Context, key string, total int64, batch map[string]int64) (int64, error) {
+	prev, ok := batch[key]
+	if !ok {
+		s.cumulativeMu.Lock()
+		prev, ok = s.cumulative[key]
+		s.cumulativeMu.Unlock()
+	}
+	if ok {
+		if total < prev {
+			return total, nil
+		}
+		return total - prev, nil
+	}
+
+	_, exists, err := s.repo.GetCounter(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+	if exists {
+		return 0, nil
+	}
+	return total, nil
+}
+
+// lockCumulative сериализует запись пакетов с накопленными итогами: приращения вычисляются
+// от запомненных итогов, поэтому два одновременных пакета не должны вычислить их от одного итога.
+// Пакеты без накопленных итогов не блокируются. Возвращает функцию снятия блокировки.
+func (s *MetricsService) lockCumulative(metrics []models.Metrics) func() {
+	for _, metric := range metrics {
+		if metric.Op == models.CounterCumulative {
+			s.cumulativeWriteMu.Lock()
+			return s.cumulativeWriteMu.Unlock
+		}
+	}
+	return func() {}
+}
+
+// commitCumulative запоминает накопленные итоги пакета, для каждого ряда - последний.
+// Вызывается после успешной записи, чтобы при ошибке хранилища повтор того же итога снова дал приращение.
+func (s *MetricsService) commitCumulative(metrics []models.Metrics) {
+	s.cumulativeMu.Lock()
+	defer s.cumulativeMu.Unlock()
+	for _, metric := range metrics {
+		if metric.Op == models.CounterCumulative && metric.Delta != nil {
+			s.cumulative[metric.Key()] = *metric.Delta
+		}
+	}
+}
+
+// forgetCumulative удаляет запомненные итоги удаленных счетчиков keys, чтобы следующий итог
+// создал счетчик заново, а не стал приращением к удаленному значению.
+func (s *MetricsService) forgetCumulative(keys ...string) {
+	if len(keys) == 0 {
+		return
+	}
+	s.cumulativeMu.Lock()
+	defer s.cumulativeMu.Unlock()
+	for _, key := range keys {
+		delete(s.cumulative, key)
+	}
+}
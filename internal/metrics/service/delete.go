@@ -0,0 +1,95 @@
+// Package service - реализация бизнес-логики.
+package service
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	models "github.com/chestorix/monmetrics/internal/metrics"
+)
+
+// DeleteMetric удаляет ряд метрики вместе с историей. Ряд определяется ключом name.
+// Если ряда нет, возвращается ErrMetricNotFound.
+func (s *MetricsService) DeleteMetric(ctx context.Context, mType, name string) error {
+	if !models.IsValidType(mType) {
+		return models.ErrInvalidMetricType
+	}
+	deleted, err := s.repo.Delete(ctx, mType, name)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return models.ErrMetricNotFound
+	}
+	if mType == models.Counter {
+		s.forgetCumulative(name)
+	}
+	return nil
+}
+
+// DeleteSeries удаляет все ряды, имя которых начинается с prefix и которые подходят под селектор,
+// и возвращает их количество. Пустые prefix и selector не ограничивают выборку, но хотя бы один
+// из них должен быть задан. Пустой mType означает метрики любого типа.
+func (s *MetricsService) DeleteSeries(ctx context.Context, mType, prefix, selector string) (int, error) {
+	if mType != "" && !models.IsValidType(mType) {
+		return 0, models.ErrInvalidMetricType
+	}
+	if prefix == "" && selector == "" {
+		return 0, models.ErrInvalidSelector
+	}
+	var sel models.Selector
+	if selector != "" {
+		var err error
+		if sel, err = models.ParseSelector(selector); err != nil {
+			return 0, err
+		}
+	}
+
+	all, err := s.repo.GetAll(ctx)
+	if err != nil {
+		return 0, err
+	}
+	var deleted int
+	var counters []string
+	defer func() { s.forgetCumulative(counters...) }()
+	for _, metric := range all {
+		if (mType != "" && metric.Type != mType) || !strings.HasPrefix(metric.Name, prefix) ||
+			!sel.Matches(metric.Name, metric.Labels) {
+			continue
+		}
+		key := models.SeriesKey(metric.Name, metric.Labels)
+		ok, err := s.repo.Delete(ctx, metric.Type, key)
+		if err != nil {
+			return deleted, err
+		}
+		if ok {
+			deleted++
+			if metric.Type == models.Counter {
+				counters = append(counters, key)
+			}
+		}
+	}
+	return deleted, nil
+}
+
+// ExpireSeries удаляет ряды, которые не обновлялись дольше ttl, и возвращает их количество.
+func (s *MetricsService) ExpireSeries(ctx context.Context, ttl time.Duration) (int, error) {
+	expired, err := s.repo.ExpireSeries(ctx, time.Now().Add(-ttl))
+	if err != nil {
+		return 0, err
+	}
+	var counters []string
+	for _, metric := range expired {
+		if metric.Type == models.Counter {
+			counters = append(counters, models.SeriesKey(metric.Name, metric.Labels))
+		}
+	}
+	s.forgetCumulative(counters...)
+	return len(expired), nil
+}
+
+// PruneHistory удаляет из истории значения старше ttl и возвращает их количество.
+func (s *MetricsService) PruneHistory(ctx context.Context, ttl time.Duration) (int64, error) {
+	return s.repo.PruneHistory(ctx, time.Now().Add(-ttl))
+}
@@ -0,0 +1,355 @@
+// Package service - реализация бизнес-логики.
+package service
+
+import (
+	"context"
+	"errors"
+	"sort"
+
+	models "github.com/chestorix/monmetrics/internal/metrics"
+	"github.com/chestorix/monmetrics/internal/metrics/aggregate"
+)
+
+// groupFuncs - функции, которыми можно объединять ряды внутри группы.
+var groupFuncs = map[string]bool{
+	aggregate.Sum:   true,
+	aggregate.Avg:   true,
+	aggregate.Min:   true,
+	aggregate.Max:   true,
+	aggregate.Count: true,
+}
+
+// Select возвращает текущие значения рядов, подходящих под селектор, отсортированные по ключу ряда.
+// Пустой mType означает метрики любого типа.
+func (s *MetricsService) Select(ctx context.Context, mType, selector string) ([]models.Metrics, error) {
+	switch mType {
+	case "", models.Gauge, models.Counter, models.Histogram, models.Summary, models.Set:
+	default:
+		return nil, models.ErrInvalidMetricType
+	}
+	sel, err := models.ParseSelector(selector)
+	if err != nil {
+		return nil, err
+	}
+
+	all, err := s.repo.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]models.Metrics, 0)
+	for _, metric := range all {
+		if (mType != "" && metric.Type != mType) || !sel.Matches(metric.Name, metric.Labels) {
+			continue
+		}
+		m := models.Metrics{ID: metric.Name, MType: metric.Type, Labels: metric.Labels}
+		switch v := metric.Value.(type) {
+		case float64:
+			m.Value = &v
+		case int64:
+			m.Delta = &v
+		case models.HistogramValue:
+			m.Histogram = &v
+		case models.SketchValue:
+			m.Sketch = &v
+		case models.SetValue:
+			estimate := int64(v.Estimate())
+			m.Delta = &estimate
+		}
+		result = append(result, m)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].MType != result[j].MType {
+			return result[i].MType > result[j].MType
+		}
+		return result[i].Key() < result[j].Key()
+	})
+	return result, nil
+}
+
+// QueryRangeSeries возвращает историю всех рядов, подходящих под селектор query.ID.
+// Функция query.Func вычисляется для каждого ряда отдельно, как в QueryRange.
+// Если заданы метки группировки query.By или функция query.Agg, ряды объединяются в группы
+// по значениям меток By, а значения группы в каждом интервале - функцией Agg (по умолчанию sum).
+func (s *MetricsService) QueryRangeSeries(ctx context.Context, query models.RangeQuery) (models.SelectRangeResult, error) {
+	if err := validateSelectQuery(&query); err != nil {
+		return models.SelectRangeResult{}, err
+	}
+	if query.MType == models.Summary || query.Step <= 0 || query.To.Sub(query.From)/query.Step > maxRangePoints {
+		return models.SelectRangeResult{}, models.ErrInvalidQuery
+	}
+
+	series, err := s.selectSeries(ctx, query)
+	if err != nil {
+		return models.SelectRangeResult{}, err
+	}
+
+	groups := newSeriesGroups(query)
+	for _, metric := range series {
+		samples, err := s.repo.GetHistory(ctx, query.MType, metric.Key(), query.From, query.To)
+		if err != nil {
+			return models.SelectRangeResult{}, err
+		}
+		points, err := rangePoints(samples, query)
+		if err != nil {
+			return models.SelectRangeResult{}, err
+		}
+		if len(points) > 0 {
+			g := groups.group(metric)
+			g.points = append(g.points, points)
+		}
+	}
+
+	result := models.SelectRangeResult{
+		Match:  query.ID,
+		MType:  query.MType,
+		Func:   query.Func,
+		Agg:    query.Agg,
+		Step:   query.Step.String(),
+		By:     query.By,
+		Series: make([]models.SeriesRange, 0, len(groups.order)),
+	}
+	for _, g := range groups.list() {
+		points := g.points[0]
+		if groups.grouped {
+			points, err = combinePoints(query.Agg, g.points)
+			if err != nil {
+				return models.SelectRangeResult{}, err
+			}
+		}
+		result.Series = append(result.Series, models.SeriesRange{Labels: g.labels, ID: g.id, Points: points})
+	}
+	return result, nil
+}
+
+// AggregateSeries вычисляет функцию query.Func над историей каждого ряда, подходящего под селектор query.ID.
+// Группировка выполняется так же, как в QueryRangeSeries. Ряды без достаточного количества значений пропускаются.
+// Скетчи summary внутри группы объединяются, и функция вычисляется по объединенному скетчу.
+func (s *MetricsService) AggregateSeries(ctx context.Context, query models.RangeQuery) (models.SelectAggregateResult, error) {
+	if err := validateSelectQuery(&query); err != nil {
+		return models.SelectAggregateResult{}, err
+	}
+
+	series, err := s.selectSeries(ctx, query)
+	if err != nil {
+		return models.SelectAggregateResult{}, err
+	}
+	if query.MType == models.Summary {
+		return s.aggregateSketchSeries(ctx, query, series)
+	}
+
+	groups := newSeriesGroups(query)
+	for _, metric := range series {
+		samples, err := s.repo.GetHistory(ctx, query.MType, metric.Key(), query.From, query.To)
+		if err != nil {
+			return models.SelectAggregateResult{}, err
+		}
+		value, err := aggregate.Apply(query.Func, samples)
+		if err != nil {
+			if errors.Is(err, aggregate.ErrNotEnoughPoints) {
+				continue
+			}
+			return models.SelectAggregateResult{}, err
+		}
+		g := groups.group(metric)
+		g.points = append(g.points, []models.Sample{{Value: value}})
+	}
+
+	result := models.SelectAggregateResult{
+		From:   query.From,
+		To:     query.To,
+		Match:  query.ID,
+		MType:  query.MType,
+		Func:   query.Func,
+		Agg:    query.Agg,
+		By:     query.By,
+		Series: make([]models.SeriesValue, 0, len(groups.order)),
+	}
+	for _, g := range groups.list() {
+		values := make([]models.Sample, 0, len(g.points))
+		for _, points := range g.points {
+			values = append(values, points[0])
+		}
+		value := values[0].Value
+		if groups.grouped {
+			if value, err = aggregate.Apply(query.Agg, values); err != nil {
+				return models.SelectAggregateResult{}, err
+			}
+		}
+		result.Series = append(result.Series, models.SeriesValue{Labels: g.labels, ID: g.id, Value: value})
+	}
+	return result, nil
+}
+
+// aggregateSketchSeries объединяет скетчи рядов каждой группы и вычисляет по ним функцию query.Func.
+func (s *MetricsService) aggregateSketchSeries(ctx context.Context, query models.RangeQuery, series []models.Metrics) (models.SelectAggregateResult, error) {
+	groups := newSeriesGroups(query)
+	for _, metric := range series {
+		sketch, exists, err := s.repo.GetSketch(ctx, metric.Key())
+		if err != nil {
+			return models.SelectAggregateResult{}, err
+		}
+		if exists {
+			g := groups.group(metric)
+			g.sketches = append(g.sketches, sketch)
+		}
+	}
+
+	result := models.SelectAggregateResult{
+		From:   query.From,
+		To:     query.To,
+		Match:  query.ID,
+		MType:  query.MType,
+		Func:   query.Func,
+		Agg:    query.Agg,
+		By:     query.By,
+		Series: make([]models.SeriesValue, 0, len(groups.order)),
+	}
+	for _, g := range groups.list() {
+		merged := g.sketches[0]
+		for _, sketch := range g.sketches[1:] {
+			var err error
+			if merged, err = merged.Merge(sketch); err != nil {
+				return models.SelectAggregateResult{}, err
+			}
+		}
+		value, err := aggregate.ApplySketch(query.Func, merged)
+		if err != nil {
+			if errors.Is(err, aggregate.ErrNotEnoughPoints) {
+				continue
+			}
+			return models.SelectAggregateResult{}, err
+		}
+		result.Series = append(result.Series, models.SeriesValue{Labels: g.labels, ID: g.id, Value: value})
+	}
+	return result, nil
+}
+
+// validateSelectQuery проверяет параметры запроса по селектору и подставляет функцию объединения по умолчанию.
+func validateSelectQuery(query *models.RangeQuery) error {
+	if err := validateQuery(query); err != nil {
+		return err
+	}
+	if len(query.By) > 0 && query.Agg == "" {
+		query.Agg = aggregate.Sum
+	}
+	if query.Agg != "" && !groupFuncs[query.Agg] {
+		return models.ErrInvalidQuery
+	}
+	// Скетчи группы можно только объединить, что соответствует сумме распределений.
+	if query.MType == models.Summary && query.Agg != "" && query.Agg != aggregate.Sum {
+		return models.ErrInvalidQuery
+	}
+	for _, label := range query.By {
+		if models.SanitizeLabelName(label) != label {
+			return models.ErrInvalidQuery
+		}
+	}
+	return nil
+}
+
+// selectSeries возвращает ряды типа query.MType, подходящие под селектор query.ID.
+func (s *MetricsService) selectSeries(ctx context.Context, query models.RangeQuery) ([]models.Metrics, error) {
+	sel, err := models.ParseSelector(query.ID)
+	if err != nil {
+		return nil, err
+	}
+	all, err := s.repo.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var series []models.Metrics
+	for _, metric := range all {
+		if metric.Type == query.MType && sel.Matches(metric.Name, metric.Labels) {
+			series = append(series, models.Metrics{ID: metric.Name, MType: metric.Type, Labels: metric.Labels})
+		}
+	}
+	return series, nil
+}
+
+// seriesGroup - ряды с одинаковыми значениями меток группировки.
+type seriesGroup struct {
+	labels   map[string]string
+	id       string
+	points   [][]models.Sample
+	sketches []models.SketchValue
+}
+
+// seriesGroups раскладывает ряды по группам. Без группировки каждый ряд образует отдельную группу.
+type seriesGroups struct {
+	groups  map[string]*seriesGroup
+	order   []string
+	by      []string
+	grouped bool
+}
+
+func newSeriesGroups(query models.RangeQuery) *seriesGroups {
+	return &seriesGroups{
+		groups:  make(map[string]*seriesGroup),
+		by:      query.By,
+		grouped: query.Agg != "",
+	}
+}
+
+// group возвращает группу ряда, создавая ее при первом обращении.
+func (g *seriesGroups) group(metric models.Metrics) *seriesGroup {
+	labels := make(map[string]string)
+	var id string
+	if g.grouped {
+		for _, label := range g.by {
+			if value, ok := metric.Labels[label]; ok {
+				labels[label] = value
+			}
+		}
+	} else {
+		for label, value := range metric.Labels {
+			labels[label] = value
+		}
+		id = metric.ID
+	}
+
+	key := models.SeriesKey(id, labels)
+	group, ok := g.groups[key]
+	if !ok {
+		group = &seriesGroup{labels: labels, id: id}
+		g.groups[key] = group
+		g.order = append(g.order, key)
+	}
+	return group
+}
+
+// list возвращает группы, отсортированные по ключу.
+func (g *seriesGroups) list() []*seriesGroup {
+	sort.Strings(g.order)
+	list := make([]*seriesGroup, 0, len(g.order))
+	for _, key := range g.order {
+		list = append(list, g.groups[key])
+	}
+	return list
+}
+
+// combinePoints объединяет точки рядов группы с одинаковым началом интервала функцией fn.
+func combinePoints(fn string, series [][]models.Sample) ([]models.Sample, error) {
+	byTime := make(map[int64][]models.Sample)
+	var times []int64
+	for _, points := range series {
+		for _, point := range points {
+			ts := point.Timestamp.UnixNano()
+			if _, ok := byTime[ts]; !ok {
+				times = append(times, ts)
+			}
+			byTime[ts] = append(byTime[ts], point)
+		}
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i] < times[j] })
+
+	combined := make([]models.Sample, 0, len(times))
+	for _, ts := range times {
+		values := byTime[ts]
+		value, err := aggregate.Apply(fn, values)
+		if err != nil {
+			return nil, err
+		}
+		combined = append(combined, models.Sample{Timestamp: values[0].Timestamp, Value: value})
+	}
+	return combined, nil
+}
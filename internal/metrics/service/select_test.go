@@ -0,0 +1,75 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	models "github.com/chestorix/monmetrics/internal/metrics"
+	"github.com/chestorix/monmetrics/internal/metrics/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func gauge(name string, value float64, ts time.Time, labels map[string]string) models.Metrics {
+	millis := ts.UnixMilli()
+	return models.Metrics{ID: name, MType: models.Gauge, Value: &value, Timestamp: &millis, Labels: labels}
+}
+
+func TestMetricsService_AggregateSeries(t *testing.T) {
+	ctx := context.Background()
+	ts := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	s := NewService(repository.NewMemStorage(""))
+	require.NoError(t, s.UpdateMetricsBatch(ctx, []models.Metrics{
+		gauge("FreeMemory", 10, ts, map[string]string{"host": "web-1", "env": "prod"}),
+		gauge("FreeMemory", 20, ts, map[string]string{"host": "web-2", "env": "prod"}),
+		gauge("FreeMemory", 5, ts, map[string]string{"host": "web-3", "env": "staging"}),
+		gauge("HeapAlloc", 100, ts, map[string]string{"host": "web-1", "env": "prod"}),
+	}))
+
+	query := models.RangeQuery{ID: "FreeMemory", MType: models.Gauge, By: []string{"env"}, From: ts.Add(-time.Minute), To: ts.Add(time.Minute)}
+	result, err := s.AggregateSeries(ctx, query)
+	require.NoError(t, err)
+	assert.Equal(t, "sum", result.Agg)
+	assert.Equal(t, []models.SeriesValue{
+		{Labels: map[string]string{"env": "prod"}, Value: 30},
+		{Labels: map[string]string{"env": "staging"}, Value: 5},
+	}, result.Series)
+
+	query = models.RangeQuery{ID: `{host="web-1"}`, MType: models.Gauge, From: ts.Add(-time.Minute), To: ts.Add(time.Minute)}
+	result, err = s.AggregateSeries(ctx, query)
+	require.NoError(t, err)
+	assert.Equal(t, []models.SeriesValue{
+		{Labels: map[string]string{"env": "prod", "host": "web-1"}, ID: "FreeMemory", Value: 10},
+		{Labels: map[string]string{"env": "prod", "host": "web-1"}, ID: "HeapAlloc", Value: 100},
+	}, result.Series)
+
+	query.Agg = "p99"
+	_, err = s.AggregateSeries(ctx, query)
+	assert.ErrorIs(t, err, models.ErrInvalidQuery)
+}
+
+func TestMetricsService_QueryRangeSeries(t *testing.T) {
+	ctx := context.Background()
+	ts := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	s := NewService(repository.NewMemStorage(""))
+	require.NoError(t, s.UpdateMetricsBatch(ctx, []models.Metrics{
+		gauge("FreeMemory", 10, ts, map[string]string{"host": "web-1", "env": "prod"}),
+		gauge("FreeMemory", 20, ts, map[string]string{"host": "web-2", "env": "prod"}),
+		gauge("FreeMemory", 30, ts.Add(time.Minute), map[string]string{"host": "web-2", "env": "prod"}),
+	}))
+
+	query := models.RangeQuery{
+		ID:    `FreeMemory{env=~"prod.*"}`,
+		MType: models.Gauge,
+		Agg:   "max",
+		From:  ts,
+		To:    ts.Add(2 * time.Minute),
+		Step:  time.Minute,
+	}
+	result, err := s.QueryRangeSeries(ctx, query)
+	require.NoError(t, err)
+	require.Len(t, result.Series, 1)
+	assert.Equal(t, map[string]string{}, result.Series[0].Labels)
+	assert.Equal(t, []models.Sample{{Timestamp: ts, Value: 20}, {Timestamp: ts.Add(time.Minute), Value: 30}}, result.Series[0].Points)
+}
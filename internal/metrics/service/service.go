@@ -4,33 +4,104 @@ package service
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"sync"
+	"time"
 
 	"github.com/chestorix/monmetrics/internal/domain/interfaces"
 	models "github.com/chestorix/monmetrics/internal/metrics"
+	"github.com/chestorix/monmetrics/internal/metrics/aggregate"
 	_ "github.com/jackc/pgx/v5/stdlib"
 )
 
+const (
+	// maxRangePoints ограничивает количество интервалов в одном запросе истории.
+	maxRangePoints = 11000
+	// defaultIdempotencyWindow - время, в течение которого повтор пакета с тем же ключом не применяется.
+	// Агент повторяет пакеты из дисковой очереди не дольше ее максимального возраста (по умолчанию час),
+	// поэтому окно должно быть не меньше, иначе поздний повтор примененного пакета учтется дважды.
+	defaultIdempotencyWindow = 2 * time.Hour
+)
+
 // MetricsService прдоставляет бизнес-логику для работч с метриками.
 type MetricsService struct {
-	repo interfaces.Repository
+	repo        interfaces.HistoryRepository
+	types       map[string]string
+	reserved    map[string]typeReservation
+	typesMu     sync.RWMutex
+	strictTypes bool
+	// idempotencyWindow - время, в течение которого хранятся ключи идемпотентности пакетов.
+	idempotencyWindow time.Duration
+	// cumulative - последние накопленные итоги счетчиков, присланных с операцией cumulative.
+	cumulative   map[string]int64
+	cumulativeMu sync.Mutex
+	// cumulativeWriteMu сериализует запись пакетов с накопленными итогами.
+	cumulativeWriteMu sync.Mutex
+}
+
+// Option задает необязательные параметры MetricsService.
+type Option func(*MetricsService)
+
+// WithStrictTypes включает контроль типов: первый тип, с которым пришла метрика,
+// записывается в ее метаданные, а обновления с другим типом отклоняются с ErrTypeConflict.
+func WithStrictTypes(enabled bool) Option {
+	return func(s *MetricsService) {
+		s.strictTypes = enabled
+	}
+}
+
+// WithIdempotencyWindow задает время, в течение которого повтор пакета с тем же ключом
+// идемпотентности не применяется. Нулевое или отрицательное значение оставляет значение по умолчанию.
+func WithIdempotencyWindow(window time.Duration) Option {
+	return func(s *MetricsService) {
+		if window > 0 {
+			s.idempotencyWindow = window
+		}
+	}
 }
 
 // NewService создает новый экземпляр MetricsService с данным репозиторием.
-func NewService(repo interfaces.Repository) *MetricsService {
-	return &MetricsService{repo: repo}
+func NewService(repo interfaces.HistoryRepository, opts ...Option) *MetricsService {
+	s := &MetricsService{
+		repo:              repo,
+		types:             make(map[string]string),
+		reserved:          make(map[string]typeReservation),
+		cumulative:        make(map[string]int64),
+		idempotencyWindow: defaultIdempotencyWindow,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
 // UpdateGauge обновляет метрики Gauage.
 func (s *MetricsService) UpdateGauge(ctx context.Context, name string, value float64) error {
-	s.repo.UpdateGauge(ctx, name, value)
-	return nil
+	if err := models.ValidateName(name); err != nil {
+		return err
+	}
+	done, err := s.reserveTypes(ctx, []models.Metrics{{ID: name, MType: models.Gauge}})
+	if err != nil {
+		return err
+	}
+	err = s.repo.UpdateGauge(ctx, name, value)
+	done(err == nil)
+	return err
 }
 
 // UpdateCounterобновляет метрики Counter.
 func (s *MetricsService) UpdateCounter(ctx context.Context, name string, value int64) error {
-	s.repo.UpdateCounter(ctx, name, value)
-	return nil
+	if err := models.ValidateName(name); err != nil {
+		return err
+	}
+	done, err := s.reserveTypes(ctx, []models.Metrics{{ID: name, MType: models.Counter}})
+	if err != nil {
+		return err
+	}
+	err = s.repo.UpdateCounter(ctx, name, value)
+	done(err == nil)
+	return err
 }
 
 // GetGauge получение метрики типа Gauage.
@@ -59,45 +130,164 @@ func (s *MetricsService) GetAll(ctx context.Context) ([]models.Metric, error) {
 	return s.repo.GetAll(ctx)
 }
 
-// UpdateMetricJSON обновляет метрику (Gauge/Counter) на основе данных JSON.
+// UpdateMetricJSON обновляет метрику (Gauge/Counter/Histogram/Summary/Set) на основе данных JSON.
+// Ряд метрики определяется именем и метками.
+// Для счетчиков, гистограмм и скетчей в ответе возвращается накопленное значение,
+// для множеств - оценка количества уникальных элементов в поле Delta.
+// Для счетчиков поле Op позволяет сбросить счетчик, присвоить ему значение или передать накопленный итог.
 func (s *MetricsService) UpdateMetricJSON(ctx context.Context, metric models.Metrics) (models.Metrics, error) {
+	if err := models.ValidateName(metric.ID); err != nil {
+		return metric, err
+	}
+	if err := models.ValidateLabels(metric.Labels); err != nil {
+		return metric, err
+	}
+	done, err := s.reserveTypes(ctx, []models.Metrics{metric})
+	if err != nil {
+		return metric, err
+	}
+	defer s.lockCumulative([]models.Metrics{metric})()
+	update, err := s.counterOp(ctx, metric, nil)
+	if err != nil {
+		done(false)
+		return metric, err
+	}
+	resp, err := s.updateMetric(ctx, metric, update)
+	done(err == nil)
+	return resp, err
+}
+
+// updateMetric записывает проверенную метрику и возвращает ответ UpdateMetricJSON.
+// update - метрика после приведения операции над счетчиком.
+func (s *MetricsService) updateMetric(ctx context.Context, metric, update models.Metrics) (models.Metrics, error) {
+	var err error
+	key := metric.Key()
 	switch metric.MType {
 	case models.Gauge:
 		if metric.Value == nil {
 			return metric, models.ErrInvalidMetricType
 		}
-		s.repo.UpdateGauge(ctx, metric.ID, *metric.Value)
+		if err := s.repo.UpdateGauge(ctx, key, *metric.Value); err != nil {
+			return metric, err
+		}
 		return metric, nil
 	case models.Counter:
-		if metric.Delta == nil {
+		if update.Delta == nil {
 			return metric, models.ErrInvalidMetricType
 		}
-		s.repo.UpdateCounter(ctx, metric.ID, *metric.Delta)
-		respValue, _, _ := s.repo.GetCounter(ctx, metric.ID)
+		if update.Op == models.CounterSet {
+			err = s.repo.SetCounter(ctx, key, *update.Delta)
+		} else {
+			err = s.repo.UpdateCounter(ctx, key, *update.Delta)
+		}
+		if err != nil {
+			return metric, err
+		}
+		s.commitCumulative([]models.Metrics{metric})
+		respValue, _, _ := s.repo.GetCounter(ctx, key)
 		metric.Delta = &respValue
 		return metric, nil
+	case models.Histogram:
+		if metric.Histogram == nil {
+			return metric, models.ErrInvalidMetricType
+		}
+		if err := metric.Histogram.Validate(); err != nil {
+			return metric, err
+		}
+		if err := s.repo.UpdateHistogram(ctx, key, *metric.Histogram); err != nil {
+			return metric, err
+		}
+		respValue, _, err := s.repo.GetHistogram(ctx, key)
+		if err != nil {
+			return metric, err
+		}
+		metric.Histogram = &respValue
+		return metric, nil
+	case models.Summary:
+		if metric.Sketch == nil {
+			return metric, models.ErrInvalidMetricType
+		}
+		if err := metric.Sketch.Validate(); err != nil {
+			return metric, err
+		}
+		if err := s.repo.UpdateSketch(ctx, key, *metric.Sketch); err != nil {
+			return metric, err
+		}
+		respValue, _, err := s.repo.GetSketch(ctx, key)
+		if err != nil {
+			return metric, err
+		}
+		metric.Sketch = &respValue
+		return metric, nil
+	case models.Set:
+		if metric.Members == nil {
+			return metric, models.ErrInvalidMetricType
+		}
+		if err := s.repo.UpdateSet(ctx, key, models.NewSetOf(metric.Members...)); err != nil {
+			return metric, err
+		}
+		respValue, _, err := s.repo.GetSet(ctx, key)
+		if err != nil {
+			return metric, err
+		}
+		estimate := int64(respValue.Estimate())
+		metric.Delta = &estimate
+		metric.Members = nil
+		return metric, nil
 	default:
 		return metric, models.ErrInvalidMetricType
 	}
 }
 
 // GetMetricJSON возвращает метрику в виде данных JSON.
+// Ряд метрики определяется именем и метками.
 func (s *MetricsService) GetMetricJSON(ctx context.Context, metric models.Metrics) (models.Metrics, error) {
 	switch metric.MType {
 	case models.Gauge:
-		respValue, err := s.GetGauge(ctx, metric.ID)
+		respValue, err := s.GetGauge(ctx, metric.Key())
 		if err != nil {
 			return metric, err
 		}
 		metric.Value = &respValue
 		return metric, nil
 	case models.Counter:
-		respValue, err := s.GetCounter(ctx, metric.ID)
+		respValue, err := s.GetCounter(ctx, metric.Key())
 		if err != nil {
 			return metric, err
 		}
 		metric.Delta = &respValue
 		return metric, nil
+	case models.Histogram:
+		respValue, exists, err := s.repo.GetHistogram(ctx, metric.Key())
+		if err != nil {
+			return metric, err
+		}
+		if !exists {
+			return metric, models.ErrMetricNotFound
+		}
+		metric.Histogram = &respValue
+		return metric, nil
+	case models.Summary:
+		respValue, exists, err := s.repo.GetSketch(ctx, metric.Key())
+		if err != nil {
+			return metric, err
+		}
+		if !exists {
+			return metric, models.ErrMetricNotFound
+		}
+		metric.Sketch = &respValue
+		return metric, nil
+	case models.Set:
+		respValue, exists, err := s.repo.GetSet(ctx, metric.Key())
+		if err != nil {
+			return metric, err
+		}
+		if !exists {
+			return metric, models.ErrMetricNotFound
+		}
+		estimate := int64(respValue.Estimate())
+		metric.Delta = &estimate
+		return metric, nil
 	default:
 		return metric, models.ErrInvalidMetricType
 	}
@@ -122,10 +312,298 @@ func (s *MetricsService) CheckDB(ctx context.Context, ps string) error {
 }
 
 // UpdateMetricsBatch обновляет несколько метрик за одну транзакцию.
+// Операции над счетчиками приводятся к приращению или присваиванию до записи в хранилище.
 func (s *MetricsService) UpdateMetricsBatch(ctx context.Context, metrics []models.Metrics) error {
+	defer s.lockCumulative(metrics)()
+	updates, done, err := s.prepareBatch(ctx, metrics)
+	if err != nil {
+		return err
+	}
+	err = s.repo.UpdateMetricsBatch(ctx, updates)
+	done(err == nil)
+	if err != nil {
+		return err
+	}
+	s.commitCumulative(metrics)
+	return nil
+}
+
+// UpdateMetricsBatchOnce обновляет пакет метрик с ключом идемпотентности key.
+// Повтор пакета с тем же ключом в течение окна идемпотентности не применяется, и метод возвращает false.
+// Пустой ключ означает обычное обновление.
+func (s *MetricsService) UpdateMetricsBatchOnce(ctx context.Context, key string, metrics []models.Metrics) (bool, error) {
+	if key == "" {
+		return true, s.UpdateMetricsBatch(ctx, metrics)
+	}
+	defer s.lockCumulative(metrics)()
+	updates, done, err := s.prepareBatch(ctx, metrics)
+	if err != nil {
+		return false, err
+	}
+	applied, err := s.repo.UpdateMetricsBatchOnce(ctx, key, time.Now().Add(-s.idempotencyWindow), updates)
+	done(err == nil && applied)
+	if err != nil {
+		return false, err
+	}
+	// Повтор уже примененного пакета не меняет итоги: за это время могли прийти более новые.
+	if applied {
+		s.commitCumulative(metrics)
+	}
+	return applied, nil
+}
+
+// prepareBatch проверяет пакет метрик и приводит операции над счетчиками к приращению или присваиванию.
+// Типы метрик, встречающихся впервые, резервируются; вторым значением возвращается функция,
+// которую нужно вызвать с результатом записи пакета (см. reserveTypes).
+func (s *MetricsService) prepareBatch(ctx context.Context, metrics []models.Metrics) ([]models.Metrics, func(applied bool), error) {
+	for _, metric := range metrics {
+		if err := validateMetric(metric); err != nil {
+			return nil, nil, err
+		}
+	}
+	done, err := s.reserveTypes(ctx, metrics)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	updates := make([]models.Metrics, len(metrics))
+	totals := make(map[string]int64)
+	for i, metric := range metrics {
+		update, err := s.counterOp(ctx, metric, totals)
+		if err != nil {
+			done(false)
+			return nil, nil, err
+		}
+		updates[i] = update
+	}
+	return updates, done, nil
+}
+
+// QueryRange возвращает историю метрики за период, разбитую на интервалы длиной query.Step.
+// Для каждого интервала вычисляется функция query.Func (по умолчанию last), пустые интервалы пропускаются.
+// Для rate и increase в интервал дополнительно включается последнее значение предыдущего интервала,
+// чтобы прирост на границе интервалов не терялся.
+func (s *MetricsService) QueryRange(ctx context.Context, query models.RangeQuery) (models.RangeResult, error) {
+	if err := validateQuery(&query); err != nil {
+		return models.RangeResult{}, err
+	}
+	if query.MType == models.Summary || query.Step <= 0 || query.To.Sub(query.From)/query.Step > maxRangePoints {
+		return models.RangeResult{}, models.ErrInvalidQuery
+	}
+
+	samples, err := s.history(ctx, query)
+	if err != nil {
+		return models.RangeResult{}, err
+	}
+
+	points, err := rangePoints(samples, query)
+	if err != nil {
+		return models.RangeResult{}, err
+	}
+
+	return models.RangeResult{
+		ID:     query.ID,
+		MType:  query.MType,
+		Func:   query.Func,
+		Step:   query.Step.String(),
+		Points: points,
+	}, nil
+}
+
+// Aggregate вычисляет функцию query.Func над всей историей метрики за период.
+// Для summary функция вычисляется по накопленному скетчу, период не учитывается.
+// Если значений недостаточно для вычисления функции, возвращается ErrMetricNotFound.
+func (s *MetricsService) Aggregate(ctx context.Context, query models.RangeQuery) (models.AggregateResult, error) {
+	if err := validateQuery(&query); err != nil {
+		return models.AggregateResult{}, err
+	}
+
+	var value float64
+	var err error
+	if query.MType == models.Summary {
+		sketch, exists, getErr := s.repo.GetSketch(ctx, query.ID)
+		if getErr != nil {
+			return models.AggregateResult{}, getErr
+		}
+		if !exists {
+			return models.AggregateResult{}, models.ErrMetricNotFound
+		}
+		value, err = aggregate.ApplySketch(query.Func, sketch)
+	} else {
+		var samples []models.Sample
+		if samples, err = s.history(ctx, query); err != nil {
+			return models.AggregateResult{}, err
+		}
+		value, err = aggregate.Apply(query.Func, samples)
+	}
+	if err != nil {
+		if errors.Is(err, aggregate.ErrNotEnoughPoints) {
+			return models.AggregateResult{}, models.ErrMetricNotFound
+		}
+		return models.AggregateResult{}, err
+	}
+
+	return models.AggregateResult{
+		From:  query.From,
+		To:    query.To,
+		ID:    query.ID,
+		MType: query.MType,
+		Func:  query.Func,
+		Value: value,
+	}, nil
+}
+
+// validateQuery проверяет параметры запроса истории и подставляет функцию по умолчанию:
+// last для gauge, counter и set, p50 для summary.
+// История set содержит оценку количества уникальных элементов после каждого обновления,
+// поэтому rate и increase для нее дают количество новых элементов.
+func validateQuery(query *models.RangeQuery) error {
+	switch query.MType {
+	case models.Gauge, models.Counter, models.Set:
+		if query.Func == "" {
+			query.Func = aggregate.Last
+		}
+	case models.Summary:
+		if query.Func == "" {
+			query.Func = aggregate.P50
+		}
+		if !aggregate.IsSketchFunc(query.Func) {
+			return models.ErrInvalidQuery
+		}
+	default:
+		return models.ErrInvalidMetricType
+	}
+	if query.ID == "" || !query.From.Before(query.To) || !aggregate.IsValid(query.Func) {
+		return models.ErrInvalidQuery
+	}
+	if aggregate.CounterOnly(query.Func) && query.MType != models.Counter && query.MType != models.Set {
+		return models.ErrInvalidQuery
+	}
+	return nil
+}
 
-	if err := s.repo.UpdateMetricsBatch(ctx, metrics); err != nil {
+// history загружает историю метрики за период запроса.
+// Если истории нет и метрика никогда не обновлялась, возвращается ErrMetricNotFound.
+func (s *MetricsService) history(ctx context.Context, query models.RangeQuery) ([]models.Sample, error) {
+	samples, err := s.repo.GetHistory(ctx, query.MType, query.ID, query.From, query.To)
+	if err != nil {
+		return nil, err
+	}
+	if len(samples) == 0 {
+		if err := s.checkExists(ctx, query.MType, query.ID); err != nil {
+			return nil, err
+		}
+	}
+	return samples, nil
+}
+
+// checkExists возвращает ErrMetricNotFound, если метрика никогда не обновлялась.
+func (s *MetricsService) checkExists(ctx context.Context, mType, name string) error {
+	var exists bool
+	var err error
+	switch mType {
+	case models.Gauge:
+		_, exists, err = s.repo.GetGauge(ctx, name)
+	case models.Counter:
+		_, exists, err = s.repo.GetCounter(ctx, name)
+	case models.Set:
+		_, exists, err = s.repo.GetSet(ctx, name)
+	}
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return models.ErrMetricNotFound
+	}
+	return nil
+}
+
+// rangePoints вычисляет функцию query.Func для каждого интервала длиной query.Step.
+func rangePoints(samples []models.Sample, query models.RangeQuery) ([]models.Sample, error) {
+	points := make([]models.Sample, 0)
+	var prev []models.Sample
+	for _, bucket := range bucketize(samples, query.From, query.Step) {
+		window := bucket.samples
+		if aggregate.CounterOnly(query.Func) && len(prev) > 0 {
+			window = append([]models.Sample{prev[len(prev)-1]}, window...)
+		}
+		prev = bucket.samples
+
+		value, err := aggregate.Apply(query.Func, window)
+		if err != nil {
+			if errors.Is(err, aggregate.ErrNotEnoughPoints) {
+				continue
+			}
+			return nil, err
+		}
+		points = append(points, models.Sample{Timestamp: bucket.start, Value: value})
+	}
+	return points, nil
+}
+
+// bucket - значения метрики, попавшие в один интервал.
+type bucket struct {
+	start   time.Time
+	samples []models.Sample
+}
+
+// bucketize раскладывает упорядоченные по времени значения по интервалам длиной step, начиная с from.
+func bucketize(samples []models.Sample, from time.Time, step time.Duration) []bucket {
+	var buckets []bucket
+	for _, sample := range samples {
+		start := from.Add(sample.Timestamp.Sub(from) / step * step)
+		if n := len(buckets); n > 0 && buckets[n-1].start.Equal(start) {
+			buckets[n-1].samples = append(buckets[n-1].samples, sample)
+			continue
+		}
+		buckets = append(buckets, bucket{start: start, samples: []models.Sample{sample}})
+	}
+	return buckets
+}
+
+// SetMetadata сохраняет метаданные метрики, заменяя ранее сохраненные.
+// В режиме контроля типов зарегистрированный тип метрики сохраняется, а попытка задать
+// другой тип отклоняется с ErrTypeConflict - для смены типа используется Retype.
+func (s *MetricsService) SetMetadata(ctx context.Context, meta models.Metadata) error {
+	if err := meta.Validate(); err != nil {
 		return err
 	}
+
+	if s.strictTypes {
+		registered, err := s.registeredType(ctx, meta.ID)
+		if err != nil {
+			return err
+		}
+		switch {
+		case registered == "":
+		case meta.Type == "":
+			meta.Type = registered
+		case meta.Type != registered:
+			return typeConflict(meta.ID, registered, meta.Type)
+		}
+	}
+	if err := s.repo.SetMetadata(ctx, meta); err != nil {
+		return err
+	}
+	if meta.Type != "" {
+		s.cacheType(meta.ID, meta.Type, true)
+	}
 	return nil
 }
+
+// GetMetadata возвращает метаданные метрики. Если они не заданы, возвращается ErrMetricNotFound.
+func (s *MetricsService) GetMetadata(ctx context.Context, name string) (models.Metadata, error) {
+	meta, exists, err := s.repo.GetMetadata(ctx, name)
+	if err != nil {
+		return models.Metadata{}, err
+	}
+	if !exists {
+		return models.Metadata{}, models.ErrMetricNotFound
+	}
+	return meta, nil
+}
+
+// GetAllMetadata возвращает метаданные всех метрик по имени метрики.
+func (s *MetricsService) GetAllMetadata(ctx context.Context) (map[string]models.Metadata, error) {
+	return s.repo.GetAllMetadata(ctx)
+}
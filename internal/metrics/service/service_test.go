@@ -0,0 +1,402 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/chestorix/monmetrics/internal/domain/interfaces"
+	models "github.com/chestorix/monmetrics/internal/metrics"
+	"github.com/chestorix/monmetrics/internal/metrics/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetricsService_UpdateSet(t *testing.T) {
+	ctx := context.Background()
+	s := NewService(repository.NewMemStorage(""))
+	labels := map[string]string{"page": "/"}
+
+	resp, err := s.UpdateMetricJSON(ctx, models.Metrics{ID: "visitors", MType: models.Set, Labels: labels, Members: []string{"alice", "bob", "alice"}})
+	require.NoError(t, err)
+	require.NotNil(t, resp.Delta)
+	assert.Equal(t, int64(2), *resp.Delta)
+	assert.Nil(t, resp.Members)
+
+	resp, err = s.UpdateMetricJSON(ctx, models.Metrics{ID: "visitors", MType: models.Set, Labels: labels, Members: []string{"bob", "carol"}})
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), *resp.Delta)
+
+	resp, err = s.GetMetricJSON(ctx, models.Metrics{ID: "visitors", MType: models.Set, Labels: labels})
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), *resp.Delta)
+
+	result, err := s.Aggregate(ctx, models.RangeQuery{
+		ID:    models.SeriesKey("visitors", labels),
+		MType: models.Set,
+		Func:  "increase",
+		From:  time.Now().Add(-time.Minute),
+		To:    time.Now().Add(time.Minute),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 1.0, result.Value)
+
+	_, err = s.UpdateMetricJSON(ctx, models.Metrics{ID: "visitors", MType: models.Set})
+	assert.ErrorIs(t, err, models.ErrInvalidMetricType)
+}
+
+func TestMetricsService_CounterOps(t *testing.T) {
+	ctx := context.Background()
+	s := NewService(repository.NewMemStorage(""))
+	update := func(op string, delta int64) int64 {
+		t.Helper()
+		resp, err := s.UpdateMetricJSON(ctx, models.Metrics{ID: "requests", MType: models.Counter, Op: op, Delta: &delta})
+		require.NoError(t, err)
+		return *resp.Delta
+	}
+
+	assert.Equal(t, int64(5), update("", 5))
+	assert.Equal(t, int64(7), update(models.CounterAdd, 2))
+	assert.Equal(t, int64(100), update(models.CounterSet, 100))
+	assert.Equal(t, int64(0), update(models.CounterReset, 42))
+
+	// Первый итог для существующего счетчика только запоминается.
+	assert.Equal(t, int64(0), update(models.CounterCumulative, 50))
+	assert.Equal(t, int64(20), update(models.CounterCumulative, 70))
+	// Итог уменьшился - источник перезапущен.
+	assert.Equal(t, int64(30), update(models.CounterCumulative, 10))
+
+	delta := int64(1)
+	_, err := s.UpdateMetricJSON(ctx, models.Metrics{ID: "requests", MType: models.Counter, Op: "multiply", Delta: &delta})
+	assert.ErrorIs(t, err, models.ErrInvalidCounterOp)
+	value := 1.0
+	_, err = s.UpdateMetricJSON(ctx, models.Metrics{ID: "load", MType: models.Gauge, Op: models.CounterReset, Value: &value})
+	assert.ErrorIs(t, err, models.ErrInvalidCounterOp)
+
+	total := int64(12)
+	require.NoError(t, s.UpdateMetricsBatch(ctx, []models.Metrics{
+		{ID: "bytes", MType: models.Counter, Op: models.CounterCumulative, Delta: &total},
+		{ID: "requests", MType: models.Counter, Op: models.CounterReset},
+	}))
+	bytes, err := s.GetCounter(ctx, "bytes")
+	require.NoError(t, err)
+	assert.Equal(t, int64(12), bytes)
+	requests, err := s.GetCounter(ctx, "requests")
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), requests)
+
+	require.NoError(t, s.DeleteMetric(ctx, models.Counter, "bytes"))
+	total = 15
+	require.NoError(t, s.UpdateMetricsBatch(ctx, []models.Metrics{{ID: "bytes", MType: models.Counter, Op: models.CounterCumulative, Delta: &total}}))
+	bytes, err = s.GetCounter(ctx, "bytes")
+	require.NoError(t, err)
+	assert.Equal(t, int64(15), bytes)
+}
+
+func TestMetricsService_StrictTypes(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewMemStorage("")
+	s := NewService(repo, WithStrictTypes(true))
+	value := 1.0
+	delta := int64(1)
+
+	require.NoError(t, s.UpdateGauge(ctx, "OtherSys", 10))
+	_, err := s.UpdateMetricJSON(ctx, models.Metrics{ID: "OtherSys", MType: models.Counter, Delta: &delta})
+	assert.ErrorIs(t, err, models.ErrTypeConflict)
+	assert.EqualError(t, err, "metric type conflict: OtherSys is registered as gauge, got counter")
+
+	err = s.UpdateMetricsBatch(ctx, []models.Metrics{
+		{ID: "requests", MType: models.Counter, Delta: &delta},
+		{ID: "requests", MType: models.Gauge, Value: &value},
+	})
+	assert.ErrorIs(t, err, models.ErrTypeConflict)
+	_, exists, _ := repo.GetCounter(ctx, "requests")
+	assert.False(t, exists)
+
+	err = s.SetMetadata(ctx, models.Metadata{ID: "OtherSys", Unit: "bytes", Type: models.Counter})
+	assert.ErrorIs(t, err, models.ErrTypeConflict)
+	require.NoError(t, s.SetMetadata(ctx, models.Metadata{ID: "OtherSys", Unit: "bytes"}))
+
+	meta, err := s.Retype(ctx, "OtherSys", models.Counter)
+	require.NoError(t, err)
+	assert.Equal(t, models.Metadata{ID: "OtherSys", Unit: "bytes", Type: models.Counter}, meta)
+	require.NoError(t, s.UpdateCounter(ctx, "OtherSys", 5))
+	assert.ErrorIs(t, s.UpdateGauge(ctx, "OtherSys", 10), models.ErrTypeConflict)
+
+	relaxed := NewService(repository.NewMemStorage(""))
+	require.NoError(t, relaxed.UpdateGauge(ctx, "OtherSys", 10))
+	require.NoError(t, relaxed.UpdateCounter(ctx, "OtherSys", 5))
+
+	// Тип регистрируется только после успешной записи.
+	failing := &failingRepo{HistoryRepository: repository.NewMemStorage(""), fail: true}
+	s = NewService(failing, WithStrictTypes(true))
+	require.Error(t, s.UpdateMetricsBatch(ctx, []models.Metrics{{ID: "jobs", MType: models.Gauge, Value: &value}}))
+	_, err = s.GetMetadata(ctx, "jobs")
+	assert.ErrorIs(t, err, models.ErrMetricNotFound)
+	failing.fail = false
+	require.NoError(t, s.UpdateMetricsBatch(ctx, []models.Metrics{{ID: "jobs", MType: models.Counter, Delta: &delta}}))
+	meta, err = s.GetMetadata(ctx, "jobs")
+	require.NoError(t, err)
+	assert.Equal(t, models.Counter, meta.Type)
+}
+
+// blockingRepo - хранилище, запись gauge в которое ждет закрытия release, а запись метаданных
+// завершается ошибкой, пока failMetadata равен true.
+type blockingRepo struct {
+	interfaces.HistoryRepository
+	writing      chan struct{}
+	release      chan struct{}
+	failMetadata bool
+}
+
+func (r *blockingRepo) UpdateGauge(ctx context.Context, name string, value float64) error {
+	close(r.writing)
+	<-r.release
+	return r.HistoryRepository.UpdateGauge(ctx, name, value)
+}
+
+func (r *blockingRepo) SetMetadata(ctx context.Context, meta models.Metadata) error {
+	if r.failMetadata {
+		return errors.New("metadata unavailable")
+	}
+	return r.HistoryRepository.SetMetadata(ctx, meta)
+}
+
+func TestMetricsService_StrictTypesConcurrentFirstWrite(t *testing.T) {
+	ctx := context.Background()
+	repo := &blockingRepo{
+		HistoryRepository: repository.NewMemStorage(""),
+		writing:           make(chan struct{}),
+		release:           make(chan struct{}),
+		failMetadata:      true,
+	}
+	s := NewService(repo, WithStrictTypes(true))
+
+	errc := make(chan error, 1)
+	go func() { errc <- s.UpdateGauge(ctx, "X", 1) }()
+	<-repo.writing
+
+	// Тип зарезервирован первой записью, хотя она еще не завершилась.
+	assert.ErrorIs(t, s.UpdateCounter(ctx, "X", 1), models.ErrTypeConflict)
+	close(repo.release)
+	// Ошибка записи метаданных после примененной записи не возвращается клиенту.
+	require.NoError(t, <-errc)
+
+	_, exists, err := repo.GetCounter(ctx, "X")
+	require.NoError(t, err)
+	assert.False(t, exists)
+	assert.ErrorIs(t, s.UpdateCounter(ctx, "X", 1), models.ErrTypeConflict)
+
+	repo.failMetadata = false
+	delta := int64(1)
+	require.NoError(t, s.UpdateMetricsBatch(ctx, []models.Metrics{{ID: "Y", MType: models.Counter, Delta: &delta}}))
+	meta, err := s.GetMetadata(ctx, "Y")
+	require.NoError(t, err)
+	assert.Equal(t, models.Counter, meta.Type)
+}
+
+func TestMetricsService_DeleteSeries(t *testing.T) {
+	ctx := context.Background()
+	ts := time.Now()
+	s := NewService(repository.NewMemStorage(""))
+	require.NoError(t, s.UpdateMetricsBatch(ctx, []models.Metrics{
+		gauge("legacy_free", 1, ts, map[string]string{"host": "web-1"}),
+		gauge("legacy_free", 2, ts, map[string]string{"host": "web-2"}),
+		gauge("legacy_used", 3, ts, map[string]string{"host": "web-1"}),
+		gauge("HeapAlloc", 4, ts, nil),
+	}))
+
+	deleted, err := s.DeleteSeries(ctx, models.Gauge, "legacy_", `{host="web-1"}`)
+	require.NoError(t, err)
+	assert.Equal(t, 2, deleted)
+
+	series, err := s.Select(ctx, "", `{host=~".+"}`)
+	require.NoError(t, err)
+	require.Len(t, series, 1)
+	assert.Equal(t, `legacy_free{host="web-2"}`, series[0].Key())
+
+	require.NoError(t, s.DeleteMetric(ctx, models.Gauge, "HeapAlloc"))
+	assert.ErrorIs(t, s.DeleteMetric(ctx, models.Gauge, "HeapAlloc"), models.ErrMetricNotFound)
+	_, err = s.Aggregate(ctx, models.RangeQuery{ID: "HeapAlloc", MType: models.Gauge, From: ts.Add(-time.Minute), To: ts.Add(time.Minute)})
+	assert.ErrorIs(t, err, models.ErrMetricNotFound)
+
+	_, err = s.DeleteSeries(ctx, "", "", "")
+	assert.ErrorIs(t, err, models.ErrInvalidSelector)
+}
+
+func TestMetricsService_ExpireSeries(t *testing.T) {
+	ctx := context.Background()
+	s := NewService(repository.NewMemStorage(""))
+	total := int64(3)
+	require.NoError(t, s.UpdateGauge(ctx, "stale", 1))
+	require.NoError(t, s.UpdateMetricsBatch(ctx, []models.Metrics{{ID: "hits", MType: models.Counter, Op: models.CounterCumulative, Delta: &total}}))
+	time.Sleep(20 * time.Millisecond)
+	require.NoError(t, s.UpdateCounter(ctx, "fresh", 1))
+
+	expired, err := s.ExpireSeries(ctx, 10*time.Millisecond)
+	require.NoError(t, err)
+	assert.Equal(t, 2, expired)
+
+	_, err = s.GetGauge(ctx, "stale")
+	assert.ErrorIs(t, err, models.ErrMetricNotFound)
+	_, err = s.GetCounter(ctx, "fresh")
+	assert.NoError(t, err)
+
+	// Итог удаленного счетчика забыт, поэтому следующий итог создает счетчик заново.
+	total = 5
+	require.NoError(t, s.UpdateMetricsBatch(ctx, []models.Metrics{{ID: "hits", MType: models.Counter, Op: models.CounterCumulative, Delta: &total}}))
+	hits, err := s.GetCounter(ctx, "hits")
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), hits)
+}
+
+// failingRepo - хранилище, запись пакета в которое завершается ошибкой, пока fail равен true.
+type failingRepo struct {
+	interfaces.HistoryRepository
+	fail bool
+}
+
+func (r *failingRepo) UpdateMetricsBatch(ctx context.Context, metrics []models.Metrics) error {
+	if r.fail {
+		return errors.New("storage unavailable")
+	}
+	return r.HistoryRepository.UpdateMetricsBatch(ctx, metrics)
+}
+
+func TestMetricsService_CumulativeWriteFailure(t *testing.T) {
+	ctx := context.Background()
+	repo := &failingRepo{HistoryRepository: repository.NewMemStorage("")}
+	s := NewService(repo)
+	send := func(total int64) error {
+		return s.UpdateMetricsBatch(ctx, []models.Metrics{{ID: "bytes", MType: models.Counter, Op: models.CounterCumulative, Delta: &total}})
+	}
+
+	require.NoError(t, send(10))
+	repo.fail = true
+	require.Error(t, send(25))
+	repo.fail = false
+	// Итог 25 не был записан, поэтому повтор учитывает приращение 15.
+	require.NoError(t, send(25))
+
+	bytes, err := s.GetCounter(ctx, "bytes")
+	require.NoError(t, err)
+	assert.Equal(t, int64(25), bytes)
+}
+
+func TestMetricsService_CumulativeSameBatch(t *testing.T) {
+	ctx := context.Background()
+	s := NewService(repository.NewMemStorage(""))
+	point := func(total int64) models.Metrics {
+		return models.Metrics{ID: "bytes", MType: models.Counter, Op: models.CounterCumulative, Delta: &total}
+	}
+
+	// Второй итог пакета отсчитывается от первого, а не от итога до пакета.
+	require.NoError(t, s.UpdateMetricsBatch(ctx, []models.Metrics{point(10), point(15)}))
+	bytes, err := s.GetCounter(ctx, "bytes")
+	require.NoError(t, err)
+	assert.Equal(t, int64(15), bytes)
+
+	// Запомнен последний итог пакета.
+	require.NoError(t, s.UpdateMetricsBatch(ctx, []models.Metrics{point(20)}))
+	bytes, err = s.GetCounter(ctx, "bytes")
+	require.NoError(t, err)
+	assert.Equal(t, int64(20), bytes)
+
+	// Сброс источника внутри пакета: итог 4 меньше 22 и целиком становится приращением.
+	require.NoError(t, s.UpdateMetricsBatch(ctx, []models.Metrics{point(22), point(4), point(6)}))
+	bytes, err = s.GetCounter(ctx, "bytes")
+	require.NoError(t, err)
+	assert.Equal(t, int64(28), bytes)
+}
+
+func TestMetricsService_UpdateMetricsBatchOnce(t *testing.T) {
+	ctx := context.Background()
+	s := NewService(repository.NewMemStorage(""), WithIdempotencyWindow(time.Minute))
+	delta := int64(3)
+	batch := []models.Metrics{{ID: "requests", MType: models.Counter, Delta: &delta}}
+
+	applied, err := s.UpdateMetricsBatchOnce(ctx, "batch-1", batch)
+	require.NoError(t, err)
+	assert.True(t, applied)
+	applied, err = s.UpdateMetricsBatchOnce(ctx, "batch-1", batch)
+	require.NoError(t, err)
+	assert.False(t, applied)
+
+	applied, err = s.UpdateMetricsBatchOnce(ctx, "", batch)
+	require.NoError(t, err)
+	assert.True(t, applied)
+
+	value, err := s.GetCounter(ctx, "requests")
+	require.NoError(t, err)
+	assert.Equal(t, int64(6), value)
+
+	// Ключ отклоненного пакета не запоминается, исправленный пакет с тем же ключом применяется.
+	_, err = s.UpdateMetricsBatchOnce(ctx, "batch-2", []models.Metrics{{ID: "requests", MType: models.Counter, Op: "multiply", Delta: &delta}})
+	assert.ErrorIs(t, err, models.ErrInvalidCounterOp)
+	applied, err = s.UpdateMetricsBatchOnce(ctx, "batch-2", batch)
+	require.NoError(t, err)
+	assert.True(t, applied)
+}
+
+func TestMetricsService_UpdateMetricsBatchPartial(t *testing.T) {
+	ctx := context.Background()
+	s := NewService(repository.NewMemStorage(""), WithStrictTypes(true))
+	require.NoError(t, s.UpdateGauge(ctx, "load", 1))
+	_, err := s.UpdateMetricJSON(ctx, models.Metrics{ID: "latency", MType: models.Histogram, Histogram: &models.HistogramValue{
+		Bounds: []float64{1}, Counts: []uint64{1, 0}, Count: 1, Sum: 0.5,
+	}})
+	require.NoError(t, err)
+
+	delta, value := int64(4), 2.5
+	result, applied, err := s.UpdateMetricsBatchPartial(ctx, "", []models.Metrics{
+		{ID: "requests", MType: models.Counter, Delta: &delta},
+		{ID: "free", MType: models.Gauge},
+		{ID: "load", MType: models.Counter, Delta: &delta},
+		{ID: "latency", MType: models.Histogram, Histogram: &models.HistogramValue{Bounds: []float64{2}, Counts: []uint64{1, 0}, Count: 1, Sum: 1}},
+		{ID: "cpu", MType: "meter", Value: &value},
+		{ID: "used", MType: models.Gauge, Value: &value},
+	})
+	require.NoError(t, err)
+	assert.True(t, applied)
+	assert.Equal(t, 2, result.Accepted)
+	require.Len(t, result.Rejected, 4)
+	assert.Equal(t, []int{1, 2, 3, 4}, []int{result.Rejected[0].Index, result.Rejected[1].Index, result.Rejected[2].Index, result.Rejected[3].Index})
+	assert.Equal(t, "free", result.Rejected[0].ID)
+	assert.Contains(t, result.Rejected[1].Reason, "registered as gauge")
+
+	requests, err := s.GetCounter(ctx, "requests")
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), requests)
+	used, err := s.GetGauge(ctx, "used")
+	require.NoError(t, err)
+	assert.Equal(t, 2.5, used)
+
+	// Новые ряды в одном пакете сверяются друг с другом.
+	first := models.HistogramValue{Bounds: []float64{1}, Counts: []uint64{1, 0}, Count: 1, Sum: 0.5}
+	other := models.HistogramValue{Bounds: []float64{5}, Counts: []uint64{0, 1}, Count: 1, Sum: 7}
+	fine, coarse := models.NewSketch(0.01), models.NewSketch(0.02)
+	fine.Add(1)
+	coarse.Add(1)
+	result, _, err = s.UpdateMetricsBatchPartial(ctx, "", []models.Metrics{
+		{ID: "size", MType: models.Histogram, Histogram: &first},
+		{ID: "size", MType: models.Histogram, Histogram: &other},
+		{ID: "rtt", MType: models.Summary, Sketch: &fine},
+		{ID: "rtt", MType: models.Summary, Sketch: &coarse},
+		{ID: "jobs", MType: models.Gauge, Value: &value},
+		{ID: "jobs", MType: models.Counter, Delta: &delta},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 3, result.Accepted)
+	require.Len(t, result.Rejected, 3)
+	assert.Equal(t, []int{1, 3, 5}, []int{result.Rejected[0].Index, result.Rejected[1].Index, result.Rejected[2].Index})
+	size, err := s.GetMetricJSON(ctx, models.Metrics{ID: "size", MType: models.Histogram})
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), size.Histogram.Count)
+
+	err = s.UpdateMetricsBatch(ctx, []models.Metrics{{ID: "free", MType: models.Gauge}})
+	assert.ErrorIs(t, err, models.ErrInvalidMetricType)
+	err = s.UpdateMetricsBatch(ctx, []models.Metrics{{ID: `used{host="a"}`, MType: models.Gauge, Value: &value}})
+	assert.ErrorIs(t, err, models.ErrInvalidMetricName)
+	assert.ErrorIs(t, s.UpdateGauge(ctx, `used{host="a"}`, 1), models.ErrInvalidMetricName)
+}
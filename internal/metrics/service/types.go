@@ -0,0 +1,187 @@
+// Package service - реализация бизнес-логики.
+package service
+
+import (
+	"context"
+	"fmt"
+
+	models "github.com/chestorix/monmetrics/internal/metrics"
+)
+
+// Retype меняет зарегистрированный тип метрики. Это административная операция:
+// после нее обновления принимаются только с новым типом, а значения старого типа остаются в хранилище.
+// Остальные поля метаданных сохраняются.
+func (s *MetricsService) Retype(ctx context.Context, name, mType string) (models.Metadata, error) {
+	if name == "" {
+		return models.Metadata{}, fmt.Errorf("%w: missing id", models.ErrInvalidMetadata)
+	}
+	if !models.IsValidType(mType) {
+		return models.Metadata{}, fmt.Errorf("%w: unknown type %q", models.ErrInvalidMetadata, mType)
+	}
+
+	meta, _, err := s.repo.GetMetadata(ctx, name)
+	if err != nil {
+		return models.Metadata{}, err
+	}
+	meta.ID = name
+	meta.Type = mType
+	if err := s.repo.SetMetadata(ctx, meta); err != nil {
+		return models.Metadata{}, err
+	}
+	s.cacheType(name, mType, true)
+	return meta, nil
+}
+
+// checkTypes в режиме контроля типов проверяет, что тип каждой метрики совпадает с зарегистрированным
+// или зарезервированным, и возвращает типы метрик, которые встречаются впервые.
+// Метрики неизвестных типов пропускаются, их отклоняет дальнейшая проверка.
+func (s *MetricsService) checkTypes(ctx context.Context, metrics []models.Metrics) (map[string]string, error) {
+	if !s.strictTypes {
+		return nil, nil
+	}
+
+	newTypes := make(map[string]string)
+	for _, metric := range metrics {
+		if !models.IsValidType(metric.MType) {
+			continue
+		}
+		registered, ok := newTypes[metric.ID]
+		if !ok {
+			var err error
+			if registered, err = s.registeredType(ctx, metric.ID); err != nil {
+				return nil, err
+			}
+			if registered == "" {
+				newTypes[metric.ID] = metric.MType
+				continue
+			}
+		}
+		if registered != metric.MType {
+			return nil, typeConflict(metric.ID, registered, metric.MType)
+		}
+	}
+	return newTypes, nil
+}
+
+// reserveTypes проверяет типы, как checkTypes, и резервирует типы метрик, которые встречаются впервые,
+// до записи: параллельная первая запись той же метрики с другим типом получит ErrTypeConflict.
+// Возвращает функцию, которую нужно вызвать после записи: при applied тип закрепляется
+// и записывается в метаданные, иначе резерв снимается, чтобы отклоненное обновление не закрепило тип.
+func (s *MetricsService) reserveTypes(ctx context.Context, metrics []models.Metrics) (func(applied bool), error) {
+	newTypes, err := s.checkTypes(ctx, metrics)
+	if err != nil {
+		return nil, err
+	}
+	if len(newTypes) == 0 {
+		return func(bool) {}, nil
+	}
+
+	s.typesMu.Lock()
+	defer s.typesMu.Unlock()
+	// Проверка повторяется под блокировкой: тип могли зарезервировать после чтения хранилища.
+	for name, mType := range newTypes {
+		if registered, ok := s.typeLocked(name); ok && registered != mType {
+			return nil, typeConflict(name, registered, mType)
+		}
+	}
+	for name, mType := range newTypes {
+		r := s.reserved[name]
+		r.mType = mType
+		r.writes++
+		s.reserved[name] = r
+	}
+	return func(applied bool) { s.releaseTypes(ctx, newTypes, applied) }, nil
+}
+
+// releaseTypes снимает резерв типов newTypes. Если запись применена, типы закрепляются в памяти
+// и записываются в метаданные. Ошибка записи метаданных не возвращается, так как данные уже сохранены
+// и повтор запроса учел бы их дважды; тип остается закрепленным в памяти до перезапуска.
+func (s *MetricsService) releaseTypes(ctx context.Context, newTypes map[string]string, applied bool) {
+	s.typesMu.Lock()
+	for name, mType := range newTypes {
+		r := s.reserved[name]
+		if r.writes--; r.writes == 0 {
+			delete(s.reserved, name)
+		} else {
+			s.reserved[name] = r
+		}
+		if _, ok := s.types[name]; applied && !ok {
+			s.types[name] = mType
+		}
+	}
+	s.typesMu.Unlock()
+
+	if applied {
+		s.registerTypes(ctx, newTypes)
+	}
+}
+
+// registerTypes записывает в метаданные типы метрик, которые встретились впервые.
+// Если тип уже записан в метаданные (например, другим экземпляром сервера), сохраняется записанный.
+func (s *MetricsService) registerTypes(ctx context.Context, newTypes map[string]string) {
+	for name, mType := range newTypes {
+		meta, _, err := s.repo.GetMetadata(ctx, name)
+		if err != nil {
+			continue
+		}
+		if meta.Type == "" {
+			meta.ID = name
+			meta.Type = mType
+			if s.repo.SetMetadata(ctx, meta) != nil {
+				continue
+			}
+		}
+		if meta.Type != mType {
+			s.cacheType(name, meta.Type, true)
+		}
+	}
+}
+
+// registeredType возвращает зарегистрированный или зарезервированный тип метрики либо пустую строку.
+// Типы кэшируются в памяти, хранилище читается только при промахе и без блокировки.
+func (s *MetricsService) registeredType(ctx context.Context, name string) (string, error) {
+	s.typesMu.RLock()
+	mType, ok := s.typeLocked(name)
+	s.typesMu.RUnlock()
+	if ok {
+		return mType, nil
+	}
+	meta, exists, err := s.repo.GetMetadata(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	if exists && meta.Type != "" {
+		s.cacheType(name, meta.Type, false)
+	}
+	return meta.Type, nil
+}
+
+// typeLocked возвращает закэшированный или зарезервированный тип метрики. Вызывается под блокировкой s.typesMu.
+func (s *MetricsService) typeLocked(name string) (string, bool) {
+	if mType, ok := s.types[name]; ok {
+		return mType, true
+	}
+	r, ok := s.reserved[name]
+	return r.mType, ok
+}
+
+// cacheType запоминает тип метрики. Без replace уже закэшированный тип не меняется:
+// значение, прочитанное из хранилища, могло устареть из-за параллельного Retype.
+func (s *MetricsService) cacheType(name, mType string, replace bool) {
+	s.typesMu.Lock()
+	defer s.typesMu.Unlock()
+	if _, ok := s.types[name]; ok && !replace {
+		return
+	}
+	s.types[name] = mType
+}
+
+// typeReservation - тип метрики, зарезервированный незавершенными записями, и их количество.
+type typeReservation struct {
+	mType  string
+	writes int
+}
+
+func typeConflict(name, registered, mType string) error {
+	return fmt.Errorf("%w: %s is registered as %s, got %s", models.ErrTypeConflict, name, registered, mType)
+}
@@ -0,0 +1,173 @@
+// Package models  содержит бизнес-сущности приложения.
+package models
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/bits"
+	"strconv"
+	"time"
+)
+
+var ErrInvalidSet = errors.New("invalid set")
+
+const (
+	// DefaultSetPrecision - количество бит хеша, выбирающих регистр HyperLogLog.
+	// 2^12 регистров дают стандартную ошибку оценки около 1.6% при размере 4 КБ.
+	DefaultSetPrecision = 12
+	minSetPrecision     = 4
+	maxSetPrecision     = 16
+)
+
+// SetValue - оценка количества уникальных элементов множества (HyperLogLog).
+// Элемент хешируется, старшие Precision бит хеша выбирают регистр, в котором сохраняется
+// максимальная позиция первой единицы в оставшихся битах. Сами элементы не хранятся,
+// а множества с одинаковой точностью объединяются поэлементным максимумом регистров.
+// Пустое множество не содержит регистров, они создаются при первом добавлении.
+//
+// Start - начало окна (Unix, мс), к которому относится множество. При объединении множество
+// более позднего окна заменяет накопленное, а множество более раннего окна отбрасывается,
+// поэтому оценка показывает количество уникальных элементов за последнее окно.
+// Нулевое значение - множество без окна, оно заменяется первым множеством с окном.
+type SetValue struct {
+	Registers []byte `json:"registers,omitempty"`
+	Start     int64  `json:"start,omitempty"`
+	Precision uint8  `json:"precision"`
+}
+
+// NewSet создает пустое множество с точностью precision.
+func NewSet(precision uint8) SetValue {
+	return SetValue{Precision: precision}
+}
+
+// NewSetOf создает множество с точностью по умолчанию и добавляет в него элементы members.
+func NewSetOf(members ...string) SetValue {
+	set := NewSet(DefaultSetPrecision)
+	for _, member := range members {
+		set.Add(member)
+	}
+	return set
+}
+
+// Add добавляет элемент в множество.
+func (s *SetValue) Add(member string) {
+	if s.Registers == nil {
+		s.Registers = make([]byte, 1<<s.Precision)
+	}
+	hash := setHash(member)
+	index := hash >> (64 - s.Precision)
+	// Младший сторожевой бит ограничивает ранг, если оставшиеся биты хеша нулевые.
+	rank := byte(bits.LeadingZeros64(hash<<s.Precision|1<<(s.Precision-1)) + 1)
+	if rank > s.Registers[index] {
+		s.Registers[index] = rank
+	}
+}
+
+// InWindow возвращает копию множества, отнесенную к окну длительностью window, которое содержит ts.
+// При window <= 0 множество возвращается без изменений.
+func (s SetValue) InWindow(ts time.Time, window time.Duration) SetValue {
+	if window <= 0 {
+		return s
+	}
+	s.Start = ts.Truncate(window).UnixMilli()
+	return s
+}
+
+// Merge объединяет два множества одного окна. Точность таких множеств должна совпадать.
+// Множества разных окон не объединяются: результатом будет множество более позднего окна.
+func (s SetValue) Merge(other SetValue) (SetValue, error) {
+	switch {
+	case other.Start > s.Start:
+		return other.clone(), nil
+	case other.Start < s.Start:
+		return s.clone(), nil
+	}
+	if s.Precision != other.Precision {
+		return s, fmt.Errorf("%w: precision %d differs from stored %d", ErrInvalidSet, other.Precision, s.Precision)
+	}
+	if other.Registers == nil {
+		return s.clone(), nil
+	}
+	if s.Registers == nil {
+		return other.clone(), nil
+	}
+
+	merged := s.clone()
+	for i, rank := range other.Registers {
+		if rank > merged.Registers[i] {
+			merged.Registers[i] = rank
+		}
+	}
+	return merged, nil
+}
+
+// Estimate возвращает оценку количества уникальных элементов.
+// Для небольших множеств, пока часть регистров пуста, используется линейный подсчет.
+func (s SetValue) Estimate() uint64 {
+	if s.Registers == nil {
+		return 0
+	}
+	m := float64(len(s.Registers))
+	var sum float64
+	var zeros int
+	for _, rank := range s.Registers {
+		sum += math.Ldexp(1, -int(rank))
+		if rank == 0 {
+			zeros++
+		}
+	}
+	estimate := 0.7213 / (1 + 1.079/m) * m * m / sum
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return uint64(estimate + 0.5)
+}
+
+// Validate проверяет, что точность в допустимом диапазоне, а количество и значения регистров ей соответствуют.
+func (s SetValue) Validate() error {
+	if s.Precision < minSetPrecision || s.Precision > maxSetPrecision {
+		return fmt.Errorf("%w: precision must be in [%d, %d]", ErrInvalidSet, minSetPrecision, maxSetPrecision)
+	}
+	if s.Registers == nil {
+		return nil
+	}
+	if len(s.Registers) != 1<<s.Precision {
+		return fmt.Errorf("%w: expected %d registers, got %d", ErrInvalidSet, 1<<s.Precision, len(s.Registers))
+	}
+	maxRank := byte(64 - s.Precision + 1)
+	for _, rank := range s.Registers {
+		if rank > maxRank {
+			return fmt.Errorf("%w: register value %d exceeds %d", ErrInvalidSet, rank, maxRank)
+		}
+	}
+	return nil
+}
+
+// String возвращает оценку количества уникальных элементов.
+func (s SetValue) String() string {
+	return strconv.FormatUint(s.Estimate(), 10)
+}
+
+func (s SetValue) clone() SetValue {
+	c := s
+	c.Registers = append([]byte(nil), s.Registers...)
+	return c
+}
+
+// setHash хеширует элемент множества. Хеш не зависит от процесса, поэтому
+// сохраненные множества можно объединять после перезапуска и между серверами.
+// FNV-1a дополнительно перемешивается финализатором MurmurHash3, так как
+// его старшие биты для коротких строк распределены неравномерно.
+func setHash(member string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(member))
+	x := h.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
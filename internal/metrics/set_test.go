@@ -0,0 +1,83 @@
+package models
+
+import (
+	"encoding/json"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetValue_Estimate(t *testing.T) {
+	a := NewSet(DefaultSetPrecision)
+	b := NewSet(DefaultSetPrecision)
+	for i := 0; i < 50000; i++ {
+		member := "user-" + strconv.Itoa(i)
+		if i < 30000 {
+			a.Add(member)
+		}
+		if i >= 20000 {
+			b.Add(member)
+		}
+	}
+	require.NoError(t, a.Validate())
+
+	merged, err := a.Merge(b)
+	require.NoError(t, err)
+	require.NoError(t, merged.Validate())
+	assert.InEpsilon(t, 50000, float64(merged.Estimate()), 0.05)
+	assert.InEpsilon(t, 30000, float64(a.Estimate()), 0.05)
+
+	_, err = a.Merge(NewSet(10))
+	assert.ErrorIs(t, err, ErrInvalidSet)
+}
+
+func TestSetValue_Small(t *testing.T) {
+	s := NewSetOf("alice", "bob", "alice", "carol")
+	assert.Equal(t, uint64(3), s.Estimate())
+	assert.Equal(t, "3", s.String())
+	assert.Equal(t, uint64(0), NewSet(DefaultSetPrecision).Estimate())
+
+	data, err := json.Marshal(s)
+	require.NoError(t, err)
+	var decoded SetValue
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, s, decoded)
+}
+
+func TestSetValue_Validate(t *testing.T) {
+	assert.NoError(t, NewSet(DefaultSetPrecision).Validate())
+	assert.ErrorIs(t, NewSet(2).Validate(), ErrInvalidSet)
+	assert.ErrorIs(t, SetValue{Precision: 4, Registers: make([]byte, 8)}.Validate(), ErrInvalidSet)
+	assert.ErrorIs(t, SetValue{Precision: 4, Registers: append(make([]byte, 15), 62)}.Validate(), ErrInvalidSet)
+}
+
+func TestSetValue_Window(t *testing.T) {
+	base := time.Date(2024, 1, 1, 12, 0, 30, 0, time.UTC)
+	first := NewSetOf("alice", "bob").InWindow(base, time.Minute)
+	assert.Equal(t, base.Truncate(time.Minute).UnixMilli(), first.Start)
+	assert.Equal(t, first, NewSetOf("alice", "bob").InWindow(base.Add(29*time.Second), time.Minute))
+	assert.Equal(t, int64(0), NewSetOf("alice").InWindow(base, 0).Start)
+
+	merged, err := first.Merge(NewSetOf("carol").InWindow(base, time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, uint64(3), merged.Estimate())
+
+	// Следующее окно начинается с нуля, а опоздавшие элементы прошлого окна отбрасываются.
+	next := NewSetOf("dave").InWindow(base.Add(time.Minute), time.Minute)
+	merged, err = merged.Merge(next)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), merged.Estimate())
+	assert.Equal(t, next.Start, merged.Start)
+
+	merged, err = merged.Merge(NewSetOf("erin", "frank").InWindow(base, time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, next, merged)
+
+	// Множество без окна, сохраненное до включения окон, заменяется.
+	merged, err = NewSetOf("alice", "bob").Merge(next)
+	require.NoError(t, err)
+	assert.Equal(t, next, merged)
+}
@@ -0,0 +1,248 @@
+// Package models  содержит бизнес-сущности приложения.
+package models
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+var ErrInvalidSketch = errors.New("invalid sketch")
+
+const (
+	// DefaultSketchAlpha - относительная точность квантилей по умолчанию (1%).
+	DefaultSketchAlpha = 0.01
+	// minSketchAlpha - наилучшая допустимая точность. При меньшей точности интервалы слишком узкие,
+	// и maxSketchBins перестает покрывать сколько-нибудь полезный диапазон значений.
+	minSketchAlpha = 0.001
+	// maxSketchBins ограничивает количество интервалов в одной половине скетча.
+	// При точности 1% этого хватает на диапазон значений от 1e-9 до 1e9 с запасом.
+	// Если интервалов становится больше, младшие интервалы сливаются (как в DDSketch),
+	// и точность теряют только наименьшие по модулю значения.
+	maxSketchBins = 4096
+	// minSketchValue - значения по модулю меньше этого порога учитываются как нулевые.
+	minSketchValue = 1e-9
+)
+
+// SketchBins - плотный массив количеств значений в логарифмических интервалах,
+// Counts[i] относится к интервалу с индексом Offset+i.
+type SketchBins struct {
+	Counts []uint64 `json:"counts,omitempty"`
+	Offset int      `json:"offset"`
+}
+
+// SketchValue - мержируемый скетч квантилей в стиле DDSketch.
+// Значение v > 0 попадает в интервал ceil(log_gamma(v)), где gamma = (1+Alpha)/(1-Alpha),
+// поэтому любой квантиль оценивается с относительной ошибкой не больше Alpha.
+// Отрицательные значения хранятся по модулю в Negative, близкие к нулю - в Zero.
+// Скетчи с одинаковой точностью складываются без потери точности, что позволяет объединять
+// отчеты агентов и ряды разных хостов.
+type SketchValue struct {
+	Positive SketchBins `json:"positive"`
+	Negative SketchBins `json:"negative"`
+	Alpha    float64    `json:"alpha"`
+	Sum      float64    `json:"sum"`
+	Min      float64    `json:"min"`
+	Max      float64    `json:"max"`
+	Zero     uint64     `json:"zero"`
+	Count    uint64     `json:"count"`
+}
+
+// NewSketch создает пустой скетч с относительной точностью alpha.
+func NewSketch(alpha float64) SketchValue {
+	return SketchValue{Alpha: alpha}
+}
+
+// Add добавляет значение в скетч.
+func (s *SketchValue) Add(value float64) {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return
+	}
+	switch {
+	case value >= minSketchValue:
+		s.Positive.add(s.index(value), 1)
+	case value <= -minSketchValue:
+		s.Negative.add(s.index(-value), 1)
+	default:
+		s.Zero++
+	}
+	if s.Count == 0 || value < s.Min {
+		s.Min = value
+	}
+	if s.Count == 0 || value > s.Max {
+		s.Max = value
+	}
+	s.Count++
+	s.Sum += value
+}
+
+// Merge складывает два скетча. Точность скетчей должна совпадать.
+func (s SketchValue) Merge(other SketchValue) (SketchValue, error) {
+	if s.Alpha != other.Alpha {
+		return s, fmt.Errorf("%w: alpha %v differs from stored %v", ErrInvalidSketch, other.Alpha, s.Alpha)
+	}
+	if other.Count == 0 {
+		return s.clone(), nil
+	}
+	if s.Count == 0 {
+		return other.clone(), nil
+	}
+
+	merged := s.clone()
+	merged.Positive.merge(other.Positive)
+	merged.Negative.merge(other.Negative)
+	merged.Zero += other.Zero
+	merged.Count += other.Count
+	merged.Sum += other.Sum
+	merged.Min = math.Min(merged.Min, other.Min)
+	merged.Max = math.Max(merged.Max, other.Max)
+	return merged, nil
+}
+
+// Quantile оценивает квантиль q (0 <= q <= 1). Результат ограничивается наблюдавшимися Min и Max.
+func (s SketchValue) Quantile(q float64) (float64, error) {
+	if q < 0 || q > 1 || math.IsNaN(q) {
+		return 0, fmt.Errorf("%w: quantile %v out of range", ErrInvalidSketch, q)
+	}
+	if s.Count == 0 {
+		return 0, fmt.Errorf("%w: empty sketch", ErrInvalidSketch)
+	}
+
+	rank := uint64(q * float64(s.Count-1))
+	var seen uint64
+	var result float64
+	found := false
+	for i := len(s.Negative.Counts) - 1; i >= 0 && !found; i-- {
+		seen += s.Negative.Counts[i]
+		if seen > rank {
+			result, found = -s.value(s.Negative.Offset+i), true
+		}
+	}
+	if !found {
+		seen += s.Zero
+		if seen > rank {
+			result, found = 0, true
+		}
+	}
+	for i := 0; i < len(s.Positive.Counts) && !found; i++ {
+		seen += s.Positive.Counts[i]
+		if seen > rank {
+			result, found = s.value(s.Positive.Offset+i), true
+		}
+	}
+	if !found {
+		result = s.Max
+	}
+	return math.Max(s.Min, math.Min(s.Max, result)), nil
+}
+
+// Validate проверяет, что скетч согласован: точность в диапазоне [minSketchAlpha, 1),
+// Count равен сумме всех интервалов, количество интервалов не превышает ограничение,
+// а их индексы соответствуют конечным значениям при данной точности.
+func (s SketchValue) Validate() error {
+	if !(s.Alpha >= minSketchAlpha && s.Alpha < 1) {
+		return fmt.Errorf("%w: alpha must be in [%v, 1)", ErrInvalidSketch, minSketchAlpha)
+	}
+	if len(s.Positive.Counts) > maxSketchBins || len(s.Negative.Counts) > maxSketchBins {
+		return fmt.Errorf("%w: too many bins", ErrInvalidSketch)
+	}
+	low, high := s.index(minSketchValue), s.index(math.MaxFloat64)
+	for _, b := range []SketchBins{s.Positive, s.Negative} {
+		if len(b.Counts) > 0 && (b.Offset < low || b.Offset > high-len(b.Counts)+1) {
+			return fmt.Errorf("%w: bin offset %d out of range [%d, %d]", ErrInvalidSketch, b.Offset, low, high)
+		}
+	}
+	total := s.Zero + s.Positive.total() + s.Negative.total()
+	if total != s.Count {
+		return fmt.Errorf("%w: count %d does not match bins total %d", ErrInvalidSketch, s.Count, total)
+	}
+	if s.Count > 0 && s.Min > s.Max {
+		return fmt.Errorf("%w: min is greater than max", ErrInvalidSketch)
+	}
+	return nil
+}
+
+// String форматирует скетч для отображения: count, sum и основные квантили.
+func (s SketchValue) String() string {
+	if s.Count == 0 {
+		return "count=0"
+	}
+	format := func(v float64) string { return strconv.FormatFloat(v, 'g', 6, 64) }
+	p50, _ := s.Quantile(0.5)
+	p95, _ := s.Quantile(0.95)
+	p99, _ := s.Quantile(0.99)
+	return fmt.Sprintf("count=%d sum=%s p50=%s p95=%s p99=%s", s.Count, format(s.Sum), format(p50), format(p95), format(p99))
+}
+
+func (s SketchValue) gamma() float64 {
+	return (1 + s.Alpha) / (1 - s.Alpha)
+}
+
+// index возвращает индекс логарифмического интервала для положительного значения.
+func (s SketchValue) index(value float64) int {
+	return int(math.Ceil(math.Log(value) / math.Log(s.gamma())))
+}
+
+// value возвращает представителя интервала index с относительной ошибкой не больше Alpha.
+func (s SketchValue) value(index int) float64 {
+	gamma := s.gamma()
+	return 2 * math.Pow(gamma, float64(index)) / (gamma + 1)
+}
+
+func (s SketchValue) clone() SketchValue {
+	c := s
+	c.Positive.Counts = append([]uint64(nil), s.Positive.Counts...)
+	c.Negative.Counts = append([]uint64(nil), s.Negative.Counts...)
+	return c
+}
+
+// add увеличивает количество значений в интервале index, расширяя массив при необходимости.
+func (b *SketchBins) add(index int, n uint64) {
+	low := b.extend(index, index)
+	b.Counts[max(index, low)-b.Offset] += n
+}
+
+// merge добавляет интервалы other, расширяя массив один раз на весь их диапазон.
+func (b *SketchBins) merge(other SketchBins) {
+	if len(other.Counts) == 0 {
+		return
+	}
+	low := b.extend(other.Offset, other.Offset+len(other.Counts)-1)
+	for i, n := range other.Counts {
+		b.Counts[max(other.Offset+i, low)-b.Offset] += n
+	}
+}
+
+// extend расширяет массив, чтобы он покрывал интервалы от low до high, и возвращает
+// фактическую нижнюю границу. Если диапазон превышает maxSketchBins, нижняя граница
+// поднимается, а количества младших интервалов переносятся в новый нижний интервал.
+// Значения ниже возвращенной границы вызывающий учитывает в ней же.
+func (b *SketchBins) extend(low, high int) int {
+	if len(b.Counts) > 0 {
+		low = min(low, b.Offset)
+		high = max(high, b.Offset+len(b.Counts)-1)
+	}
+	if high-low+1 > maxSketchBins {
+		low = high - maxSketchBins + 1
+	}
+	if len(b.Counts) > 0 && low == b.Offset && high == b.Offset+len(b.Counts)-1 {
+		return low
+	}
+
+	counts := make([]uint64, high-low+1)
+	for i, n := range b.Counts {
+		counts[max(b.Offset+i, low)-low] += n
+	}
+	b.Counts = counts
+	b.Offset = low
+	return low
+}
+
+func (b SketchBins) total() uint64 {
+	var total uint64
+	for _, n := range b.Counts {
+		total += n
+	}
+	return total
+}
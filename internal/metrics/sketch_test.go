@@ -0,0 +1,94 @@
+package models
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSketchValue_Quantile(t *testing.T) {
+	a := NewSketch(DefaultSketchAlpha)
+	b := NewSketch(DefaultSketchAlpha)
+	for i := 1; i <= 1000; i++ {
+		if i%2 == 0 {
+			a.Add(float64(i))
+		} else {
+			b.Add(float64(i))
+		}
+	}
+	require.NoError(t, a.Validate())
+
+	merged, err := a.Merge(b)
+	require.NoError(t, err)
+	require.NoError(t, merged.Validate())
+	assert.Equal(t, uint64(1000), merged.Count)
+	assert.Equal(t, 1.0, merged.Min)
+	assert.Equal(t, 1000.0, merged.Max)
+
+	for _, tc := range []struct{ q, want float64 }{{0.5, 500}, {0.95, 950}, {0.99, 990}} {
+		got, err := merged.Quantile(tc.q)
+		require.NoError(t, err)
+		assert.LessOrEqual(t, math.Abs(got-tc.want)/tc.want, 0.02, "q=%v got=%v", tc.q, got)
+	}
+
+	_, err = a.Merge(NewSketch(0.05))
+	assert.ErrorIs(t, err, ErrInvalidSketch)
+}
+
+func TestSketchValue_NegativeAndZero(t *testing.T) {
+	s := NewSketch(DefaultSketchAlpha)
+	for _, v := range []float64{-10, -1, 0, 1, 10} {
+		s.Add(v)
+	}
+	p0, err := s.Quantile(0)
+	require.NoError(t, err)
+	assert.Equal(t, -10.0, p0)
+
+	p50, err := s.Quantile(0.5)
+	require.NoError(t, err)
+	assert.Equal(t, 0.0, p50)
+
+	p100, err := s.Quantile(1)
+	require.NoError(t, err)
+	assert.Equal(t, 10.0, p100)
+
+	s.Count++
+	assert.ErrorIs(t, s.Validate(), ErrInvalidSketch)
+}
+
+func TestSketchValue_Bounds(t *testing.T) {
+	far := NewSketch(DefaultSketchAlpha)
+	far.Positive = SketchBins{Offset: 20_000_000, Counts: []uint64{1}}
+	far.Count = 1
+	assert.ErrorIs(t, far.Validate(), ErrInvalidSketch)
+
+	precise := NewSketch(minSketchAlpha / 2)
+	precise.Add(1)
+	assert.ErrorIs(t, precise.Validate(), ErrInvalidSketch)
+
+	// Скетчи на краях допустимого диапазона объединяются без роста сверх maxSketchBins.
+	low := NewSketch(DefaultSketchAlpha)
+	low.Add(minSketchValue)
+	high := NewSketch(DefaultSketchAlpha)
+	high.Add(math.MaxFloat64)
+	require.NoError(t, low.Validate())
+	require.NoError(t, high.Validate())
+
+	merged, err := low.Merge(high)
+	require.NoError(t, err)
+	require.NoError(t, merged.Validate())
+	assert.Len(t, merged.Positive.Counts, maxSketchBins)
+	assert.Equal(t, uint64(2), merged.Count)
+	p100, err := merged.Quantile(1)
+	require.NoError(t, err)
+	assert.Equal(t, math.MaxFloat64, p100)
+
+	s := NewSketch(DefaultSketchAlpha)
+	for v := 1e-9; v < 1e300; v *= 10 {
+		s.Add(v)
+	}
+	require.NoError(t, s.Validate())
+	assert.Len(t, s.Positive.Counts, maxSketchBins)
+}
@@ -0,0 +1,18 @@
+//go:build !unix
+
+package spool
+
+import (
+	"fmt"
+	"os"
+)
+
+// lockDir открывает каталог очереди. На этих платформах каталог не блокируется,
+// и каждому агенту нужен собственный каталог.
+func lockDir(dir string) (*os.File, error) {
+	f, err := os.Open(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open spool dir: %w", err)
+	}
+	return f, nil
+}
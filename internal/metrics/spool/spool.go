@@ -0,0 +1,285 @@
+// Package spool содержит дисковую очередь пакетов метрик, которые агент не смог отправить.
+package spool
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	models "github.com/chestorix/monmetrics/internal/metrics"
+)
+
+const (
+	// maxSegmentBytes - размер сегмента, после которого пакеты пишутся в новый сегмент.
+	maxSegmentBytes = 1 << 20
+	segmentExt      = ".seg"
+)
+
+var errCorrupted = errors.New("corrupted spool record")
+
+// ErrLocked возвращается Open, если каталог очереди уже открыт другим процессом.
+var ErrLocked = errors.New("spool dir is used by another process")
+
+// Batch - пакет метрик в очереди вместе с ключом идемпотентности,
+// с которым пакет отправлялся, чтобы повторная отправка не применила его дважды.
+// Created - время постановки в очередь, заполняется Append.
+type Batch struct {
+	Created time.Time        `json:"created"`
+	Key     string           `json:"key"`
+	Metrics []models.Metrics `json:"metrics"`
+}
+
+type segment struct {
+	modTime time.Time
+	id      uint64
+	size    int64
+}
+
+// Spool - ограниченная дисковая очередь пакетов.
+// Пакеты дописываются строками JSON в файлы-сегменты каталога и читаются в порядке записи.
+// Если общий размер сегментов превышает maxBytes, удаляются самые старые сегменты,
+// пакеты, поставленные в очередь раньше чем maxAge назад, пропускаются. Нулевые ограничения не действуют.
+// Позиция чтения хранится только в памяти: после перезапуска агента пакеты непрочитанного
+// до конца сегмента отправляются повторно, их дубли отбрасывает сервер по ключу идемпотентности.
+// Сервер помнит ключи ограниченное время, поэтому maxAge не должен превышать окно идемпотентности
+// сервера, иначе повтор уже примененного пакета учтет приращения счетчиков дважды.
+type Spool struct {
+	lock       *os.File
+	dir        string
+	segments   []segment
+	maxBytes   int64
+	maxAge     time.Duration
+	readOffset int64
+	nextLen    int64
+	mu         sync.Mutex
+}
+
+// Open открывает очередь в каталоге dir, создавая его при необходимости, и блокирует каталог
+// до вызова Close. Если каталог уже открыт другим процессом, возвращается ErrLocked.
+func Open(dir string, maxBytes int64, maxAge time.Duration) (*Spool, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create spool dir: %w", err)
+	}
+	lock, err := lockDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		lock.Close()
+		return nil, fmt.Errorf("failed to read spool dir: %w", err)
+	}
+
+	s := &Spool{lock: lock, dir: dir, maxBytes: maxBytes, maxAge: maxAge}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, segmentExt) {
+			continue
+		}
+		id, err := strconv.ParseUint(strings.TrimSuffix(name, segmentExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			lock.Close()
+			return nil, fmt.Errorf("failed to stat spool segment: %w", err)
+		}
+		s.segments = append(s.segments, segment{id: id, size: info.Size(), modTime: info.ModTime()})
+	}
+	sort.Slice(s.segments, func(i, j int) bool { return s.segments[i].id < s.segments[j].id })
+	return s, nil
+}
+
+// Close снимает блокировку каталога очереди.
+func (s *Spool) Close() error {
+	return s.lock.Close()
+}
+
+// Append дописывает пакет в конец очереди.
+func (s *Spool) Append(batch Batch) error {
+	if batch.Created.IsZero() {
+		batch.Created = time.Now()
+	}
+	data, err := json.Marshal(batch)
+	if err != nil {
+		return fmt.Errorf("failed to encode batch: %w", err)
+	}
+	data = append(data, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if n := len(s.segments); n == 0 || s.segments[n-1].size+int64(len(data)) > maxSegmentBytes {
+		var id uint64 = 1
+		if n > 0 {
+			id = s.segments[n-1].id + 1
+		}
+		s.segments = append(s.segments, segment{id: id})
+	}
+
+	last := &s.segments[len(s.segments)-1]
+	f, err := os.OpenFile(s.path(last.id), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open spool segment: %w", err)
+	}
+	defer f.Close()
+	if _, err := f.Write(data); err != nil {
+		return fmt.Errorf("failed to write spool segment: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("failed to sync spool segment: %w", err)
+	}
+	last.size += int64(len(data))
+	last.modTime = time.Now()
+	return s.trim()
+}
+
+// Peek возвращает самый старый пакет очереди, не удаляя его. Второе значение равно false, если очередь пуста.
+// Поврежденные записи (например, недописанные при аварийном завершении) пропускаются вместе с остатком сегмента.
+func (s *Spool) Peek() (Batch, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.expire(); err != nil {
+		return Batch{}, false, err
+	}
+
+	for len(s.segments) > 0 {
+		batch, n, err := s.read(s.segments[0].id, s.readOffset)
+		if err == nil && s.expired(batch) {
+			s.nextLen = n
+			if err := s.ack(); err != nil {
+				return Batch{}, false, err
+			}
+			continue
+		}
+		if err == nil {
+			s.nextLen = n
+			return batch, true, nil
+		}
+		if !errors.Is(err, io.EOF) && !errors.Is(err, errCorrupted) {
+			return Batch{}, false, err
+		}
+		if err := s.dropOldest(); err != nil {
+			return Batch{}, false, err
+		}
+	}
+	return Batch{}, false, nil
+}
+
+// Ack удаляет из очереди пакет, возвращенный последним вызовом Peek.
+func (s *Spool) Ack() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ack()
+}
+
+// ack удаляет пакет, прочитанный последним, и сегмент, если он прочитан до конца.
+// Вызывается под блокировкой s.mu.
+func (s *Spool) ack() error {
+	if len(s.segments) == 0 || s.nextLen == 0 {
+		return nil
+	}
+	s.readOffset += s.nextLen
+	s.nextLen = 0
+	if s.readOffset >= s.segments[0].size {
+		return s.dropOldest()
+	}
+	return nil
+}
+
+// Empty сообщает, что в очереди нет пакетов.
+func (s *Spool) Empty() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.segments) == 0
+}
+
+// read читает запись сегмента id, начинающуюся с offset, и возвращает ее длину.
+func (s *Spool) read(id uint64, offset int64) (Batch, int64, error) {
+	f, err := os.Open(s.path(id))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return Batch{}, 0, io.EOF
+		}
+		return Batch{}, 0, fmt.Errorf("failed to open spool segment: %w", err)
+	}
+	defer f.Close()
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return Batch{}, 0, fmt.Errorf("failed to seek spool segment: %w", err)
+	}
+
+	line, err := bufio.NewReader(f).ReadBytes('\n')
+	if err != nil {
+		if errors.Is(err, io.EOF) && len(line) > 0 {
+			return Batch{}, 0, errCorrupted
+		}
+		return Batch{}, 0, err
+	}
+	var batch Batch
+	if err := json.Unmarshal(line, &batch); err != nil {
+		return Batch{}, 0, errCorrupted
+	}
+	return batch, int64(len(line)), nil
+}
+
+// trim удаляет самые старые сегменты, пока общий размер очереди превышает maxBytes.
+// Последний сегмент не удаляется, нулевой maxBytes не ограничивает размер. Вызывается под блокировкой s.mu.
+func (s *Spool) trim() error {
+	if s.maxBytes <= 0 {
+		return nil
+	}
+	var total int64
+	for _, seg := range s.segments {
+		total += seg.size
+	}
+	for len(s.segments) > 1 && total > s.maxBytes {
+		total -= s.segments[0].size
+		if err := s.dropOldest(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// expire удаляет сегменты, в которые ничего не записывалось дольше maxAge. Вызывается под блокировкой s.mu.
+func (s *Spool) expire() error {
+	if s.maxAge <= 0 {
+		return nil
+	}
+	cutoff := time.Now().Add(-s.maxAge)
+	for len(s.segments) > 0 && s.segments[0].modTime.Before(cutoff) {
+		if err := s.dropOldest(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// expired сообщает, что пакет поставлен в очередь раньше чем maxAge назад.
+func (s *Spool) expired(batch Batch) bool {
+	return s.maxAge > 0 && !batch.Created.IsZero() && time.Since(batch.Created) > s.maxAge
+}
+
+// dropOldest удаляет самый старый сегмент и сбрасывает позицию чтения. Вызывается под блокировкой s.mu.
+func (s *Spool) dropOldest() error {
+	if err := os.Remove(s.path(s.segments[0].id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove spool segment: %w", err)
+	}
+	s.segments = s.segments[1:]
+	s.readOffset = 0
+	s.nextLen = 0
+	return nil
+}
+
+func (s *Spool) path(id uint64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%020d%s", id, segmentExt))
+}
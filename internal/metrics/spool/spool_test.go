@@ -0,0 +1,108 @@
+package spool
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	models "github.com/chestorix/monmetrics/internal/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func batch(key string) Batch {
+	delta := int64(1)
+	return Batch{Key: key, Metrics: []models.Metrics{{ID: "PollCount", MType: models.Counter, Delta: &delta}}}
+}
+
+func drain(t *testing.T, s *Spool) []string {
+	t.Helper()
+	var keys []string
+	for {
+		b, ok, err := s.Peek()
+		require.NoError(t, err)
+		if !ok {
+			return keys
+		}
+		keys = append(keys, b.Key)
+		require.NoError(t, s.Ack())
+	}
+}
+
+func TestSpool_ReplayInOrder(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir, 0, 0)
+	require.NoError(t, err)
+	assert.True(t, s.Empty())
+
+	for _, key := range []string{"a", "b", "c"} {
+		require.NoError(t, s.Append(batch(key)))
+	}
+
+	b, ok, err := s.Peek()
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, "a", b.Key)
+	assert.Equal(t, int64(1), *b.Metrics[0].Delta)
+
+	// Каталог заблокирован, пока очередь открыта.
+	_, err = Open(dir, 0, 0)
+	assert.ErrorIs(t, err, ErrLocked)
+
+	// Без Ack пакет остается в очереди, в том числе после повторного открытия.
+	require.NoError(t, s.Close())
+	s, err = Open(dir, 0, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "b", "c"}, drain(t, s))
+	assert.True(t, s.Empty())
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestSpool_Limits(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir, 1, 0)
+	require.NoError(t, err)
+	s.segments = append(s.segments, segment{id: 1})
+	require.NoError(t, os.WriteFile(s.path(1), nil, 0o644))
+	s.segments[0].size = maxSegmentBytes
+	require.NoError(t, s.Append(batch("new")))
+	assert.Equal(t, []string{"new"}, drain(t, s))
+
+	require.NoError(t, s.Close())
+	s, err = Open(dir, 0, time.Minute)
+	require.NoError(t, err)
+	require.NoError(t, s.Append(batch("old")))
+	s.segments[0].modTime = time.Now().Add(-2 * time.Minute)
+	assert.Empty(t, drain(t, s))
+
+	// Старые пакеты пропускаются, даже если в их сегмент недавно дописывали.
+	stale := batch("stale")
+	stale.Created = time.Now().Add(-2 * time.Minute)
+	require.NoError(t, s.Append(stale))
+	require.NoError(t, s.Append(batch("fresh")))
+	assert.Equal(t, []string{"fresh"}, drain(t, s))
+}
+
+func TestSpool_CorruptedTail(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir, 0, 0)
+	require.NoError(t, err)
+	require.NoError(t, s.Append(batch("a")))
+
+	f, err := os.OpenFile(filepath.Join(dir, "00000000000000000001.seg"), os.O_APPEND|os.O_WRONLY, 0o644)
+	require.NoError(t, err)
+	_, err = f.WriteString(`{"key": "b", "metr`)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	require.NoError(t, s.Close())
+	s, err = Open(dir, 0, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a"}, drain(t, s))
+	require.NoError(t, s.Append(batch("c")))
+	assert.Equal(t, []string{"c"}, drain(t, s))
+}